@@ -0,0 +1,164 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ControlApi 本地的HTTP控制接口(查看配置差异等),由[Api]配置开启
+//只接受本机(loopback)的请求,配置了Token时其它机器带上 Authorization: Bearer <Token> 也可以访问
+type ControlApi struct {
+	mux      *http.ServeMux
+	server   *http.Server
+	listener net.Listener
+	addr     string
+	token    string
+	mu       sync.Mutex
+}
+
+//NewControlApi New一个控制接口实例
+func NewControlApi() *ControlApi {
+	return &ControlApi{mux: http.NewServeMux()}
+}
+
+//HandleFunc 注册接口
+func (api *ControlApi) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	api.mux.HandleFunc(pattern, handler)
+}
+
+//Update 根据配置开启、关闭或者更换监听地址,监听失败时返回错误
+func (api *ControlApi) Update(open bool, addr, token string) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.token = token
+	if token != "" {
+		logdoo.AddRedactSecret(token)
+	}
+	if api.server != nil && (!open || addr != api.addr) {
+		api.server.Close()
+		api.server, api.listener = nil, nil
+		logdoo.Info("control api closed", logdoo.String("addr", api.addr))
+	}
+
+	if !open || api.server != nil {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logdoo.Error("control api listen fail", logdoo.String("addr", addr), logdoo.Err(err))
+		return err
+	}
+	server := &http.Server{Handler: http.HandlerFunc(api.serve), ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
+	api.server, api.listener, api.addr = server, ln, addr
+	logdoo.Info("control api listen", logdoo.String("addr", ln.Addr().String()))
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logdoo.Error("control api serve fail", logdoo.String("addr", addr), logdoo.Err(err))
+		}
+	}()
+	return nil
+}
+
+//Addr 实际监听的地址(配置的端口为0时可以拿到分配的端口),没有开启时返回空
+func (api *ControlApi) Addr() string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.listener == nil {
+		return ""
+	}
+	return api.listener.Addr().String()
+}
+
+//serve 拒绝非本机并且没有带正确Token的请求
+func (api *ControlApi) serve(w http.ResponseWriter, r *http.Request) {
+	if !isLoopback(r.RemoteAddr) && !api.authorized(r) {
+		logdoo.Warn("control api reject request", logdoo.String("remote", r.RemoteAddr), logdoo.String("path", r.URL.Path))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	api.mux.ServeHTTP(w, r)
+}
+
+func (api *ControlApi) authorized(r *http.Request) bool {
+	api.mu.Lock()
+	token := api.token
+	api.mu.Unlock()
+
+	auth := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
+
+//isLoopback 请求是否来自本机
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//Close 关闭控制接口
+func (api *ControlApi) Close() {
+	api.Update(false, "", "")
+}
+
+//WriteJSON 以json格式返回数据
+func WriteJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logdoo.Warn("control api write json fail", logdoo.Err(err))
+	}
+}
+
+//RegisterCfgApi 注册配置相关的接口
+func RegisterCfgApi(api *ControlApi, mc *MonitorCfg) {
+	//GET /cfg/diff 最近一次重新加载配置的差异
+	api.HandleFunc("/cfg/diff", func(w http.ResponseWriter, r *http.Request) {
+		diff := mc.GetLastDiff()
+		if diff == nil {
+			http.Error(w, "no config loaded yet", http.StatusNotFound)
+			return
+		}
+		WriteJSON(w, diff)
+	})
+}
+
+//RegisterLogApi 注册日记相关的接口
+func RegisterLogApi(api *ControlApi, levels *LogLevels) {
+	//GET /log/level 查看各日记的级别, POST /log/level?handler=file&level=debug 修改日记级别,level=config恢复为配置中的级别
+	api.HandleFunc("/log/level", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			name, value := r.FormValue("handler"), r.FormValue("level")
+			var ok bool
+			if value == "config" {
+				ok = levels.Reset(name)
+			} else {
+				level, err := logdoo.ParseLevel(value)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				ok = levels.Override(name, level)
+			}
+			if !ok {
+				http.Error(w, "unknow handler, should be one of "+strings.Join(levels.Names(), ","), http.StatusBadRequest)
+				return
+			}
+			logdoo.Info("log level change by control api", logdoo.String("handler", name), logdoo.String("level", value))
+		}
+
+		WriteJSON(w, levels.Levels())
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+//startApi 在本机随机端口开启控制接口
+func startApi(t *testing.T, mc *MonitorCfg, token string) (*ControlApi, string) {
+	api := NewControlApi()
+	RegisterCfgApi(api, mc)
+	levels := NewLogLevels()
+	levels.Apply("console", logdoo.Console, logdoo.Console.Level())
+	levels.Apply("file", logdoo.LogInfo, logdoo.LogInfo.Level())
+	RegisterLogApi(api, levels)
+	RegisterHealthApi(api, NewHealthMonitor())
+	if err := api.Update(true, "127.0.0.1:0", token); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(api.Close)
+	return api, "http://" + api.Addr()
+}
+
+//getApi 请求接口,返回状态码和内容
+func getApi(t *testing.T, method, url string) (int, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestControlApi(t *testing.T) {
+	mc := &MonitorCfg{}
+	_, base := startApi(t, mc, "")
+
+	if code, body := getApi(t, http.MethodGet, base+"/health"); code != http.StatusOK || strings.TrimSpace(body) != "[]" {
+		t.Errorf("/health %d %s", code, body)
+	}
+
+	if code, body := getApi(t, http.MethodGet, base+"/cfg/diff"); code != http.StatusNotFound {
+		t.Errorf("/cfg/diff before load %d %s", code, body)
+	}
+	mc.lastDiff = &CfgDiff{Time: time.Now(), AddedServices: []string{"Doo"}}
+	code, body := getApi(t, http.MethodGet, base+"/cfg/diff")
+	var diff CfgDiff
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &diff) != nil || len(diff.AddedServices) != 1 || diff.AddedServices[0] != "Doo" {
+		t.Errorf("/cfg/diff %d %s", code, body)
+	}
+}
+
+func TestControlApiLogLevel(t *testing.T) {
+	old := logdoo.LogInfo.Level()
+	defer logdoo.LogInfo.SetLevel(old)
+	_, base := startApi(t, &MonitorCfg{}, "")
+
+	code, body := getApi(t, http.MethodPost, base+"/log/level?handler=file&level=debug")
+	levels := make(map[string]string)
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &levels) != nil || levels["file"] != "debug" {
+		t.Errorf("POST /log/level %d %s", code, body)
+	}
+	if logdoo.LogInfo.Level() != logdoo.DEBUG {
+		t.Errorf("file level %s, want debug", logdoo.LogInfo.Level())
+	}
+
+	if code, body := getApi(t, http.MethodPost, base+"/log/level?handler=other&level=debug"); code != http.StatusBadRequest || !strings.Contains(body, "console,file") {
+		t.Errorf("unknow handler %d %s", code, body)
+	}
+	if code, _ := getApi(t, http.MethodPost, base+"/log/level?handler=file&level=loud"); code != http.StatusBadRequest {
+		t.Errorf("unknow level %d", code)
+	}
+	if code, body := getApi(t, http.MethodGet, base+"/log/level"); code != http.StatusOK || !strings.Contains(body, `"file":"debug"`) {
+		t.Errorf("GET /log/level %d %s", code, body)
+	}
+
+	if code, body := getApi(t, http.MethodPost, base+"/log/level?handler=file&level=config"); code != http.StatusOK || !strings.Contains(body, `"file":"`+old.String()+`"`) {
+		t.Errorf("reset file level %d %s", code, body)
+	}
+}
+
+func TestControlApiReject(t *testing.T) {
+	api, _ := startApi(t, &MonitorCfg{}, "S3cr3t-token")
+
+	tests := []struct {
+		name   string
+		remote string
+		auth   string
+		code   int
+	}{
+		{"loopback v4", "127.0.0.1:5000", "", http.StatusOK},
+		{"loopback v6", "[::1]:5000", "", http.StatusOK},
+		{"remote", "10.1.2.3:5000", "", http.StatusForbidden},
+		{"remote wrong token", "10.1.2.3:5000", "Bearer other", http.StatusForbidden},
+		{"remote basic auth", "10.1.2.3:5000", "Basic UzNjcjN0LXRva2Vu", http.StatusForbidden},
+		{"remote token", "10.1.2.3:5000", "Bearer S3cr3t-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/health", nil)
+			r.RemoteAddr = tt.remote
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			api.serve(w, r)
+			if w.Code != tt.code {
+				t.Errorf("code %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+
+	//没有配置Token时非本机的请求都拒绝
+	api.Update(true, api.addr, "")
+	r := httptest.NewRequest(http.MethodGet, "/health", nil)
+	r.RemoteAddr = "10.1.2.3:5000"
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	api.serve(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("remote without token config %d", w.Code)
+	}
+}
+
+func TestControlApiUpdate(t *testing.T) {
+	api, base := startApi(t, &MonitorCfg{}, "")
+	if code, _ := getApi(t, http.MethodGet, base+"/health"); code != http.StatusOK {
+		t.Fatalf("/health %d", code)
+	}
+
+	api.Close()
+	if api.Addr() != "" {
+		t.Errorf("addr after close %s", api.Addr())
+	}
+	if _, err := http.Get(base + "/health"); err == nil {
+		t.Error("request after close should fail")
+	}
+
+	u, _ := url.Parse(base)
+	if err := api.Update(true, "256.0.0.1:"+u.Port(), ""); err == nil {
+		t.Error("listen on invalid addr should fail")
+	}
+}
@@ -1,49 +1,216 @@
 package main
 
 import (
+	"GoMonitor/logdoo"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
 
-//MonitorCfg 监控程序的配置结构
-type MonitorCfg struct {
+//CfgData 一份完整的配置数据,重新加载时先解析到新的CfgData,校验通过后再整体替换
+type CfgData struct {
 	machineName     string            //当前监控的机器名
 	serviceSpecName map[string]string //指定的service名字以及对应附件目录
 	servicePartName []string          //监控的包含指定前缀的服务
 	emailData       EmailData
-	refreshTime     int
-	mu              sync.RWMutex
+	timer           TimerCfg
+	apiOpen         int    //是否开启控制API
+	apiAddr         string //控制API监听的地址
+	apiToken        string //非本机访问控制API需要的Token
+	remote          RemoteCfg
+	log             LogCfg
+	health          HealthCfg
+	cfgFiles        []string //本次加载用到的所有配置文件(包括include的文件)
+}
+
+//TimerCfg [Timer]定时相关的配置,修改后重新加载即生效
+type TimerCfg struct {
+	RefreshInterval time.Duration //多久重新查找一次需要监控的service
+	CheckInterval   time.Duration //多久检查一遍service的状态
+	RestartWorkers  int           //同时重启service的协程数
+	EmailInterval   time.Duration //同一个service两次邮件通知的最小间隔,0表示不限制
+}
+
+//LogCfg [Log]日记相关的配置
+type LogCfg struct {
+	ConsoleFormat      logdoo.Format //控制台日记格式(text/json)
+	FileFormat         logdoo.Format //文件日记格式(text/json)
+	ConsoleLevel       logdoo.Level  //控制台日记的最低级别
+	FileLevel          logdoo.Level  //文件日记的最低级别
+	Retention          logdoo.Retention
+	Async              bool                  //文件日记是否异步输出
+	AsyncSize          int                   //异步日记缓冲区的条数
+	AsyncPolicy        logdoo.OverflowPolicy //缓冲区满时的处理方式
+	Syslog             string                //syslog地址(network://addr或local)
+	Journald           bool                  //是否输出到journald
+	Collector          string                //远程日记收集服务的地址(http(s)://或tcp://)
+	CollectorSpoolSize int64                 //发送失败时磁盘缓冲文件的最大大小(MB)
+	Redact             []string              //脱敏规则(内置规则名或正则表达式)
+	RedactKeys         []string              //值需要整体脱敏的字段名
+	Rotate             logdoo.RotatePolicy   //文件日记按时间切换的方式
+	MaxSize            int64                 //单个日记文件的最大大小(MB)
+}
+
+//MonitorCfg 监控程序的配置结构
+type MonitorCfg struct {
+	CfgData
+	lastDiff *CfgDiff //最近一次重新加载配置的差异
+	mu       sync.RWMutex
+}
+
+//CfgDiff 两次加载配置之间的差异
+type CfgDiff struct {
+	Time            time.Time `json:"time"`
+	AddedServices   []string  `json:"added_services"`   //新增监控的服务
+	RemovedServices []string  `json:"removed_services"` //移除监控的服务
+	Changed         []string  `json:"changed"`          //修改的配置项
 }
 
+//envRefRegexp 配置值中${ENV}形式的环境变量引用
+var envRefRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
 //NewMonitorCfg New一个配置变量
 func NewMonitorCfg() *MonitorCfg {
-	return &MonitorCfg{serviceSpecName: make(map[string]string),
+	return &MonitorCfg{CfgData: *NewCfgData()}
+}
+
+//NewCfgData New一个默认的配置数据
+func NewCfgData() *CfgData {
+	return &CfgData{machineName: "Unknow Machine Name",
+		serviceSpecName: make(map[string]string),
 		servicePartName: make([]string, 0),
-		emailData:       EmailData{receiveU: make([]string, 0)}}
+		emailData:       EmailData{receiveU: make([]string, 0)},
+		timer: TimerCfg{RefreshInterval: 300 * time.Second,
+			CheckInterval:  10 * time.Millisecond,
+			RestartWorkers: ServiceChanNum},
+		remote:   RemoteCfg{Interval: 60 * time.Second},
+		log:      LogCfg{AsyncSize: 4096, CollectorSpoolSize: 64, Rotate: logdoo.RotateDaily, MaxSize: 800},
+		cfgFiles: make([]string, 0)}
 }
 
-//LoadCfg 加载配置文件
-func (mcfg *MonitorCfg) LoadCfg(path string) error {
-	cfg, err := ini.Load(path)
+//LoadCfg 加载配置文件,解析并校验通过后才替换当前配置,返回与之前配置的差异
+func (mcfg *MonitorCfg) LoadCfg(path string) (*CfgDiff, error) {
+	data, err := ParseCfg(path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := data.Validate(); err != nil {
+		return nil, err
 	}
 
 	mcfg.mu.Lock()
 	defer mcfg.mu.Unlock()
+	diff := DiffCfg(&mcfg.CfgData, data)
+	mcfg.CfgData = *data
+	mcfg.lastDiff = diff
+	return diff, nil
+}
+
+//ParseCfg 解析配置文件到一份新的配置数据中
+func ParseCfg(path string) (*CfgData, error) {
+	files, err := GetIncludeFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := ParseRemoteCfg(path)
+	if err != nil {
+		return nil, err
+	}
+
+	//远程配置的本地缓存作为最底层的公共配置
+	var remoteCfg []byte
+	if remote.Open && PathExists(remote.Cache) {
+		if remoteCfg, err = LoadRemoteCache(remote.Cache); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ParseCfgFiles(remoteCfg, files)
+	if err != nil {
+		return nil, err
+	}
+	data.remote = remote
+	return data, nil
+}
+
+//ParseRemoteCfg 解析[Remote]远程配置源的设置(只从本地的配置文件读取,不允许被远程配置覆盖)
+func ParseRemoteCfg(path string) (RemoteCfg, error) {
+	remote := RemoteCfg{Interval: 60 * time.Second, Cache: filepath.Join(filepath.Dir(path), "remote_cache.ini")}
+
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return remote, err
+	}
+	ExpandEnvCfg(cfg)
+
+	sec, err := cfg.GetSection("Remote")
+	if err != nil {
+		return remote, nil
+	}
+
+	if sec.HasKey("Open") {
+		open, err := sec.Key("Open").Int()
+		if err != nil {
+			return remote, fmt.Errorf("Remote Open err:%s", err)
+		}
+		remote.Open = open == 1
+	}
+	if sec.HasKey("Url") {
+		remote.Url = sec.Key("Url").Value()
+	}
+	if sec.HasKey("Path") {
+		remote.Path = sec.Key("Path").Value()
+	}
+	if sec.HasKey("Interval") {
+		if remote.Interval, err = ParseDuration(sec.Key("Interval").Value()); err != nil {
+			return remote, fmt.Errorf("Remote Interval err:%s", err)
+		}
+	}
+	if sec.HasKey("Cache") {
+		remote.Cache = sec.Key("Cache").Value()
+		if !filepath.IsAbs(remote.Cache) {
+			remote.Cache = filepath.Join(filepath.Dir(path), remote.Cache)
+		}
+	}
+
+	return remote, nil
+}
+
+//ParseCfgFiles 按顺序加载多个配置文件并解析,后面文件的同名配置覆盖前面的;remote为远程配置的内容(可以为nil),最先加载
+func ParseCfgFiles(remote []byte, files []string) (*CfgData, error) {
+	//远程配置最先,include的公共配置在前,当前文件在后,后加载的同名配置会覆盖前面的
+	sources := make([]interface{}, 0, len(files)+1)
+	if remote != nil {
+		sources = append(sources, remote)
+	}
+	for _, f := range files {
+		sources = append(sources, f)
+	}
+	cfg, err := ini.Load(sources[0], sources[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	ExpandEnvCfg(cfg)
+
+	data := NewCfgData()
+	data.cfgFiles = files
 
-	mcfg.machineName = "Unknow Machine Name"
 	if sec, er := cfg.GetSection("Machine"); er == nil {
 		if sec.HasKey("Name") {
-			mcfg.machineName = sec.Key("Name").Value()
+			data.machineName = sec.Key("Name").Value()
 		}
 	}
 
-	mcfg.serviceSpecName = make(map[string]string)
-	mcfg.servicePartName = make([]string, 0)
 	if sec, er := cfg.GetSection("SpecInfo"); er == nil {
 		var beforeSuffix = -1
 		keys := sec.Keys()
@@ -64,9 +231,9 @@ func (mcfg *MonitorCfg) LoadCfg(path string) error {
 
 			if sec.HasKey("Name" + strconv.Itoa(suffix)) {
 				if sec.HasKey("Attach" + strconv.Itoa(suffix)) {
-					mcfg.serviceSpecName[sec.Key("Name"+strconv.Itoa(suffix)).Value()] = sec.Key("Attach" + strconv.Itoa(suffix)).Value()
+					data.serviceSpecName[sec.Key("Name"+strconv.Itoa(suffix)).Value()] = sec.Key("Attach" + strconv.Itoa(suffix)).Value()
 				} else {
-					mcfg.serviceSpecName[sec.Key("Name"+strconv.Itoa(suffix)).Value()] = ""
+					data.serviceSpecName[sec.Key("Name"+strconv.Itoa(suffix)).Value()] = ""
 				}
 			}
 		}
@@ -83,45 +250,542 @@ func (mcfg *MonitorCfg) LoadCfg(path string) error {
 			}
 
 			if sec.HasKey("Name" + strconv.Itoa(suffix)) {
-				mcfg.servicePartName = append(mcfg.servicePartName, sec.Key("Name"+strconv.Itoa(suffix)).Value())
+				data.servicePartName = append(data.servicePartName, sec.Key("Name"+strconv.Itoa(suffix)).Value())
 			}
 		}
 	}
 
-	mcfg.emailData = EmailData{receiveU: make([]string, 0)}
 	if sec, er := cfg.GetSection("EmailInfo"); er == nil {
 		if sec.HasKey("Open") {
-			mcfg.emailData.status, _ = sec.Key("Open").Int()
+			if data.emailData.status, err = sec.Key("Open").Int(); err != nil {
+				return nil, fmt.Errorf("EmailInfo Open err:%s", err)
+			}
 		}
 		if sec.HasKey("Host") {
-			mcfg.emailData.host = sec.Key("Host").Value()
+			data.emailData.host = sec.Key("Host").Value()
 		}
 		if sec.HasKey("Port") {
-			mcfg.emailData.port, _ = sec.Key("Port").Int()
+			if data.emailData.port, err = sec.Key("Port").Int(); err != nil {
+				return nil, fmt.Errorf("EmailInfo Port err:%s", err)
+			}
 		}
 		if sec.HasKey("SendU") {
-			mcfg.emailData.sendU = sec.Key("SendU").Value()
+			data.emailData.sendU = sec.Key("SendU").Value()
 		}
 		if sec.HasKey("SendP") {
-			mcfg.emailData.sendP = sec.Key("SendP").Value()
+			data.emailData.sendP = sec.Key("SendP").Value()
 		}
 		if sec.HasKey("ReceiveU") {
 			str := sec.Key("ReceiveU").Value()
-			mcfg.emailData.receiveU = strings.Split(str, ",")
+			data.emailData.receiveU = strings.Split(str, ",")
 
 		}
 	}
 
-	mcfg.refreshTime = 300
 	if sec, er := cfg.GetSection("Timer"); er == nil {
-		if sec.HasKey("RefreshCfg") {
-			mcfg.refreshTime, _ = sec.Key("RefreshCfg").Int()
+		//RefreshCfg、Refresh是旧的配置名,兼容保留
+		for _, name := range []string{"Refresh", "RefreshCfg", "RefreshInterval"} {
+			if sec.HasKey(name) {
+				if data.timer.RefreshInterval, err = ParseDuration(sec.Key(name).Value()); err != nil {
+					return nil, fmt.Errorf("Timer %s err:%s", name, err)
+				}
+			}
 		}
+		if sec.HasKey("CheckInterval") {
+			if data.timer.CheckInterval, err = ParseDuration(sec.Key("CheckInterval").Value()); err != nil {
+				return nil, fmt.Errorf("Timer CheckInterval err:%s", err)
+			}
+		}
+		if sec.HasKey("RestartWorkers") {
+			if data.timer.RestartWorkers, err = sec.Key("RestartWorkers").Int(); err != nil {
+				return nil, fmt.Errorf("Timer RestartWorkers err:%s", err)
+			}
+		}
+		if sec.HasKey("EmailInterval") {
+			if data.timer.EmailInterval, err = ParseDuration(sec.Key("EmailInterval").Value()); err != nil {
+				return nil, fmt.Errorf("Timer EmailInterval err:%s", err)
+			}
+		}
+	}
+
+	if sec, er := cfg.GetSection("Log"); er == nil {
+		if sec.HasKey("ConsoleFormat") {
+			if data.log.ConsoleFormat, err = logdoo.ParseFormat(sec.Key("ConsoleFormat").Value()); err != nil {
+				return nil, fmt.Errorf("Log ConsoleFormat err:%s", err)
+			}
+		}
+		if sec.HasKey("FileFormat") {
+			if data.log.FileFormat, err = logdoo.ParseFormat(sec.Key("FileFormat").Value()); err != nil {
+				return nil, fmt.Errorf("Log FileFormat err:%s", err)
+			}
+		}
+		if sec.HasKey("ConsoleLevel") {
+			if data.log.ConsoleLevel, err = logdoo.ParseLevel(sec.Key("ConsoleLevel").Value()); err != nil {
+				return nil, fmt.Errorf("Log ConsoleLevel err:%s", err)
+			}
+		}
+		if sec.HasKey("FileLevel") {
+			if data.log.FileLevel, err = logdoo.ParseLevel(sec.Key("FileLevel").Value()); err != nil {
+				return nil, fmt.Errorf("Log FileLevel err:%s", err)
+			}
+		}
+		if sec.HasKey("MaxDays") {
+			days, err := sec.Key("MaxDays").Int()
+			if err != nil {
+				return nil, fmt.Errorf("Log MaxDays err:%s", err)
+			}
+			data.log.Retention.MaxAge = time.Duration(days) * 24 * time.Hour
+		}
+		if sec.HasKey("MaxTotalSize") {
+			size, err := sec.Key("MaxTotalSize").Int64()
+			if err != nil {
+				return nil, fmt.Errorf("Log MaxTotalSize err:%s", err)
+			}
+			data.log.Retention.MaxTotal = size * 1024 * 1024
+		}
+		if sec.HasKey("MaxFiles") {
+			if data.log.Retention.MaxFiles, err = sec.Key("MaxFiles").Int(); err != nil {
+				return nil, fmt.Errorf("Log MaxFiles err:%s", err)
+			}
+		}
+		if sec.HasKey("Compress") {
+			compress, err := sec.Key("Compress").Int()
+			if err != nil {
+				return nil, fmt.Errorf("Log Compress err:%s", err)
+			}
+			data.log.Retention.Compress = compress == 1
+		}
+		if sec.HasKey("Async") {
+			async, err := sec.Key("Async").Int()
+			if err != nil {
+				return nil, fmt.Errorf("Log Async err:%s", err)
+			}
+			data.log.Async = async == 1
+		}
+		if sec.HasKey("AsyncSize") {
+			if data.log.AsyncSize, err = sec.Key("AsyncSize").Int(); err != nil {
+				return nil, fmt.Errorf("Log AsyncSize err:%s", err)
+			}
+		}
+		if sec.HasKey("AsyncPolicy") {
+			if data.log.AsyncPolicy, err = logdoo.ParseOverflowPolicy(sec.Key("AsyncPolicy").Value()); err != nil {
+				return nil, fmt.Errorf("Log AsyncPolicy err:%s", err)
+			}
+		}
+		if addr := strings.TrimSpace(sec.Key("Syslog").Value()); addr != "" {
+			network, host, err := logdoo.ParseSyslogAddr(addr)
+			if err != nil {
+				return nil, fmt.Errorf("Log Syslog err:%s", err)
+			}
+			data.log.Syslog = "local"
+			if network != "" {
+				data.log.Syslog = network + "://" + host
+			}
+		}
+		if sec.HasKey("Rotate") {
+			if data.log.Rotate, err = logdoo.ParseRotatePolicy(sec.Key("Rotate").Value()); err != nil {
+				return nil, fmt.Errorf("Log Rotate err:%s", err)
+			}
+		}
+		if sec.HasKey("MaxSize") {
+			if data.log.MaxSize, err = sec.Key("MaxSize").Int64(); err != nil {
+				return nil, fmt.Errorf("Log MaxSize err:%s", err)
+			}
+		}
+		if sec.HasKey("Journald") {
+			journald, err := sec.Key("Journald").Int()
+			if err != nil {
+				return nil, fmt.Errorf("Log Journald err:%s", err)
+			}
+			data.log.Journald = journald == 1
+		}
+		if sec.HasKey("Collector") {
+			data.log.Collector = strings.TrimSpace(sec.Key("Collector").Value())
+		}
+		if sec.HasKey("Redact") {
+			data.log.Redact = make([]string, 0)
+			for _, name := range strings.Split(sec.Key("Redact").Value(), ",") {
+				if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+					continue
+				}
+				if _, ok := logdoo.RedactPatterns[name]; !ok {
+					return nil, fmt.Errorf("Log Redact unknow rule %s", name)
+				}
+				data.log.Redact = append(data.log.Redact, name)
+			}
+		}
+		for _, suffix := range GetKeySuffixes(sec, "RedactPattern") {
+			pattern := sec.Key(fmt.Sprintf("RedactPattern%d", suffix)).Value()
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("Log RedactPattern%d err:%s", suffix, err)
+			}
+			data.log.Redact = append(data.log.Redact, pattern)
+		}
+		if sec.HasKey("RedactKey") {
+			data.log.RedactKeys = strings.Split(sec.Key("RedactKey").Value(), ",")
+		}
+		if sec.HasKey("CollectorSpoolSize") {
+			if data.log.CollectorSpoolSize, err = sec.Key("CollectorSpoolSize").Int64(); err != nil {
+				return nil, fmt.Errorf("Log CollectorSpoolSize err:%s", err)
+			}
+		}
+	}
+
+	if sec, er := cfg.GetSection("Api"); er == nil {
+		if sec.HasKey("Open") {
+			if data.apiOpen, err = sec.Key("Open").Int(); err != nil {
+				return nil, fmt.Errorf("Api Open err:%s", err)
+			}
+		}
+		if sec.HasKey("Addr") {
+			data.apiAddr = sec.Key("Addr").Value()
+		}
+		if sec.HasKey("Token") {
+			data.apiToken = sec.Key("Token").Value()
+		}
+	}
+
+	if data.health, err = ParseHealthCfg(cfg, data.serviceSpecName); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+//Validate 校验配置数据是否完整有效(防止加载到写了一半的配置文件)
+func (data *CfgData) Validate() error {
+	if data.machineName == "" {
+		return fmt.Errorf("Machine Name is empty")
 	}
 
+	if data.emailData.status == EmailOpen {
+		if data.emailData.host == "" {
+			return fmt.Errorf("EmailInfo Host is empty")
+		}
+		if data.emailData.port <= 0 || data.emailData.port > 65535 {
+			return fmt.Errorf("EmailInfo Port %d invalid", data.emailData.port)
+		}
+		if data.emailData.sendU == "" {
+			return fmt.Errorf("EmailInfo SendU is empty")
+		}
+		if len(data.emailData.receiveU) == 0 || data.emailData.receiveU[0] == "" {
+			return fmt.Errorf("EmailInfo ReceiveU is empty")
+		}
+	}
+
+	if data.timer.RefreshInterval <= 0 {
+		return fmt.Errorf("Timer RefreshInterval %s invalid", data.timer.RefreshInterval)
+	}
+	if data.timer.CheckInterval <= 0 {
+		return fmt.Errorf("Timer CheckInterval %s invalid", data.timer.CheckInterval)
+	}
+	if data.timer.RestartWorkers <= 0 {
+		return fmt.Errorf("Timer RestartWorkers %d invalid", data.timer.RestartWorkers)
+	}
+	if data.timer.EmailInterval < 0 {
+		return fmt.Errorf("Timer EmailInterval %s invalid", data.timer.EmailInterval)
+	}
+	if c := data.log.Collector; c != "" && !strings.HasPrefix(c, "http://") && !strings.HasPrefix(c, "https://") && !strings.HasPrefix(c, "tcp://") {
+		return fmt.Errorf("Log Collector %s should be http(s):// or tcp://", c)
+	}
+	if data.log.CollectorSpoolSize <= 0 {
+		return fmt.Errorf("Log CollectorSpoolSize %d invalid", data.log.CollectorSpoolSize)
+	}
+	if data.log.MaxSize <= 0 {
+		return fmt.Errorf("Log MaxSize %d invalid", data.log.MaxSize)
+	}
+	if data.log.AsyncSize <= 0 {
+		return fmt.Errorf("Log AsyncSize %d invalid", data.log.AsyncSize)
+	}
+
+	if data.apiOpen == 1 && data.apiAddr == "" {
+		return fmt.Errorf("Api Addr is empty")
+	}
+
+	if data.remote.Open {
+		if data.remote.Url == "" && data.remote.Path == "" {
+			return fmt.Errorf("Remote Url and Path are both empty")
+		}
+		if data.remote.Interval <= 0 {
+			return fmt.Errorf("Remote Interval %s invalid", data.remote.Interval)
+		}
+	}
+
+	return data.health.Validate()
+}
+
+//DiffCfg 比较新旧两份配置的差异
+func DiffCfg(old, cur *CfgData) *CfgDiff {
+	diff := &CfgDiff{Time: time.Now(),
+		AddedServices:   make([]string, 0),
+		RemovedServices: make([]string, 0),
+		Changed:         make([]string, 0)}
+
+	changed := func(name string, o, n interface{}) {
+		if fmt.Sprint(o) != fmt.Sprint(n) {
+			diff.Changed = append(diff.Changed, fmt.Sprintf("%s: %v -> %v", name, o, n))
+		}
+	}
+
+	changed("Machine.Name", old.machineName, cur.machineName)
+
+	for name, attach := range cur.serviceSpecName {
+		if oldAttach, ok := old.serviceSpecName[name]; !ok {
+			diff.Changed = append(diff.Changed, "SpecInfo add: "+name)
+		} else {
+			changed("SpecInfo."+name+".Attach", oldAttach, attach)
+		}
+	}
+	for name := range old.serviceSpecName {
+		if _, ok := cur.serviceSpecName[name]; !ok {
+			diff.Changed = append(diff.Changed, "SpecInfo remove: "+name)
+		}
+	}
+
+	added, removed := DiffNames(old.servicePartName, cur.servicePartName)
+	for _, name := range added {
+		diff.Changed = append(diff.Changed, "PartInfo add: "+name)
+	}
+	for _, name := range removed {
+		diff.Changed = append(diff.Changed, "PartInfo remove: "+name)
+	}
+
+	changed("EmailInfo.Open", old.emailData.status, cur.emailData.status)
+	changed("EmailInfo.Host", old.emailData.host, cur.emailData.host)
+	changed("EmailInfo.Port", old.emailData.port, cur.emailData.port)
+	changed("EmailInfo.SendU", old.emailData.sendU, cur.emailData.sendU)
+	changed("EmailInfo.ReceiveU", strings.Join(old.emailData.receiveU, ","), strings.Join(cur.emailData.receiveU, ","))
+	if old.emailData.sendP != cur.emailData.sendP {
+		diff.Changed = append(diff.Changed, "EmailInfo.SendP changed") //密码不打印具体的值
+	}
+
+	changed("Timer.RefreshInterval", old.timer.RefreshInterval, cur.timer.RefreshInterval)
+	changed("Timer.CheckInterval", old.timer.CheckInterval, cur.timer.CheckInterval)
+	changed("Timer.RestartWorkers", old.timer.RestartWorkers, cur.timer.RestartWorkers)
+	changed("Timer.EmailInterval", old.timer.EmailInterval, cur.timer.EmailInterval)
+	changed("Log.ConsoleFormat", old.log.ConsoleFormat, cur.log.ConsoleFormat)
+	changed("Log.FileFormat", old.log.FileFormat, cur.log.FileFormat)
+	changed("Log.ConsoleLevel", old.log.ConsoleLevel, cur.log.ConsoleLevel)
+	changed("Log.FileLevel", old.log.FileLevel, cur.log.FileLevel)
+	changed("Log.Retention", old.log.Retention, cur.log.Retention)
+	changed("Log.Async", old.log.Async, cur.log.Async)
+	changed("Log.AsyncSize", old.log.AsyncSize, cur.log.AsyncSize)
+	changed("Log.AsyncPolicy", old.log.AsyncPolicy, cur.log.AsyncPolicy)
+	changed("Log.Syslog", old.log.Syslog, cur.log.Syslog)
+	changed("Log.Journald", old.log.Journald, cur.log.Journald)
+	changed("Log.Redact", old.log.Redact, cur.log.Redact)
+	changed("Log.RedactKey", old.log.RedactKeys, cur.log.RedactKeys)
+	changed("Log.Collector", old.log.Collector, cur.log.Collector)
+	changed("Log.CollectorSpoolSize", old.log.CollectorSpoolSize, cur.log.CollectorSpoolSize)
+	changed("Log.Rotate", old.log.Rotate, cur.log.Rotate)
+	changed("Log.MaxSize", old.log.MaxSize, cur.log.MaxSize)
+	changed("Api.Open", old.apiOpen, cur.apiOpen)
+	changed("Api.Addr", old.apiAddr, cur.apiAddr)
+	if old.apiToken != cur.apiToken {
+		diff.Changed = append(diff.Changed, "Api.Token changed") //Token不打印具体的值
+	}
+	changed("Remote.Open", old.remote.Open, cur.remote.Open)
+	changed("Remote.Url", old.remote.Url, cur.remote.Url)
+	changed("Remote.Path", old.remote.Path, cur.remote.Path)
+	changed("Remote.Interval", old.remote.Interval, cur.remote.Interval)
+	changed("Remote.Cache", old.remote.Cache, cur.remote.Cache)
+	changed("Include.Files", strings.Join(old.cfgFiles, ","), strings.Join(cur.cfgFiles, ","))
+	old.health.Diff(cur.health, changed)
+
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+//DiffNames 比较两个名字列表,返回新增的和移除的名字
+func DiffNames(old, cur []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, name := range old {
+		oldSet[name] = true
+	}
+	curSet := make(map[string]bool, len(cur))
+	for _, name := range cur {
+		curSet[name] = true
+		if !oldSet[name] {
+			added = append(added, name)
+		}
+	}
+	for _, name := range old {
+		if !curSet[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+//String 差异的文本描述,用于打印日记
+func (diff *CfgDiff) String() string {
+	var str string
+	for _, name := range diff.AddedServices {
+		str += "+ service " + name + "\r\n"
+	}
+	for _, name := range diff.RemovedServices {
+		str += "- service " + name + "\r\n"
+	}
+	for _, change := range diff.Changed {
+		str += "* " + change + "\r\n"
+	}
+	if str == "" {
+		return "no change"
+	}
+	return str
+}
+
+//SetLastDiff 记录最近一次重新加载的差异(补充了实际监控服务的增减)
+func (mcfg *MonitorCfg) SetLastDiff(diff *CfgDiff) {
+	mcfg.mu.Lock()
+	mcfg.lastDiff = diff
+	mcfg.mu.Unlock()
+}
+
+//GetLastDiff 获取最近一次重新加载配置的差异
+func (mcfg *MonitorCfg) GetLastDiff() *CfgDiff {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return mcfg.lastDiff
+}
+
+//GetRemoteCfg 获取远程配置源的设置
+func (mcfg *MonitorCfg) GetRemoteCfg() RemoteCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return mcfg.remote
+}
+
+//GetLogCfg 获取日记相关的配置
+func (mcfg *MonitorCfg) GetLogCfg() LogCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return mcfg.log
+}
+
+//GetApiCfg 获取控制API的配置
+func (mcfg *MonitorCfg) GetApiCfg() (open bool, addr, token string) {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return mcfg.apiOpen == 1, mcfg.apiAddr, mcfg.apiToken
+}
+
+//GetIncludeFiles 获取配置文件path以及它通过[Include] FileX引用的所有文件,include的文件排在前面;
+//同一个文件被多个文件引用(菱形引用)时只加载一次,引用链中出现自己时返回错误
+func GetIncludeFiles(path string) ([]string, error) {
+	files := make([]string, 0)
+	if err := collectIncludeFiles(path, make(map[string]bool), make(map[string]bool), &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+//collectIncludeFiles 深度优先收集引用的文件,stack为当前的引用链(返回时移除),seen为已经收集的文件
+func collectIncludeFiles(path string, stack, seen map[string]bool, files *[]string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if stack[abs] {
+		return fmt.Errorf("config include loop at %s", path)
+	}
+	if seen[abs] {
+		return nil
+	}
+	stack[abs] = true
+	defer delete(stack, abs)
+
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if sec, er := cfg.GetSection("Include"); er == nil {
+		for _, suffix := range GetKeySuffixes(sec, "File") {
+			include := ExpandEnv(sec.Key("File" + strconv.Itoa(suffix)).Value())
+			if include == "" {
+				continue
+			}
+
+			//相对路径是相对于当前配置文件所在目录
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(path), include)
+			}
+
+			if err := collectIncludeFiles(include, stack, seen, files); err != nil {
+				return err
+			}
+		}
+	}
+
+	seen[abs] = true
+	*files = append(*files, path)
 	return nil
 }
 
+//ParseDuration 解析时间配置,支持300s、10ms、5m这种格式,纯数字表示秒
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.Atoi(value); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+//GetKeySuffixes 获取section中以prefix开头的key的数字后缀(按数字从小到大)
+func GetKeySuffixes(sec *ini.Section, prefix string) []int {
+	suffixes := make([]int, 0)
+	for _, key := range sec.Keys() {
+		if !strings.HasPrefix(key.Name(), prefix) {
+			continue
+		}
+		suffix, err := strconv.Atoi(strings.TrimPrefix(key.Name(), prefix))
+		if err != nil {
+			continue
+		}
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Ints(suffixes)
+	return suffixes
+}
+
+//ExpandEnv 替换字符串中的${ENV}为对应的环境变量值,没有设置的环境变量保持原样
+func ExpandEnv(value string) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+
+	return envRefRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envRefRegexp.FindStringSubmatch(ref)[1]
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		return ref
+	})
+}
+
+//ExpandEnvCfg 替换所有配置值中的${ENV}
+func ExpandEnvCfg(cfg *ini.File) {
+	for _, sec := range cfg.Sections() {
+		for _, key := range sec.Keys() {
+			if v := key.Value(); strings.Contains(v, "${") {
+				key.SetValue(ExpandEnv(v))
+			}
+		}
+	}
+}
+
+//GetCfgFiles 获取当前配置用到的所有文件
+func (mcfg *MonitorCfg) GetCfgFiles() []string {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	files := make([]string, len(mcfg.cfgFiles))
+	copy(files, mcfg.cfgFiles)
+	return files
+}
+
 //GetSpecServices 获取具体的监控服务名列表
 func (mcfg *MonitorCfg) GetSpecServices() []string {
 	mcfg.mu.RLock()
@@ -157,11 +821,11 @@ func (mcfg *MonitorCfg) GetMachineName() (name string) {
 	return name
 }
 
-//GetRefreshCfgTime 获取刷新时间
-func (mcfg *MonitorCfg) GetRefreshTime() int {
-	mcfg.mu.Lock()
-	t := mcfg.refreshTime
-	mcfg.mu.Unlock()
+//GetTimerCfg 获取定时相关的配置
+func (mcfg *MonitorCfg) GetTimerCfg() TimerCfg {
+	mcfg.mu.RLock()
+	t := mcfg.timer
+	mcfg.mu.RUnlock()
 	return t
 }
 
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//writeCfgFiles 在临时目录写入配置文件,返回目录
+func writeCfgFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetIncludeFiles(t *testing.T) {
+	os.Setenv("GOMONITOR_TEST_CFG_DIR", "common")
+	defer os.Unsetenv("GOMONITOR_TEST_CFG_DIR")
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string //相对目录的文件,为nil时要求返回错误
+		err   string
+	}{
+		{"no include", map[string]string{"a.ini": "[Machine]\nName=A\n"}, []string{"a.ini"}, ""},
+		{"nested", map[string]string{
+			"a.ini": "[Include]\nFile1=b.ini\n",
+			"b.ini": "[Include]\nFile1=c.ini\n",
+			"c.ini": "",
+		}, []string{"c.ini", "b.ini", "a.ini"}, ""},
+		{"order by suffix", map[string]string{
+			"a.ini": "[Include]\nFile2=c.ini\nFile1=b.ini\n",
+			"b.ini": "", "c.ini": "",
+		}, []string{"b.ini", "c.ini", "a.ini"}, ""},
+		{"diamond", map[string]string{
+			"a.ini": "[Include]\nFile1=b.ini\nFile2=c.ini\n",
+			"b.ini": "[Include]\nFile1=d.ini\n",
+			"c.ini": "[Include]\nFile1=d.ini\n",
+			"d.ini": "",
+		}, []string{"d.ini", "b.ini", "c.ini", "a.ini"}, ""},
+		{"relative to including file", map[string]string{
+			"a.ini":     "[Include]\nFile1=sub/b.ini\n",
+			"sub/b.ini": "[Include]\nFile1=c.ini\n",
+			"sub/c.ini": "",
+		}, []string{"sub/c.ini", "sub/b.ini", "a.ini"}, ""},
+		{"env in path", map[string]string{
+			"a.ini":        "[Include]\nFile1=${GOMONITOR_TEST_CFG_DIR}/b.ini\n",
+			"common/b.ini": "",
+		}, []string{"common/b.ini", "a.ini"}, ""},
+		{"loop", map[string]string{
+			"a.ini": "[Include]\nFile1=b.ini\n",
+			"b.ini": "[Include]\nFile1=c.ini\n",
+			"c.ini": "[Include]\nFile1=a.ini\n",
+		}, nil, "include loop"},
+		{"self", map[string]string{"a.ini": "[Include]\nFile1=a.ini\n"}, nil, "include loop"},
+		{"missing file", map[string]string{"a.ini": "[Include]\nFile1=none.ini\n"}, nil, "none.ini"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeCfgFiles(t, tt.files)
+			files, err := GetIncludeFiles(filepath.Join(dir, "a.ini"))
+			if tt.want == nil {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("files %v err %v, want %s", files, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(files))
+			for _, f := range files {
+				rel, _ := filepath.Rel(dir, f)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("files %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncludeOverride(t *testing.T) {
+	dir := writeCfgFiles(t, map[string]string{
+		"a.ini": "[Include]\nFile1=b.ini\nFile2=c.ini\n[Machine]\nName=A\n",
+		"b.ini": "[Include]\nFile1=d.ini\n[Timer]\nRestartWorkers=2\n",
+		"c.ini": "[Include]\nFile1=d.ini\n[Machine]\nName=C\n",
+		"d.ini": "[Machine]\nName=D\n[Timer]\nRestartWorkers=1\nCheckInterval=5s\n",
+	})
+	data, err := ParseCfg(filepath.Join(dir, "a.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//当前文件覆盖引用的文件,后引用的覆盖先引用的
+	if data.machineName != "A" || data.timer.RestartWorkers != 2 || data.timer.CheckInterval.Seconds() != 5 {
+		t.Errorf("machine %s workers %d check %s", data.machineName, data.timer.RestartWorkers, data.timer.CheckInterval)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("GOMONITOR_TEST_HOST", "smtp.example.com")
+	defer os.Unsetenv("GOMONITOR_TEST_HOST")
+	os.Unsetenv("GOMONITOR_TEST_UNDEFINED")
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"${GOMONITOR_TEST_HOST}", "smtp.example.com"},
+		{"smtp://${GOMONITOR_TEST_HOST}:25", "smtp://smtp.example.com:25"},
+		{"${GOMONITOR_TEST_HOST}/${GOMONITOR_TEST_HOST}", "smtp.example.com/smtp.example.com"},
+		{"${GOMONITOR_TEST_UNDEFINED}", "${GOMONITOR_TEST_UNDEFINED}"},
+		{"${GOMONITOR_TEST_HOST}:${GOMONITOR_TEST_UNDEFINED}", "smtp.example.com:${GOMONITOR_TEST_UNDEFINED}"},
+		{"$GOMONITOR_TEST_HOST", "$GOMONITOR_TEST_HOST"},
+		{"${unclosed", "${unclosed"},
+	}
+	for _, tt := range tests {
+		if got := ExpandEnv(tt.value); got != tt.want {
+			t.Errorf("ExpandEnv(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExpandEnvCfg(t *testing.T) {
+	os.Setenv("GOMONITOR_TEST_MACHINE", "TradeEnv")
+	defer os.Unsetenv("GOMONITOR_TEST_MACHINE")
+	os.Unsetenv("GOMONITOR_TEST_UNDEFINED")
+
+	dir := writeCfgFiles(t, map[string]string{
+		"a.ini": "[Machine]\nName=${GOMONITOR_TEST_MACHINE}\n[SpecInfo]\nName1=Doo\nAttach1=${GOMONITOR_TEST_UNDEFINED}\\log\n",
+	})
+	data, err := ParseCfg(filepath.Join(dir, "a.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.machineName != "TradeEnv" {
+		t.Errorf("machine %s", data.machineName)
+	}
+	if attach := data.serviceSpecName["Doo"]; attach != "${GOMONITOR_TEST_UNDEFINED}\\log" {
+		t.Errorf("attach %s, undefined env should be kept", attach)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"300", 300 * time.Second, false},
+		{" 30 ", 30 * time.Second, false},
+		{"0", 0, false},
+		{"10ms", 10 * time.Millisecond, false},
+		{"5m", 5 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"1.5", 0, true},
+		{"5x", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.value)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %s, %v, want %s err %v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTimerCfg(t *testing.T) {
+	def := NewCfgData().timer
+	tests := []struct {
+		name  string
+		timer string
+		want  TimerCfg
+		err   string
+	}{
+		{"default", "", def, ""},
+		{"new names", "RefreshInterval=5m\nCheckInterval=2s\nRestartWorkers=3\nEmailInterval=10m\n",
+			TimerCfg{5 * time.Minute, 2 * time.Second, 3, 10 * time.Minute}, ""},
+		{"old name Refresh", "Refresh=120\n",
+			TimerCfg{120 * time.Second, def.CheckInterval, def.RestartWorkers, 0}, ""},
+		{"old name RefreshCfg", "RefreshCfg=1m\n",
+			TimerCfg{time.Minute, def.CheckInterval, def.RestartWorkers, 0}, ""},
+		{"new name wins", "Refresh=10\nRefreshCfg=20\nRefreshInterval=30\n",
+			TimerCfg{30 * time.Second, def.CheckInterval, def.RestartWorkers, 0}, ""},
+		{"seconds", "CheckInterval=1\nEmailInterval=600\n",
+			TimerCfg{def.RefreshInterval, time.Second, def.RestartWorkers, 10 * time.Minute}, ""},
+		{"bad duration", "CheckInterval=fast\n", TimerCfg{}, "Timer CheckInterval"},
+		{"bad refresh", "Refresh=1.5\n", TimerCfg{}, "Timer Refresh"},
+		{"bad workers", "RestartWorkers=two\n", TimerCfg{}, "Timer RestartWorkers"},
+		{"zero check", "CheckInterval=0\n", TimerCfg{}, "CheckInterval 0s invalid"},
+		{"zero workers", "RestartWorkers=0\n", TimerCfg{}, "RestartWorkers 0 invalid"},
+		{"negative email", "EmailInterval=-1s\n", TimerCfg{}, "EmailInterval -1s invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeCfgFiles(t, map[string]string{"a.ini": "[Machine]\nName=A\n[Timer]\n" + tt.timer})
+			mc := NewMonitorCfg()
+			_, err := mc.LoadCfg(filepath.Join(dir, "a.ini"))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("err %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mc.GetTimerCfg(); got != tt.want {
+				t.Errorf("timer %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimerCfgReload(t *testing.T) {
+	dir := writeCfgFiles(t, map[string]string{"a.ini": "[Machine]\nName=A\n[Timer]\nCheckInterval=1s\nRestartWorkers=2\n"})
+	path := filepath.Join(dir, "a.ini")
+	mc := NewMonitorCfg()
+	if _, err := mc.LoadCfg(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(path, []byte("[Machine]\nName=A\n[Timer]\nCheckInterval=3s\nRestartWorkers=4\nEmailInterval=1m\n"), 0600)
+	diff, err := mc.LoadCfg(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Timer.CheckInterval: 1s -> 3s", "Timer.RestartWorkers: 2 -> 4", "Timer.EmailInterval: 0s -> 1m0s"}
+	if strings.Join(diff.Changed, ",") != strings.Join(want, ",") {
+		t.Errorf("changed %v, want %v", diff.Changed, want)
+	}
+
+	//校验失败时保留之前的配置
+	ioutil.WriteFile(path, []byte("[Machine]\nName=A\n[Timer]\nCheckInterval=0\n"), 0600)
+	if _, err := mc.LoadCfg(path); err == nil {
+		t.Error("invalid timer should fail")
+	}
+	if timer := mc.GetTimerCfg(); timer.CheckInterval != 3*time.Second || timer.RestartWorkers != 4 {
+		t.Errorf("timer %+v, want the previous one", timer)
+	}
+}
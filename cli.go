@@ -0,0 +1,115 @@
+package main
+
+import (
+	"GoMonitor/probe"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+//RunToolCmd 处理不涉及服务操作的命令行工具,返回false表示不是工具命令
+func RunToolCmd(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "encrypt":
+		EncryptCmd(args[1:])
+		return true
+	case "check":
+		CheckCmd(args[1:])
+		return true
+	}
+
+	return false
+}
+
+//EncryptCmd 加密保存敏感配置值: encrypt <name> [value],不带value时从标准输入读取(避免留在命令行历史中)
+func EncryptCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Println("usage: encrypt <name> [value]")
+		return
+	}
+
+	name := args[0]
+	var value string
+	if len(args) > 1 {
+		value = args[1]
+	} else {
+		fmt.Print("value: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println("read value err:", err)
+			return
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+
+	dir := GetCfgDir()
+	if !PathExists(dir) {
+		os.MkdirAll(dir, os.ModePerm)
+	}
+
+	if err := SaveStoreSecret(dir, name, value); err != nil {
+		fmt.Println("encrypt err:", err)
+		return
+	}
+
+	fmt.Printf("secret %s saved to %s\\%s\r\n", name, dir, SecretStoreFile)
+	fmt.Printf("use it in config.ini like: SendP=%s%s\r\n", SecretStorePrefix, name)
+}
+
+//CheckCmd 按配置运行一次service的健康检查并输出结果,用于调试检查的配置: check <service> [检查名如ScriptCheck1]
+func CheckCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Println("usage: check <service> [name]")
+		return
+	}
+
+	cfgPath, err := GetCfgPath()
+	if err != nil {
+		fmt.Println("get config path err:", err)
+		return
+	}
+	mc := NewMonitorCfg()
+	if _, err := mc.LoadCfg(cfgPath); err != nil {
+		fmt.Println("load config err:", err)
+		return
+	}
+	probe.SetScriptConcurrency(mc.GetScriptConcurrency())
+
+	var count int
+	for _, check := range mc.GetHealthChecks() {
+		if !strings.EqualFold(check.Service, args[0]) || (len(args) > 1 && !strings.EqualFold(check.Name, args[1])) {
+			continue
+		}
+		count++
+
+		begin := time.Now()
+		output, err := RunCheck(check)
+		if c, ok := check.Checker.(io.Closer); ok {
+			c.Close()
+		}
+		state := "OK"
+		if w, ok := err.(*CheckWarning); ok {
+			state, err = "WARNING", w
+		} else if err != nil {
+			state = "FAIL"
+		}
+		fmt.Printf("[%s] %s (%s) %s\r\n", state, check.Name, check.Checker.Kind(), time.Since(begin).Round(time.Millisecond))
+		if err != nil {
+			fmt.Printf("  error: %s\r\n", err)
+		}
+		if output != "" {
+			fmt.Printf("  output: %s\r\n", strings.Replace(output, "\n", "\n  ", -1))
+		}
+	}
+
+	if count == 0 {
+		fmt.Printf("no health check for service %s in %s\r\n", args[0], cfgPath)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//DependRestartReason 依赖的service恢复后重启service时通知的标题
+const DependRestartReason = "dependency recovered and restart!"
+
+//DependCfg [Depend]一条依赖规则:Service依赖On中的所有service
+type DependCfg struct {
+	Name         string
+	Service      string   //依赖其他service的service,以*结尾表示前缀匹配(如Doo_*)
+	On           []string //被依赖的service
+	RestartAfter bool     //被依赖的service重启恢复后也重启Service
+}
+
+//Match 规则是否适用于service
+func (d DependCfg) Match(name string) bool {
+	if strings.HasSuffix(d.Service, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(d.Service, "*"))
+	}
+	return d.Service == name
+}
+
+//DependGraph service之间的依赖关系
+type DependGraph struct {
+	rules   []DependCfg
+	FromScm bool //同时使用Windows服务管理器中配置的依赖
+}
+
+//NewDependGraph New一个依赖关系
+func NewDependGraph(rules []DependCfg, fromScm bool) *DependGraph {
+	return &DependGraph{rules: rules, FromScm: fromScm}
+}
+
+//Deps service直接依赖的service(不包括自己,所以Doo_*依赖Doo_DB时Doo_DB不依赖自己)
+func (g *DependGraph) Deps(name string) []string {
+	if g == nil {
+		return nil
+	}
+	var deps []string
+	seen := make(map[string]bool)
+	for _, r := range g.rules {
+		if !r.Match(name) {
+			continue
+		}
+		for _, on := range r.On {
+			if on != name && !seen[on] {
+				seen[on] = true
+				deps = append(deps, on)
+			}
+		}
+	}
+	return deps
+}
+
+//RestartAfter dep重启恢复后是否需要重启name
+func (g *DependGraph) RestartAfter(name, dep string) bool {
+	if g == nil {
+		return false
+	}
+	for _, r := range g.rules {
+		if r.RestartAfter && r.Match(name) {
+			for _, on := range r.On {
+				if on == dep {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+//Depth service在依赖链中的深度(没有依赖为0),deps为取直接依赖的函数,按深度排序可以保证被依赖的先启动
+func Depth(name string, deps func(string) []string) int {
+	return depth(name, deps, make(map[string]bool))
+}
+
+func depth(name string, deps func(string) []string, visiting map[string]bool) int {
+	if visiting[name] {
+		//有环的时候不再深入(加载配置时已经检查过,这里只防止SCM中的依赖出现环)
+		return 0
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	max := 0
+	for _, d := range deps(name) {
+		if n := depth(d, deps, visiting) + 1; n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+//SortByDepend 按依赖的深度排序,被依赖的在前面
+func SortByDepend(names []string, deps func(string) []string) {
+	depths := make(map[string]int, len(names))
+	for _, name := range names {
+		depths[name] = Depth(name, deps)
+	}
+	sort.SliceStable(names, func(i, j int) bool { return depths[names[i]] < depths[names[j]] })
+}
+
+//CheckDependCycle 检查依赖规则中是否有环(包括明确写出的依赖自己),有环时返回环的路径
+func CheckDependCycle(rules []DependCfg) error {
+	//Deps不包括自己,前缀规则匹配到被依赖的service时是允许的,明确写出的依赖自己在这里检查
+	for _, r := range rules {
+		for _, on := range r.On {
+			if on == r.Service {
+				return fmt.Errorf("dependency cycle: %s -> %s", on, on)
+			}
+		}
+	}
+
+	g := NewDependGraph(rules, false)
+
+	//规则中明确写出的service都作为起点,前缀规则通过被依赖的service匹配到
+	var nodes []string
+	for _, r := range rules {
+		if !strings.HasSuffix(r.Service, "*") {
+			nodes = append(nodes, r.Service)
+		}
+		nodes = append(nodes, r.On...)
+	}
+
+	const (
+		white = iota
+		gray
+		black
+	)
+	color := make(map[string]int)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		color[name] = gray
+		path = append(path, name)
+		for _, dep := range g.Deps(name) {
+			switch color[dep] {
+			case gray:
+				i := 0
+				for path[i] != dep {
+					i++
+				}
+				return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path[i:], " -> "), dep)
+			case white:
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		color[name] = black
+		return nil
+	}
+
+	for _, name := range nodes {
+		if color[name] == white {
+			if err := visit(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
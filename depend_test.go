@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDependCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []DependCfg
+		err   string //为空时没有环
+	}{
+		{"chain", []DependCfg{{Service: "Web", On: []string{"App"}}, {Service: "App", On: []string{"DB"}}}, ""},
+		{"cycle", []DependCfg{{Service: "A", On: []string{"B"}}, {Service: "B", On: []string{"C"}}, {Service: "C", On: []string{"A"}}},
+			"A -> B -> C -> A"},
+		{"self", []DependCfg{{Service: "A", On: []string{"A"}}}, "A -> A"},
+		{"prefix includes dep", []DependCfg{{Service: "Doo_*", On: []string{"Doo_DB"}}}, ""},
+		{"prefix cycle", []DependCfg{{Service: "Doo_*", On: []string{"Doo_DB"}}, {Service: "Doo_DB", On: []string{"Doo_Cache"}}},
+			"Doo_DB -> Doo_Cache -> Doo_DB"},
+		{"missing dependency", []DependCfg{{Service: "Web", On: []string{"NotMonitored"}}}, ""},
+		{"diamond", []DependCfg{{Service: "Web", On: []string{"App", "Api"}}, {Service: "App", On: []string{"DB"}}, {Service: "Api", On: []string{"DB"}}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckDependCycle(tt.rules)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("err %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err %v, want cycle %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSortByDepend(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []DependCfg
+		names []string
+		want  []string
+	}{
+		{"chain", []DependCfg{{Service: "Web", On: []string{"App"}}, {Service: "App", On: []string{"DB"}}},
+			[]string{"Web", "App", "DB"}, []string{"DB", "App", "Web"}},
+		{"diamond", []DependCfg{{Service: "Web", On: []string{"App", "Api"}}, {Service: "App", On: []string{"DB"}}, {Service: "Api", On: []string{"DB"}}},
+			[]string{"Web", "Api", "DB", "App"}, []string{"DB", "Api", "App", "Web"}},
+		{"missing dependency", []DependCfg{{Service: "Web", On: []string{"NotMonitored"}}},
+			[]string{"Web", "Other"}, []string{"Other", "Web"}},
+		{"prefix", []DependCfg{{Service: "Doo_*", On: []string{"Doo_DB"}}},
+			[]string{"Doo_A", "Doo_DB", "Doo_B"}, []string{"Doo_DB", "Doo_A", "Doo_B"}},
+		//环在加载配置时已经检查,这里只要求不死循环
+		{"cycle", []DependCfg{{Service: "A", On: []string{"B"}}, {Service: "B", On: []string{"A"}}},
+			[]string{"A", "B"}, []string{"A", "B"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewDependGraph(tt.rules, false)
+			names := append([]string(nil), tt.names...)
+			SortByDepend(names, g.Deps)
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("sorted %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependDeps(t *testing.T) {
+	g := NewDependGraph([]DependCfg{
+		{Service: "Doo_*", On: []string{"Doo_DB", "Redis"}},
+		{Service: "Doo_Web", On: []string{"Redis", "Doo_Api"}, RestartAfter: true},
+	}, false)
+
+	if deps := g.Deps("Doo_Web"); strings.Join(deps, ",") != "Doo_DB,Redis,Doo_Api" {
+		t.Errorf("Doo_Web deps %v", deps)
+	}
+	if deps := g.Deps("Doo_DB"); strings.Join(deps, ",") != "Redis" {
+		t.Errorf("Doo_DB deps %v, should not depend on itself", deps)
+	}
+	if !g.RestartAfter("Doo_Web", "Doo_Api") || g.RestartAfter("Doo_Web", "Doo_DB") || g.RestartAfter("Doo_Api", "Redis") {
+		t.Error("RestartAfter only for the rule with RestartAfter")
+	}
+	var nilGraph *DependGraph
+	if nilGraph.Deps("Doo_Web") != nil || nilGraph.RestartAfter("Doo_Web", "Redis") {
+		t.Error("nil graph has no dependency")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"GoMonitor/logdoo"
+	"strings"
 	"sync"
 
 	"gopkg.in/gomail.v2"
@@ -17,7 +18,7 @@ type EmailData struct {
 	host     string
 	port     int
 	sendU    string
-	sendP    string
+	sendP    string //密码或者密码的引用(env:/file:/secret:),发送时才解析出明文
 	receiveU []string
 }
 
@@ -48,8 +49,8 @@ func (e *Email) UpdateEmail(ed *EmailData) {
 	e.mu.Unlock()
 }
 
-//SendEmailEx 发送邮件并且附带附件
-func (e *Email) SendEmailEx(subject, content, attach string) {
+//SendEmailEx 发送邮件并且附带附件,log为调用方的子日记(可以为nil)
+func (e *Email) SendEmailEx(log *logdoo.Context, subject, content, attach string) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -64,17 +65,24 @@ func (e *Email) SendEmailEx(subject, content, attach string) {
 	m.SetBody("text/html", content)
 	m.Attach(attach)
 
-	d := gomail.NewDialer(e.host, e.port, e.sendU, e.sendP)
+	pass, err := ResolveSecret(e.sendP)
+	if err != nil {
+		log.Error("send eamilEx resolve SendP fail", logdoo.Err(err))
+		return
+	}
+	logdoo.AddRedactSecret(pass)
+	d := gomail.NewDialer(e.host, e.port, e.sendU, pass)
 
+	log = log.With("from", e.sendU, "to", strings.Join(e.receiveU, ","), "subject", subject, "content", content, "attach", attach)
 	if err := d.DialAndSend(m); err != nil {
-		logdoo.InfoDoo("send eamilEx ex fail ==>> From:", e.sendU, "To:", e.receiveU, "subject:", subject, "content:", content, "attach:", attach)
+		log.Info("send eamilEx fail", logdoo.String("error", MaskSecret(err.Error(), pass)))
 	} else {
-		logdoo.InfoDoo("send eamilEx ex success ==>> From:", e.sendU, "To:", e.receiveU, "subject:", subject, "content:", content, "attach:", attach)
+		log.Info("send eamilEx success")
 	}
 }
 
-//SendEmail 发送邮件
-func (e *Email) SendEmail(subject, content string) {
+//SendEmail 发送邮件,log为调用方的子日记(可以为nil)
+func (e *Email) SendEmail(log *logdoo.Context, subject, content string) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -88,11 +96,18 @@ func (e *Email) SendEmail(subject, content string) {
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", content)
 
-	d := gomail.NewDialer(e.host, e.port, e.sendU, e.sendP)
+	pass, err := ResolveSecret(e.sendP)
+	if err != nil {
+		log.Error("send eamil resolve SendP fail", logdoo.Err(err))
+		return
+	}
+	logdoo.AddRedactSecret(pass)
+	d := gomail.NewDialer(e.host, e.port, e.sendU, pass)
 
+	log = log.With("from", e.sendU, "to", strings.Join(e.receiveU, ","), "subject", subject, "content", content)
 	if err := d.DialAndSend(m); err != nil {
-		logdoo.InfoDoo("send eamil ex fail ==>> From:", e.sendU, "To:", e.receiveU, "subject:", subject, "content:", content)
+		log.Info("send eamil fail", logdoo.String("error", MaskSecret(err.Error(), pass)))
 	} else {
-		logdoo.InfoDoo("send eamil ex success ==>> From:", e.sendU, "To:", e.receiveU, "subject:", subject, "content:", content)
+		log.Info("send eamil success")
 	}
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+//UnhealthyReason 健康检查失败重启service时通知的标题
+const UnhealthyReason = "is unhealthy and restart!"
+
+//Checker 一项健康检查,返回检查的输出(用于日记和通知)以及失败的原因
+type Checker interface {
+	Kind() string
+	Check(ctx context.Context) (output string, err error)
+}
+
+//CheckCfg 各种健康检查共用的配置
+type CheckCfg struct {
+	Name      string        //配置中的名字,如HttpProbe1
+	Service   string        //检查的service
+	Timeout   time.Duration //单次检查的超时时间
+	Interval  time.Duration //检查的间隔
+	Threshold int           //连续失败多少次认为不健康
+}
+
+//HealthCheck 一个service的一项健康检查
+type HealthCheck struct {
+	Key string //配置的签名,配置修改后Key不同会重新创建检查
+	CheckCfg
+	Checker Checker
+}
+
+//Restarter 健康检查的结果更新到service的状态,失败时请求重启service
+type Restarter interface {
+	SetHealthy(name string, healthy bool)
+	RequestRestart(name, reason, detail string, stopFirst bool) bool
+}
+
+//CheckStatus 一项健康检查的当前状态
+type CheckStatus struct {
+	Name      string    `json:"name"`
+	Service   string    `json:"service"`
+	Kind      string    `json:"kind"`
+	Healthy   bool      `json:"healthy"`
+	Failures  int       `json:"failures"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+	Warning   string    `json:"warning,omitempty"`
+	Output    string    `json:"output,omitempty"`
+}
+
+//HealthMonitor 管理所有的健康检查,每项检查一个协程
+type HealthMonitor struct {
+	runners map[string]*checkRunner
+	mu      sync.Mutex
+}
+
+type checkRunner struct {
+	check     HealthCheck
+	restarter Restarter
+	status    CheckStatus
+	stop      chan struct{}
+	done      chan struct{}
+	mu        sync.Mutex
+}
+
+//NewHealthMonitor New一个健康检查管理
+func NewHealthMonitor() *HealthMonitor {
+	return &HealthMonitor{runners: make(map[string]*checkRunner)}
+}
+
+//Update 按新的配置更新健康检查,配置没有变化的检查保持原来的状态继续运行
+func (hm *HealthMonitor) Update(checks []HealthCheck, r Restarter) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	keep := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		keep[check.Key] = true
+		if _, ok := hm.runners[check.Key]; ok {
+			continue
+		}
+		runner := newCheckRunner(check, r)
+		hm.runners[check.Key] = runner
+		go runner.run()
+		logdoo.Info("health check start", logdoo.String("name", check.Name), logdoo.String("service", check.Service), logdoo.String("kind", check.Checker.Kind()))
+	}
+
+	for key, runner := range hm.runners {
+		if !keep[key] {
+			runner.Stop()
+			delete(hm.runners, key)
+			logdoo.Info("health check stop", logdoo.String("name", runner.check.Name), logdoo.String("service", runner.check.Service))
+		}
+	}
+}
+
+//Close 停止所有的健康检查
+func (hm *HealthMonitor) Close() {
+	hm.Update(nil, nil)
+}
+
+//Status 所有健康检查的当前状态(按名字排序)
+func (hm *HealthMonitor) Status() []CheckStatus {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	status := make([]CheckStatus, 0, len(hm.runners))
+	for _, runner := range hm.runners {
+		status = append(status, runner.Status())
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+//WaitHealthy 直接运行service的所有健康检查,直到全部通过或者超时,没有健康检查时返回ErrNoHealthCheck
+func (hm *HealthMonitor) WaitHealthy(service string, timeout time.Duration) error {
+	hm.mu.Lock()
+	var checks []HealthCheck
+	for _, runner := range hm.runners {
+		if runner.check.Service == service {
+			checks = append(checks, runner.check)
+		}
+	}
+	hm.mu.Unlock()
+
+	if len(checks) == 0 {
+		return ErrNoHealthCheck
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var err error
+		for _, check := range checks {
+			if _, er := RunCheck(check); er != nil {
+				if _, ok := er.(*CheckWarning); !ok {
+					err = fmt.Errorf("%s: %s", check.Name, er)
+					break
+				}
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(RecoveryPollInterval).After(deadline) {
+			return fmt.Errorf("wait healthy timeout %s, last error %s", timeout, err)
+		}
+		time.Sleep(RecoveryPollInterval)
+	}
+}
+
+func newCheckRunner(check HealthCheck, r Restarter) *checkRunner {
+	return &checkRunner{
+		check:     check,
+		restarter: r,
+		status:    CheckStatus{Name: check.Name, Service: check.Service, Kind: check.Checker.Kind(), Healthy: true},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+//Status 检查的当前状态
+func (cr *checkRunner) Status() CheckStatus {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.status
+}
+
+//Stop 停止检查的协程
+func (cr *checkRunner) Stop() {
+	close(cr.stop)
+	<-cr.done
+}
+
+func (cr *checkRunner) run() {
+	defer close(cr.done)
+	//有的检查持有资源(如fsnotify),停止时释放
+	if c, ok := cr.check.Checker.(io.Closer); ok {
+		defer c.Close()
+	}
+	timer := time.NewTimer(cr.check.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-cr.stop:
+			return
+		case <-timer.C:
+		}
+
+		cr.checkOnce()
+		timer.Reset(cr.check.Interval)
+	}
+}
+
+//checkOnce 执行一次检查,连续失败达到阈值时标记为不健康并请求先停止再启动service
+func (cr *checkRunner) checkOnce() {
+	log := logdoo.With("service", cr.check.Service, "check", cr.check.Name)
+	output, err := RunCheck(cr.check)
+
+	//警告只记日记,不算失败
+	var warning string
+	if w, ok := err.(*CheckWarning); ok {
+		warning, err = w.Msg, nil
+		log.Warn("health check warning", logdoo.String("warning", warning), logdoo.String("output", output))
+	}
+
+	cr.mu.Lock()
+	st := &cr.status
+	st.LastCheck = time.Now()
+	st.Output = output
+	st.Warning = warning
+	if err == nil {
+		recovered := !st.Healthy
+		st.Healthy, st.Failures, st.LastError = true, 0, ""
+		cr.mu.Unlock()
+
+		if recovered {
+			log.Info("service healthy again", logdoo.String("output", output))
+			if cr.restarter != nil {
+				cr.restarter.SetHealthy(cr.check.Service, true)
+			}
+		}
+		return
+	}
+
+	st.Failures++
+	st.LastError = err.Error()
+	failures := st.Failures
+	unhealthy := failures >= cr.check.Threshold
+	if unhealthy {
+		//请求重启后重新计数,重启后依然失败的要再连续失败Threshold次才会再次重启
+		st.Healthy, st.Failures = false, 0
+	}
+	cr.mu.Unlock()
+
+	log.Warn("health check fail", logdoo.Int("failures", failures), logdoo.Int("threshold", cr.check.Threshold), logdoo.Err(err))
+	if !unhealthy || cr.restarter == nil {
+		return
+	}
+
+	detail := fmt.Sprintf("%s check %s fail %d times: %s", cr.check.Checker.Kind(), cr.check.Name, failures, err)
+	if output != "" {
+		detail += "\n" + output
+	}
+	log.Error("service unhealthy, request restart", logdoo.String("detail", detail))
+	cr.restarter.SetHealthy(cr.check.Service, false)
+	if !cr.restarter.RequestRestart(cr.check.Service, UnhealthyReason, detail, true) {
+		log.Warn("service is not monitored or is restarting, skip restart")
+	}
+}
+
+//RunCheck 带超时执行一次检查
+func RunCheck(check HealthCheck) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), check.Timeout)
+	defer cancel()
+
+	output, err := check.Checker.Check(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return output, err
+}
+
+//RegisterHealthApi 注册健康检查相关的接口
+func RegisterHealthApi(api *ControlApi, hm *HealthMonitor) {
+	//GET /health 所有健康检查的当前状态
+	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, hm.Status())
+	})
+}
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"GoMonitor/probe"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+//默认的健康检查配置
+const (
+	DefaultCheckTimeout   = 5 * time.Second
+	DefaultCheckInterval  = 30 * time.Second
+	DefaultCheckThreshold = 3
+
+	DefaultLogWatchContext  = 5
+	DefaultLogWatchCooldown = 5 * time.Minute
+	MaxLogWatchContext      = 100
+
+	DefaultResourceInterval = 10 * time.Second
+	DefaultResourceDuration = time.Minute
+)
+
+//HealthCfg 各种健康检查的配置
+type HealthCfg struct {
+	HttpProbes []HttpProbeCfg
+	TcpChecks  []NetCheckCfg
+	UdpChecks  []NetCheckCfg
+
+	ScriptChecks      []ScriptCheckCfg
+	ScriptConcurrency int //同时运行的检查脚本数
+
+	StaleChecks []StaleCheckCfg
+	LogWatches  []LogWatchCfg
+	Resources   []ResourceCfg
+	Host        HostCfg
+
+	Depends       []DependCfg
+	DependFromScm bool //同时使用服务管理器中配置的依赖
+
+	Recoveries []RecoveryCfg
+	Hooks      []HookCfg
+}
+
+//HttpProbeCfg [HttpProbe]一个service的HTTP探测配置
+type HttpProbeCfg struct {
+	CheckCfg
+	probe.HttpCfg
+}
+
+//NetCheckCfg [TcpCheck]/[UdpCheck]一个service的端口检查配置
+type NetCheckCfg struct {
+	CheckCfg
+	probe.NetCfg
+}
+
+//ParseCheckCfg 解析一项检查共用的配置:ServiceN TimeoutN IntervalN ThresholdN
+func ParseCheckCfg(sec *ini.Section, suffix int) (CheckCfg, error) {
+	c := CheckCfg{Name: fmt.Sprintf("%s%d", sec.Name(), suffix), Timeout: DefaultCheckTimeout, Interval: DefaultCheckInterval, Threshold: DefaultCheckThreshold}
+	key := func(name string) string { return fmt.Sprintf("%s%d", name, suffix) }
+
+	c.Service = strings.TrimSpace(sec.Key(key("Service")).Value())
+	if c.Service == "" {
+		return c, fmt.Errorf("%s %s is empty", sec.Name(), key("Service"))
+	}
+
+	var err error
+	if sec.HasKey(key("Timeout")) {
+		if c.Timeout, err = ParseDuration(sec.Key(key("Timeout")).Value()); err != nil {
+			return c, fmt.Errorf("%s %s err:%s", sec.Name(), key("Timeout"), err)
+		}
+	}
+	if sec.HasKey(key("Interval")) {
+		if c.Interval, err = ParseDuration(sec.Key(key("Interval")).Value()); err != nil {
+			return c, fmt.Errorf("%s %s err:%s", sec.Name(), key("Interval"), err)
+		}
+	}
+	if sec.HasKey(key("Threshold")) {
+		if c.Threshold, err = sec.Key(key("Threshold")).Int(); err != nil {
+			return c, fmt.Errorf("%s %s err:%s", sec.Name(), key("Threshold"), err)
+		}
+	}
+	return c, nil
+}
+
+//Validate 校验共用的配置
+func (c CheckCfg) Validate(name string) error {
+	if c.Timeout <= 0 {
+		return fmt.Errorf("%s Timeout %s invalid", name, c.Timeout)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("%s Interval %s invalid", name, c.Interval)
+	}
+	if c.Threshold <= 0 {
+		return fmt.Errorf("%s Threshold %d invalid", name, c.Threshold)
+	}
+	return nil
+}
+
+//ParseHealthCfg 解析健康检查相关的section,attach为[SpecInfo]中service对应的附件目录
+func ParseHealthCfg(cfg *ini.File, attach map[string]string) (HealthCfg, error) {
+	hc := HealthCfg{HttpProbes: make([]HttpProbeCfg, 0)}
+	var err error
+
+	if sec, er := cfg.GetSection("HttpProbe"); er == nil {
+		for _, suffix := range GetKeySuffixes(sec, "Service") {
+			c, err := ParseCheckCfg(sec, suffix)
+			if err != nil {
+				return hc, err
+			}
+
+			hp := HttpProbeCfg{CheckCfg: c, HttpCfg: probe.HttpCfg{
+				Url:      strings.TrimSpace(sec.Key(fmt.Sprintf("Url%d", suffix)).Value()),
+				Method:   strings.ToUpper(strings.TrimSpace(sec.Key(fmt.Sprintf("Method%d", suffix)).MustString(http.MethodGet))),
+				Body:     sec.Key(fmt.Sprintf("Body%d", suffix)).Value(),
+				Insecure: sec.Key(fmt.Sprintf("Insecure%d", suffix)).MustInt(0) == 1}}
+			if hp.Status, err = probe.ParseStatusList(sec.Key(fmt.Sprintf("Status%d", suffix)).Value()); err != nil {
+				return hc, fmt.Errorf("HttpProbe Status%d err:%s", suffix, err)
+			}
+			hc.HttpProbes = append(hc.HttpProbes, hp)
+		}
+	}
+
+	if hc.TcpChecks, err = ParseNetCheckCfg(cfg, "TcpCheck"); err != nil {
+		return hc, err
+	}
+	if hc.UdpChecks, err = ParseNetCheckCfg(cfg, "UdpCheck"); err != nil {
+		return hc, err
+	}
+
+	hc.ScriptChecks = make([]ScriptCheckCfg, 0)
+	hc.ScriptConcurrency = probe.DefaultScriptConcurrency
+	if sec, er := cfg.GetSection("ScriptCheck"); er == nil {
+		if sec.HasKey("Concurrency") {
+			if hc.ScriptConcurrency, err = sec.Key("Concurrency").Int(); err != nil {
+				return hc, fmt.Errorf("ScriptCheck Concurrency err:%s", err)
+			}
+		}
+		for _, suffix := range GetKeySuffixes(sec, "Service") {
+			c, err := ParseCheckCfg(sec, suffix)
+			if err != nil {
+				return hc, err
+			}
+			hc.ScriptChecks = append(hc.ScriptChecks, ScriptCheckCfg{CheckCfg: c, Command: strings.TrimSpace(sec.Key(fmt.Sprintf("Command%d", suffix)).Value())})
+		}
+	}
+
+	hc.StaleChecks = make([]StaleCheckCfg, 0)
+	if sec, er := cfg.GetSection("StaleCheck"); er == nil {
+		for _, suffix := range GetKeySuffixes(sec, "Service") {
+			c, err := ParseCheckCfg(sec, suffix)
+			if err != nil {
+				return hc, err
+			}
+
+			stale := StaleCheckCfg{CheckCfg: c, Path: strings.TrimSpace(sec.Key(fmt.Sprintf("Path%d", suffix)).Value())}
+			if stale.Path == "" {
+				//默认检查service的附件目录
+				stale.Path = attach[c.Service]
+			}
+			if stale.MaxAge, err = ParseDuration(sec.Key(fmt.Sprintf("MaxAge%d", suffix)).Value()); err != nil {
+				return hc, fmt.Errorf("StaleCheck MaxAge%d err:%s", suffix, err)
+			}
+			hc.StaleChecks = append(hc.StaleChecks, stale)
+		}
+	}
+
+	if hc.LogWatches, err = ParseLogWatchCfg(cfg, attach); err != nil {
+		return hc, err
+	}
+	if hc.Resources, err = ParseResourceCfg(cfg); err != nil {
+		return hc, err
+	}
+	if hc.Host, err = ParseHostCfg(cfg); err != nil {
+		return hc, err
+	}
+
+	hc.Recoveries = make([]RecoveryCfg, 0)
+	if sec, er := cfg.GetSection("Recovery"); er == nil {
+		for _, suffix := range GetKeySuffixes(sec, "Service") {
+			r := RecoveryCfg{Name: fmt.Sprintf("Recovery%d", suffix), Service: strings.TrimSpace(sec.Key(fmt.Sprintf("Service%d", suffix)).Value())}
+			if r.Steps, err = ParseRecoverySteps(sec.Key(fmt.Sprintf("Steps%d", suffix)).Value()); err != nil {
+				return hc, fmt.Errorf("Recovery Steps%d err:%s", suffix, err)
+			}
+			hc.Recoveries = append(hc.Recoveries, r)
+		}
+	}
+
+	if hc.Hooks, err = ParseHookCfg(cfg); err != nil {
+		return hc, err
+	}
+
+	hc.Depends = make([]DependCfg, 0)
+	if sec, er := cfg.GetSection("Depend"); er == nil {
+		hc.DependFromScm = sec.Key("FromScm").MustInt(0) == 1
+		for _, suffix := range GetKeySuffixes(sec, "Service") {
+			d := DependCfg{
+				Name:         fmt.Sprintf("Depend%d", suffix),
+				Service:      strings.TrimSpace(sec.Key(fmt.Sprintf("Service%d", suffix)).Value()),
+				RestartAfter: sec.Key(fmt.Sprintf("RestartAfter%d", suffix)).MustInt(0) == 1,
+			}
+			for _, on := range strings.Split(sec.Key(fmt.Sprintf("On%d", suffix)).Value(), ",") {
+				if on = strings.TrimSpace(on); on != "" {
+					d.On = append(d.On, on)
+				}
+			}
+			hc.Depends = append(hc.Depends, d)
+		}
+	}
+	return hc, nil
+}
+
+//ParseNetCheckCfg 解析[TcpCheck]/[UdpCheck]:ServiceN AddrN SendN ExpectN
+func ParseNetCheckCfg(cfg *ini.File, name string) ([]NetCheckCfg, error) {
+	checks := make([]NetCheckCfg, 0)
+	sec, er := cfg.GetSection(name)
+	if er != nil {
+		return checks, nil
+	}
+
+	for _, suffix := range GetKeySuffixes(sec, "Service") {
+		c, err := ParseCheckCfg(sec, suffix)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, NetCheckCfg{CheckCfg: c, NetCfg: probe.NetCfg{
+			Addr:   strings.TrimSpace(sec.Key(fmt.Sprintf("Addr%d", suffix)).Value()),
+			Send:   sec.Key(fmt.Sprintf("Send%d", suffix)).Value(),
+			Expect: sec.Key(fmt.Sprintf("Expect%d", suffix)).Value()}})
+	}
+	return checks, nil
+}
+
+//ParseLogWatchCfg 解析[LogWatch]:ServiceN PathN PatternN ContextN CooldownN RestartN
+func ParseLogWatchCfg(cfg *ini.File, attach map[string]string) ([]LogWatchCfg, error) {
+	watches := make([]LogWatchCfg, 0)
+	sec, er := cfg.GetSection("LogWatch")
+	if er != nil {
+		return watches, nil
+	}
+
+	for _, suffix := range GetKeySuffixes(sec, "Service") {
+		key := func(name string) string { return fmt.Sprintf("%s%d", name, suffix) }
+		c := LogWatchCfg{
+			Name:     key("LogWatch"),
+			Service:  strings.TrimSpace(sec.Key(key("Service")).Value()),
+			Path:     strings.TrimSpace(sec.Key(key("Path")).Value()),
+			Pattern:  sec.Key(key("Pattern")).Value(),
+			Context:  DefaultLogWatchContext,
+			Cooldown: DefaultLogWatchCooldown,
+			Restart:  sec.Key(key("Restart")).MustInt(0) == 1,
+		}
+		if c.Path == "" {
+			//默认监控service的附件目录
+			c.Path = attach[c.Service]
+		}
+
+		var err error
+		if sec.HasKey(key("Context")) {
+			if c.Context, err = sec.Key(key("Context")).Int(); err != nil {
+				return nil, fmt.Errorf("LogWatch %s err:%s", key("Context"), err)
+			}
+		}
+		if sec.HasKey(key("Cooldown")) {
+			if c.Cooldown, err = ParseDuration(sec.Key(key("Cooldown")).Value()); err != nil {
+				return nil, fmt.Errorf("LogWatch %s err:%s", key("Cooldown"), err)
+			}
+		}
+		watches = append(watches, c)
+	}
+	return watches, nil
+}
+
+//ParseHookCfg 解析[Hook]:ServiceN PreRestartN PostRestartN TimeoutN VetoN
+func ParseHookCfg(cfg *ini.File) ([]HookCfg, error) {
+	hooks := make([]HookCfg, 0)
+	sec, er := cfg.GetSection("Hook")
+	if er != nil {
+		return hooks, nil
+	}
+
+	for _, suffix := range GetKeySuffixes(sec, "Service") {
+		key := func(name string) string { return fmt.Sprintf("%s%d", name, suffix) }
+		c := HookCfg{
+			Name:        key("Hook"),
+			Service:     strings.TrimSpace(sec.Key(key("Service")).Value()),
+			PreRestart:  strings.TrimSpace(sec.Key(key("PreRestart")).Value()),
+			PostRestart: strings.TrimSpace(sec.Key(key("PostRestart")).Value()),
+			Timeout:     DefaultHookTimeout,
+			Veto:        sec.Key(key("Veto")).MustInt(0) == 1,
+		}
+		if sec.HasKey(key("Timeout")) {
+			var err error
+			if c.Timeout, err = ParseDuration(sec.Key(key("Timeout")).Value()); err != nil {
+				return nil, fmt.Errorf("Hook %s err:%s", key("Timeout"), err)
+			}
+		}
+		hooks = append(hooks, c)
+	}
+	return hooks, nil
+}
+
+//ParseResourceCfg 解析[Resource]:ServiceN IntervalN DurationN CPUN RSSN HandlesN ThreadsN ActionN
+func ParseResourceCfg(cfg *ini.File) ([]ResourceCfg, error) {
+	resources := make([]ResourceCfg, 0)
+	sec, er := cfg.GetSection("Resource")
+	if er != nil {
+		return resources, nil
+	}
+
+	for _, suffix := range GetKeySuffixes(sec, "Service") {
+		key := func(name string) string { return fmt.Sprintf("%s%d", name, suffix) }
+		c := ResourceCfg{
+			Name:     key("Resource"),
+			Service:  strings.TrimSpace(sec.Key(key("Service")).Value()),
+			Interval: DefaultResourceInterval,
+			Duration: DefaultResourceDuration,
+			Action:   strings.ToLower(strings.TrimSpace(sec.Key(key("Action")).MustString(ResourceActionNotify))),
+		}
+
+		var err error
+		if sec.HasKey(key("Interval")) {
+			if c.Interval, err = ParseDuration(sec.Key(key("Interval")).Value()); err != nil {
+				return nil, fmt.Errorf("Resource %s err:%s", key("Interval"), err)
+			}
+		}
+		if sec.HasKey(key("Duration")) {
+			if c.Duration, err = ParseDuration(sec.Key(key("Duration")).Value()); err != nil {
+				return nil, fmt.Errorf("Resource %s err:%s", key("Duration"), err)
+			}
+		}
+		if c.CPU, err = sec.Key(key("CPU")).Float64(); err != nil && sec.HasKey(key("CPU")) {
+			return nil, fmt.Errorf("Resource %s err:%s", key("CPU"), err)
+		}
+		if c.RSS, err = sec.Key(key("RSS")).Uint64(); err != nil && sec.HasKey(key("RSS")) {
+			return nil, fmt.Errorf("Resource %s err:%s", key("RSS"), err)
+		}
+		if c.Handles, err = sec.Key(key("Handles")).Int(); err != nil && sec.HasKey(key("Handles")) {
+			return nil, fmt.Errorf("Resource %s err:%s", key("Handles"), err)
+		}
+		if c.Threads, err = sec.Key(key("Threads")).Int(); err != nil && sec.HasKey(key("Threads")) {
+			return nil, fmt.Errorf("Resource %s err:%s", key("Threads"), err)
+		}
+		resources = append(resources, c)
+	}
+	return resources, nil
+}
+
+//ParseHostCfg 解析[HostCheck]:Interval Hysteresis DiskN DiskMinFreeN LogMinFree MemMinFree MaxLoad,没有这个section时不检查
+func ParseHostCfg(cfg *ini.File) (HostCfg, error) {
+	var hc HostCfg
+	sec, er := cfg.GetSection("HostCheck")
+	if er != nil {
+		return hc, nil
+	}
+
+	var err error
+	hc.Interval, hc.Hysteresis = DefaultHostInterval, DefaultHostHysteresis
+	if sec.HasKey("Interval") {
+		if hc.Interval, err = ParseDuration(sec.Key("Interval").Value()); err != nil {
+			return hc, fmt.Errorf("HostCheck Interval err:%s", err)
+		}
+	}
+	if sec.HasKey("Hysteresis") {
+		if hc.Hysteresis, err = sec.Key("Hysteresis").Float64(); err != nil {
+			return hc, fmt.Errorf("HostCheck Hysteresis err:%s", err)
+		}
+	}
+	if hc.LogMinFree, err = ParseFreeThreshold(sec.Key("LogMinFree").MustString("10%")); err != nil {
+		return hc, fmt.Errorf("HostCheck LogMinFree err:%s", err)
+	}
+	if hc.MemMinFree, err = ParseFreeThreshold(sec.Key("MemMinFree").Value()); err != nil {
+		return hc, fmt.Errorf("HostCheck MemMinFree err:%s", err)
+	}
+	if sec.HasKey("MaxLoad") {
+		if hc.MaxLoad, err = sec.Key("MaxLoad").Float64(); err != nil {
+			return hc, fmt.Errorf("HostCheck MaxLoad err:%s", err)
+		}
+	}
+
+	hc.Disks = make([]DiskCheckCfg, 0)
+	for _, suffix := range GetKeySuffixes(sec, "Disk") {
+		d := DiskCheckCfg{Path: strings.TrimSpace(sec.Key(fmt.Sprintf("Disk%d", suffix)).Value())}
+		if d.MinFree, err = ParseFreeThreshold(sec.Key(fmt.Sprintf("DiskMinFree%d", suffix)).MustString("10%")); err != nil {
+			return hc, fmt.Errorf("HostCheck DiskMinFree%d err:%s", suffix, err)
+		}
+		hc.Disks = append(hc.Disks, d)
+	}
+	return hc, nil
+}
+
+//Validate 校验健康检查的配置
+func (hc HealthCfg) Validate() error {
+	for _, probe := range hc.HttpProbes {
+		name := probe.Name
+		if err := probe.CheckCfg.Validate(name); err != nil {
+			return err
+		}
+		if u, err := url.Parse(probe.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s Url %s invalid", name, probe.Url)
+		}
+		if probe.Method == "" {
+			return fmt.Errorf("%s Method is empty", name)
+		}
+		if _, err := regexp.Compile(probe.Body); err != nil {
+			return fmt.Errorf("%s Body err:%s", name, err)
+		}
+	}
+
+	for _, check := range hc.TcpChecks {
+		if err := check.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, check := range hc.UdpChecks {
+		if err := check.Validate(); err != nil {
+			return err
+		}
+		if check.Send == "" {
+			return fmt.Errorf("%s Send is empty, udp check need a request", check.Name)
+		}
+	}
+
+	if hc.ScriptConcurrency <= 0 {
+		return fmt.Errorf("ScriptCheck Concurrency %d invalid", hc.ScriptConcurrency)
+	}
+	for _, check := range hc.ScriptChecks {
+		if err := check.CheckCfg.Validate(check.Name); err != nil {
+			return err
+		}
+		if check.Command == "" {
+			return fmt.Errorf("%s Command is empty", check.Name)
+		}
+	}
+
+	for _, check := range hc.StaleChecks {
+		if err := check.CheckCfg.Validate(check.Name); err != nil {
+			return err
+		}
+		if check.Path == "" {
+			return fmt.Errorf("%s Path is empty and service %s has no Attach", check.Name, check.Service)
+		}
+		if check.MaxAge <= 0 {
+			return fmt.Errorf("%s MaxAge %s invalid", check.Name, check.MaxAge)
+		}
+	}
+
+	for _, w := range hc.LogWatches {
+		if w.Service == "" {
+			return fmt.Errorf("%s Service is empty", w.Name)
+		}
+		if w.Path == "" {
+			return fmt.Errorf("%s Path is empty and service %s has no Attach", w.Name, w.Service)
+		}
+		if w.Pattern == "" {
+			return fmt.Errorf("%s Pattern is empty", w.Name)
+		}
+		if _, err := regexp.Compile(w.Pattern); err != nil {
+			return fmt.Errorf("%s Pattern err:%s", w.Name, err)
+		}
+		if w.Context < 0 || w.Context > MaxLogWatchContext {
+			return fmt.Errorf("%s Context %d invalid(0-%d)", w.Name, w.Context, MaxLogWatchContext)
+		}
+		if w.Cooldown < 0 {
+			return fmt.Errorf("%s Cooldown %s invalid", w.Name, w.Cooldown)
+		}
+	}
+
+	services := make(map[string]string)
+	for _, r := range hc.Resources {
+		if r.Service == "" {
+			return fmt.Errorf("%s Service is empty", r.Name)
+		}
+		if name, ok := services[r.Service]; ok {
+			return fmt.Errorf("%s and %s are both for service %s", name, r.Name, r.Service)
+		}
+		services[r.Service] = r.Name
+		if r.Interval <= 0 || r.Duration < 0 {
+			return fmt.Errorf("%s Interval %s or Duration %s invalid", r.Name, r.Interval, r.Duration)
+		}
+		if r.CPU < 0 || r.Handles < 0 || r.Threads < 0 {
+			return fmt.Errorf("%s threshold can't be negative", r.Name)
+		}
+		if r.CPU == 0 && r.RSS == 0 && r.Handles == 0 && r.Threads == 0 {
+			return fmt.Errorf("%s has no threshold", r.Name)
+		}
+		if r.Action != ResourceActionNotify && r.Action != ResourceActionRestart {
+			return fmt.Errorf("%s Action %s invalid(notify/restart)", r.Name, r.Action)
+		}
+	}
+
+	if hc.Host.Interval < 0 {
+		return fmt.Errorf("HostCheck Interval %s invalid", hc.Host.Interval)
+	}
+	if hc.Host.Hysteresis < 0 || hc.Host.Hysteresis >= 100 {
+		return fmt.Errorf("HostCheck Hysteresis %v invalid(0-100)", hc.Host.Hysteresis)
+	}
+	if hc.Host.MaxLoad < 0 {
+		return fmt.Errorf("HostCheck MaxLoad %v invalid", hc.Host.MaxLoad)
+	}
+	for _, d := range hc.Host.Disks {
+		if d.Path == "" {
+			return fmt.Errorf("HostCheck Disk is empty")
+		}
+	}
+
+	for _, d := range hc.Depends {
+		if d.Service == "" || d.Service == "*" {
+			return fmt.Errorf("%s Service %s invalid", d.Name, d.Service)
+		}
+		if len(d.On) == 0 {
+			return fmt.Errorf("%s On is empty", d.Name)
+		}
+		for _, on := range d.On {
+			if strings.Contains(on, "*") {
+				return fmt.Errorf("%s On %s can't use *", d.Name, on)
+			}
+		}
+	}
+	if err := CheckDependCycle(hc.Depends); err != nil {
+		return err
+	}
+
+	recoveries := make(map[string]string)
+	for _, r := range hc.Recoveries {
+		if r.Service == "" {
+			return fmt.Errorf("%s Service is empty", r.Name)
+		}
+		if name, ok := recoveries[r.Service]; ok {
+			return fmt.Errorf("%s and %s are both for service %s", name, r.Name, r.Service)
+		}
+		recoveries[r.Service] = r.Name
+
+		start := false
+		for _, step := range r.Steps {
+			start = start || step.Action == StepStart
+		}
+		if !start {
+			return fmt.Errorf("%s Steps has no start step", r.Name)
+		}
+	}
+
+	hooks := make(map[string]string)
+	for _, h := range hc.Hooks {
+		if h.Service == "" {
+			return fmt.Errorf("%s Service is empty", h.Name)
+		}
+		if name, ok := hooks[h.Service]; ok {
+			return fmt.Errorf("%s and %s are both for service %s", name, h.Name, h.Service)
+		}
+		hooks[h.Service] = h.Name
+		if h.PreRestart == "" && h.PostRestart == "" {
+			return fmt.Errorf("%s has no PreRestart or PostRestart", h.Name)
+		}
+		if h.Veto && h.PreRestart == "" {
+			return fmt.Errorf("%s Veto need PreRestart", h.Name)
+		}
+		if h.Timeout <= 0 {
+			return fmt.Errorf("%s Timeout must be greater than 0", h.Name)
+		}
+	}
+	return nil
+}
+
+//Validate 校验端口检查的配置
+func (c NetCheckCfg) Validate() error {
+	if err := c.CheckCfg.Validate(c.Name); err != nil {
+		return err
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return fmt.Errorf("%s Addr %s invalid", c.Name, c.Addr)
+	}
+	if _, err := probe.Unescape(c.Send); err != nil {
+		return fmt.Errorf("%s Send err:%s", c.Name, err)
+	}
+	if _, err := regexp.Compile(c.Expect); err != nil {
+		return fmt.Errorf("%s Expect err:%s", c.Name, err)
+	}
+	return nil
+}
+
+//Diff 健康检查配置的差异
+func (hc HealthCfg) Diff(cur HealthCfg, changed func(name string, o, n interface{})) {
+	changed("HttpProbe", hc.HttpProbes, cur.HttpProbes)
+	changed("TcpCheck", hc.TcpChecks, cur.TcpChecks)
+	changed("UdpCheck", hc.UdpChecks, cur.UdpChecks)
+	changed("ScriptCheck", hc.ScriptChecks, cur.ScriptChecks)
+	changed("ScriptCheck.Concurrency", hc.ScriptConcurrency, cur.ScriptConcurrency)
+	changed("StaleCheck", hc.StaleChecks, cur.StaleChecks)
+	changed("LogWatch", hc.LogWatches, cur.LogWatches)
+	changed("Resource", hc.Resources, cur.Resources)
+	changed("HostCheck", hc.Host, cur.Host)
+	changed("Depend", hc.Depends, cur.Depends)
+	changed("Depend.FromScm", hc.DependFromScm, cur.DependFromScm)
+	changed("Recovery", hc.Recoveries, cur.Recoveries)
+	changed("Hook", hc.Hooks, cur.Hooks)
+}
+
+//GetScriptConcurrency 同时运行的检查脚本数
+func (mcfg *MonitorCfg) GetScriptConcurrency() int {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return mcfg.health.ScriptConcurrency
+}
+
+//GetLogWatches 日记监控的规则
+func (mcfg *MonitorCfg) GetLogWatches() []LogWatchCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return append([]LogWatchCfg(nil), mcfg.health.LogWatches...)
+}
+
+//GetResources 资源监控的配置
+func (mcfg *MonitorCfg) GetResources() []ResourceCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return append([]ResourceCfg(nil), mcfg.health.Resources...)
+}
+
+//GetHostCfg 主机检查的配置
+func (mcfg *MonitorCfg) GetHostCfg() HostCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return mcfg.health.Host
+}
+
+//GetDependGraph service之间的依赖关系
+func (mcfg *MonitorCfg) GetDependGraph() *DependGraph {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return NewDependGraph(append([]DependCfg(nil), mcfg.health.Depends...), mcfg.health.DependFromScm)
+}
+
+//GetRecoveries service的恢复步骤
+func (mcfg *MonitorCfg) GetRecoveries() []RecoveryCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return append([]RecoveryCfg(nil), mcfg.health.Recoveries...)
+}
+
+//GetHooks service重启前后运行的hook脚本
+func (mcfg *MonitorCfg) GetHooks() []HookCfg {
+	mcfg.mu.RLock()
+	defer mcfg.mu.RUnlock()
+	return append([]HookCfg(nil), mcfg.health.Hooks...)
+}
+
+//GetHealthChecks 根据配置创建所有的健康检查
+func (mcfg *MonitorCfg) GetHealthChecks() []HealthCheck {
+	mcfg.mu.RLock()
+	hc := mcfg.health
+	mcfg.mu.RUnlock()
+
+	checks := make([]HealthCheck, 0)
+	add := func(c CheckCfg, cfg interface{}, checker Checker, err error) {
+		if err != nil {
+			logdoo.Error("create health check fail", logdoo.String("name", c.Name), logdoo.Err(err))
+			return
+		}
+		checks = append(checks, HealthCheck{Key: fmt.Sprintf("%+v", cfg), CheckCfg: c, Checker: checker})
+	}
+
+	for _, hp := range hc.HttpProbes {
+		checker, err := probe.NewHttpChecker(hp.HttpCfg)
+		add(hp.CheckCfg, hp, checker, err)
+	}
+	for _, check := range hc.TcpChecks {
+		checker, err := probe.NewNetChecker("tcp", check.NetCfg)
+		add(check.CheckCfg, check, checker, err)
+	}
+	for _, check := range hc.UdpChecks {
+		checker, err := probe.NewNetChecker("udp", check.NetCfg)
+		add(check.CheckCfg, check, checker, err)
+	}
+	for _, check := range hc.ScriptChecks {
+		checker, err := NewScriptChecker(check)
+		add(check.CheckCfg, check, checker, err)
+	}
+	for _, check := range hc.StaleChecks {
+		checker, err := NewStaleChecker(check)
+		add(check.CheckCfg, check, checker, err)
+	}
+	return checks
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"GoMonitor/probe"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//hook的事件
+const (
+	HookPreRestart  = "pre_restart"
+	HookPostRestart = "post_restart"
+)
+
+//DefaultHookTimeout hook脚本默认的超时
+const DefaultHookTimeout = time.Minute
+
+//HookCfg [Hook]一个service重启前后运行的脚本
+type HookCfg struct {
+	Name        string
+	Service     string
+	PreRestart  string //重启前运行的命令行
+	PostRestart string //重启后(不管成功与否)运行的命令行
+	Timeout     time.Duration
+	Veto        bool //PreRestart失败(退出码非0或者超时)时取消这次重启
+}
+
+//HookEvent 传给hook脚本的事件信息(通过GOMONITOR_*环境变量)
+type HookEvent struct {
+	Event   string
+	Service string
+	Machine string
+	Reason  string
+	Detail  string
+	Result  string //post_restart时重启的结果:success或者fail
+}
+
+//Env hook脚本的环境变量
+func (ev HookEvent) Env() []string {
+	detail := ev.Detail
+	if len(detail) > probe.ScriptOutputLimit {
+		detail = detail[:probe.ScriptOutputLimit]
+	}
+	env := []string{
+		"GOMONITOR_EVENT=" + ev.Event,
+		"GOMONITOR_SERVICE=" + ev.Service,
+		"GOMONITOR_MACHINE=" + ev.Machine,
+		"GOMONITOR_REASON=" + ev.Reason,
+		"GOMONITOR_DETAIL=" + detail,
+		"GOMONITOR_TIME=" + time.Now().Format(time.RFC3339),
+	}
+	if ev.Result != "" {
+		env = append(env, "GOMONITOR_RESULT="+ev.Result)
+	}
+	return env
+}
+
+//RunHook 运行hook脚本,返回用于通知的记录;退出码非0或者超时返回错误
+func RunHook(log *logdoo.Context, command string, timeout time.Duration, ev HookEvent) (string, error) {
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Info("run hook", logdoo.String("event", ev.Event), logdoo.String("command", command))
+	res, err := probe.RunCommand(ctx, command, ev.Env())
+	if err == nil && res.Code != 0 {
+		err = fmt.Errorf("exit code %d", res.Code)
+	}
+
+	record := fmt.Sprintf("%s hook: ", ev.Event)
+	if err != nil {
+		record += "fail " + err.Error()
+		log.Warn("hook fail", logdoo.String("event", ev.Event), logdoo.Err(err), logdoo.String("output", res.Output))
+	} else {
+		record += "ok"
+		log.Info("hook done", logdoo.String("event", ev.Event), logdoo.Duration("duration", res.Duration))
+	}
+	record += fmt.Sprintf(" (%s)", res.Duration.Round(100*time.Millisecond))
+	if output := strings.TrimSpace(res.Output); output != "" {
+		record += "\n    " + strings.Replace(output, "\n", "\n    ", -1)
+	}
+	return record, err
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"GoMonitor/probe"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//默认的主机检查配置
+const (
+	DefaultHostInterval   = time.Minute
+	DefaultHostHysteresis = 10 //恢复时需要超过阈值的百分比
+)
+
+//HostReason 主机资源告警通知的标题
+const HostReason = "host resource alert!"
+
+//HostNotifier 主机检查告警时发送通知
+type HostNotifier interface {
+	NotifyHost(reason, detail string)
+}
+
+//FreeThreshold 剩余空间的阈值,如10%或者5120(MB)
+type FreeThreshold struct {
+	Percent float64
+	MB      uint64
+}
+
+//ParseFreeThreshold 解析剩余空间的阈值,百分号结尾表示百分比,否则为MB,空表示不检查
+func ParseFreeThreshold(s string) (FreeThreshold, error) {
+	var t FreeThreshold
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return t, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil || p < 0 || p >= 100 {
+			return t, fmt.Errorf("percent %s invalid", s)
+		}
+		t.Percent = p
+		return t, nil
+	}
+	mb, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return t, fmt.Errorf("size %s invalid", s)
+	}
+	t.MB = mb
+	return t, nil
+}
+
+//Enabled 是否需要检查
+func (t FreeThreshold) Enabled() bool {
+	return t.Percent > 0 || t.MB > 0
+}
+
+//Min 总量为total时最少需要的剩余字节数
+func (t FreeThreshold) Min(total uint64) uint64 {
+	if t.Percent > 0 {
+		return uint64(float64(total) * t.Percent / 100)
+	}
+	return t.MB * 1024 * 1024
+}
+
+func (t FreeThreshold) String() string {
+	if t.Percent > 0 {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatUint(t.MB, 10) + "MB"
+}
+
+//DiskCheckCfg 一个挂载点(目录)的剩余空间检查
+type DiskCheckCfg struct {
+	Path    string
+	MinFree FreeThreshold
+}
+
+//HostCfg [HostCheck]主机检查的配置
+type HostCfg struct {
+	Interval   time.Duration
+	Hysteresis float64 //恢复时需要超过阈值的百分比,避免在阈值附近反复告警
+	Disks      []DiskCheckCfg
+	LogMinFree FreeThreshold //日记目录所在磁盘的剩余空间
+	MemMinFree FreeThreshold //可用内存
+	MaxLoad    float64       //1分钟的平均负载(Windows为CPU繁忙的核数),0不检查
+}
+
+//HostMonitor 定时检查主机的磁盘、内存和负载,同一项超过阈值只告警一次,恢复后才会再次告警
+type HostMonitor struct {
+	cfg      HostCfg
+	notifier HostNotifier
+	alerting map[string]bool //当前处于告警状态的检查项
+	stop     chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+//NewHostMonitor New一个主机检查
+func NewHostMonitor() *HostMonitor {
+	return &HostMonitor{alerting: make(map[string]bool)}
+}
+
+//Update 按新的配置重新开始检查(保留告警状态),配置没有变化时不处理
+func (hm *HostMonitor) Update(cfg HostCfg, n HostNotifier) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	if hm.stop != nil && fmt.Sprintf("%+v", cfg) == fmt.Sprintf("%+v", hm.cfg) {
+		return
+	}
+	hm.stopLocked()
+
+	hm.cfg, hm.notifier = cfg, n
+	if cfg.Interval <= 0 {
+		return
+	}
+	hm.stop, hm.done = make(chan struct{}), make(chan struct{})
+	go hm.run(cfg, hm.stop, hm.done)
+	logdoo.Info("host check start", logdoo.Duration("interval", cfg.Interval), logdoo.Int("disks", len(cfg.Disks)))
+}
+
+//Close 停止检查
+func (hm *HostMonitor) Close() {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.stopLocked()
+}
+
+func (hm *HostMonitor) stopLocked() {
+	if hm.stop == nil {
+		return
+	}
+	close(hm.stop)
+	<-hm.done
+	hm.stop, hm.done = nil, nil
+}
+
+func (hm *HostMonitor) run(cfg HostCfg, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		hm.CheckOnce(cfg)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//CheckOnce 检查一遍所有的项
+func (hm *HostMonitor) CheckOnce(cfg HostCfg) {
+	disks := cfg.Disks
+	if cfg.LogMinFree.Enabled() {
+		disks = append(disks[:len(disks):len(disks)], DiskCheckCfg{Path: logdoo.LogInfo.Rotator().Dir(), MinFree: cfg.LogMinFree})
+	}
+	for _, d := range disks {
+		free, total, err := probe.DiskFree(d.Path)
+		if err != nil {
+			hm.fail("disk:"+d.Path, err)
+			continue
+		}
+		min := d.MinFree.Min(total)
+		hm.judge(cfg, "disk:"+d.Path, float64(free) < float64(min), float64(free) >= float64(min)*(1+cfg.Hysteresis/100),
+			fmt.Sprintf("disk %s free %s of %s, min free %s", d.Path, FormatBytes(free), FormatBytes(total), d.MinFree))
+	}
+
+	if cfg.MemMinFree.Enabled() {
+		avail, total, err := probe.MemoryAvailable()
+		if err != nil {
+			hm.fail("memory", err)
+		} else {
+			min := cfg.MemMinFree.Min(total)
+			hm.judge(cfg, "memory", float64(avail) < float64(min), float64(avail) >= float64(min)*(1+cfg.Hysteresis/100),
+				fmt.Sprintf("memory available %s of %s, min free %s", FormatBytes(avail), FormatBytes(total), cfg.MemMinFree))
+		}
+	}
+
+	if cfg.MaxLoad > 0 {
+		load, err := probe.LoadAverage()
+		if err != nil {
+			hm.fail("load", err)
+		} else {
+			hm.judge(cfg, "load", load > cfg.MaxLoad, load <= cfg.MaxLoad*(1-cfg.Hysteresis/100),
+				fmt.Sprintf("load %.2f, max %.2f", load, cfg.MaxLoad))
+		}
+	}
+}
+
+//judge 超过阈值时告警一次,恢复(超过阈值加上回差)后才重新告警
+func (hm *HostMonitor) judge(cfg HostCfg, item string, breach, recovered bool, detail string) {
+	hm.mu.Lock()
+	alerting := hm.alerting[item]
+	switch {
+	case !alerting && breach:
+		hm.alerting[item] = true
+	case alerting && recovered:
+		delete(hm.alerting, item)
+	}
+	n := hm.notifier
+	hm.mu.Unlock()
+
+	log := logdoo.With("item", item)
+	switch {
+	case !alerting && breach:
+		log.Error("host resource alert", logdoo.String("detail", detail))
+		if n != nil {
+			n.NotifyHost(HostReason, detail)
+		}
+	case alerting && recovered:
+		log.Info("host resource recovered", logdoo.String("detail", detail))
+	default:
+		log.Debug("host check", logdoo.String("detail", detail), logdoo.Bool("alerting", alerting))
+	}
+}
+
+var hostFailLog = logdoo.Limited(LogLimitWindow)
+
+func (hm *HostMonitor) fail(item string, err error) {
+	hostFailLog.Warn("host check fail", logdoo.String("item", item), logdoo.Err(err))
+}
+
+//FormatBytes 以合适的单位显示字节数
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"sort"
+	"sync"
+)
+
+//LogLevels 各个日记Handler的级别,通过控制接口修改的级别在重新加载配置后仍然保留
+type LogLevels struct {
+	handlers map[string]logdoo.LevelHandler
+	cfg      map[string]logdoo.Level //配置中的级别
+	override map[string]logdoo.Level //通过控制接口修改的级别
+	mu       sync.Mutex
+}
+
+//NewLogLevels New一个日记级别的管理
+func NewLogLevels() *LogLevels {
+	return &LogLevels{handlers: make(map[string]logdoo.LevelHandler),
+		cfg:      make(map[string]logdoo.Level),
+		override: make(map[string]logdoo.Level)}
+}
+
+//Apply 登记名字为name的Handler并应用配置中的级别,通过控制接口修改过级别时使用修改的级别
+func (ll *LogLevels) Apply(name string, h logdoo.LevelHandler, level logdoo.Level) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	ll.handlers[name] = h
+	ll.cfg[name] = level
+	if override, ok := ll.override[name]; ok {
+		level = override
+	}
+	h.SetLevel(level)
+}
+
+//Remove 移除关闭了的Handler,通过控制接口修改的级别同时去掉
+func (ll *LogLevels) Remove(name string) {
+	ll.mu.Lock()
+	delete(ll.handlers, name)
+	delete(ll.cfg, name)
+	delete(ll.override, name)
+	ll.mu.Unlock()
+}
+
+//Override 通过控制接口修改Handler的级别,没有这个Handler时返回false
+func (ll *LogLevels) Override(name string, level logdoo.Level) bool {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	h, ok := ll.handlers[name]
+	if !ok {
+		return false
+	}
+	ll.override[name] = level
+	h.SetLevel(level)
+	return true
+}
+
+//Reset 去掉通过控制接口修改的级别,恢复为配置中的级别,没有这个Handler时返回false
+func (ll *LogLevels) Reset(name string) bool {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	h, ok := ll.handlers[name]
+	if !ok {
+		return false
+	}
+	delete(ll.override, name)
+	h.SetLevel(ll.cfg[name])
+	return true
+}
+
+//Levels 当前各个Handler的级别
+func (ll *LogLevels) Levels() map[string]string {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	levels := make(map[string]string, len(ll.handlers))
+	for name, h := range ll.handlers {
+		levels[name] = h.Level().String()
+	}
+	return levels
+}
+
+//Names 当前所有Handler的名字(排好序)
+func (ll *LogLevels) Names() []string {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	names := make([]string, 0, len(ll.handlers))
+	for name := range ll.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
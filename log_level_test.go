@@ -0,0 +1,46 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"testing"
+)
+
+func TestLogLevelsReload(t *testing.T) {
+	levels := NewLogLevels()
+	file, syslog := logdoo.NewConsoleHandler(), logdoo.NewConsoleHandler()
+	levels.Apply("file", file, logdoo.INFO)
+	levels.Apply("syslog", syslog, logdoo.INFO)
+
+	if !levels.Override("syslog", logdoo.DEBUG) || syslog.Level() != logdoo.DEBUG {
+		t.Fatalf("override syslog level %s", syslog.Level())
+	}
+	if levels.Override("journald", logdoo.DEBUG) {
+		t.Error("override handler not applied")
+	}
+
+	//重新加载配置后控制接口修改的级别仍然保留,没有修改的使用新的配置
+	levels.Apply("file", file, logdoo.WARN)
+	levels.Apply("syslog", syslog, logdoo.WARN)
+	if file.Level() != logdoo.WARN || syslog.Level() != logdoo.DEBUG {
+		t.Errorf("after reload file %s syslog %s, want warn debug", file.Level(), syslog.Level())
+	}
+
+	if !levels.Reset("syslog") || syslog.Level() != logdoo.WARN {
+		t.Errorf("reset syslog level %s, want the config warn", syslog.Level())
+	}
+	levels.Apply("syslog", syslog, logdoo.ERROR)
+	if syslog.Level() != logdoo.ERROR {
+		t.Errorf("syslog level %s after reset, want the config error", syslog.Level())
+	}
+
+	//关闭的Handler连同修改的级别一起去掉
+	levels.Override("syslog", logdoo.DEBUG)
+	levels.Remove("syslog")
+	levels.Apply("syslog", syslog, logdoo.INFO)
+	if syslog.Level() != logdoo.INFO {
+		t.Errorf("syslog level %s after reopen, want the config info", syslog.Level())
+	}
+	if got := levels.Levels(); len(got) != 2 || got["file"] != "warn" || got["syslog"] != "info" {
+		t.Errorf("levels %v", got)
+	}
+}
@@ -0,0 +1,271 @@
+package logdoo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//OverflowPolicy 异步日记缓冲区满时的处理方式
+type OverflowPolicy int32
+
+const (
+	OverflowBlock      OverflowPolicy = iota //等待写日记的协程腾出空间
+	OverflowDropOldest                       //丢弃缓冲区中最旧的一条
+	OverflowDropNewest                       //丢弃当前这一条
+)
+
+//AsyncBatchSize 写日记的协程每次最多从缓冲区取出的条数
+const AsyncBatchSize = 64
+
+//ParseOverflowPolicy 把配置中的策略名(block/drop_oldest/drop_newest)转换成OverflowPolicy
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "drop_oldest":
+		return OverflowDropOldest, nil
+	case "drop_newest":
+		return OverflowDropNewest, nil
+	}
+	return OverflowBlock, fmt.Errorf("unknow log overflow policy %s", name)
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowDropNewest:
+		return "drop_newest"
+	}
+	return "block"
+}
+
+//AsyncHandler 异步日记,调用方只把日记放入有界的环形缓冲区,由单独的协程批量交给内部的Handler输出,
+//内部Handler实现了BatchHandler时一批日记合并成一次写入
+type AsyncHandler struct {
+	inner   Handler
+	buf     []*Entry
+	head    int
+	count   int
+	policy  OverflowPolicy
+	dropped uint64
+	writing bool //写日记的协程正在输出取出的一批日记
+	closed  bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+	done    chan struct{}
+}
+
+//NewAsyncHandler New一个异步日记,size为缓冲区能存放的日记条数
+func NewAsyncHandler(inner Handler, size int, policy OverflowPolicy) *AsyncHandler {
+	if size <= 0 {
+		size = 1024
+	}
+
+	h := &AsyncHandler{
+		inner:  inner,
+		buf:    make([]*Entry, size),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	h.cond = sync.NewCond(&h.mu)
+	go h.run()
+	return h
+}
+
+//Inner 内部实际输出日记的Handler
+func (h *AsyncHandler) Inner() Handler {
+	return h.inner
+}
+
+//Size 缓冲区能存放的日记条数
+func (h *AsyncHandler) Size() int {
+	return len(h.buf)
+}
+
+//Policy 缓冲区满时的处理方式
+func (h *AsyncHandler) Policy() OverflowPolicy {
+	return OverflowPolicy(atomic.LoadInt32((*int32)(&h.policy)))
+}
+
+//SetPolicy 设置缓冲区满时的处理方式
+func (h *AsyncHandler) SetPolicy(p OverflowPolicy) {
+	atomic.StoreInt32((*int32)(&h.policy), int32(p))
+	h.cond.Broadcast()
+}
+
+//Dropped 因为缓冲区满被丢弃的日记条数
+func (h *AsyncHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+//Log 把日记放入缓冲区,已经停止的异步日记直接同步输出
+func (h *AsyncHandler) Log(e *Entry) {
+	h.mu.Lock()
+	for !h.closed && h.count == len(h.buf) && h.Policy() == OverflowBlock {
+		h.cond.Wait()
+	}
+
+	if h.closed {
+		h.mu.Unlock()
+		h.inner.Log(e)
+		return
+	}
+
+	if h.count == len(h.buf) {
+		atomic.AddUint64(&h.dropped, 1)
+		if h.Policy() == OverflowDropNewest {
+			h.mu.Unlock()
+			return
+		}
+		//丢弃最旧的一条
+		h.buf[h.head] = nil
+		h.head = (h.head + 1) % len(h.buf)
+		h.count--
+	}
+
+	h.buf[(h.head+h.count)%len(h.buf)] = e
+	h.count++
+	h.mu.Unlock()
+	h.cond.Broadcast()
+}
+
+func (h *AsyncHandler) run() {
+	defer close(h.done)
+	batch := make([]*Entry, 0, AsyncBatchSize)
+
+	for {
+		h.mu.Lock()
+		for h.count == 0 && !h.closed {
+			h.cond.Wait()
+		}
+		if h.count == 0 && h.closed {
+			h.mu.Unlock()
+			return
+		}
+
+		for h.count > 0 && len(batch) < AsyncBatchSize {
+			batch = append(batch, h.buf[h.head])
+			h.buf[h.head] = nil
+			h.head = (h.head + 1) % len(h.buf)
+			h.count--
+		}
+		h.writing = true
+		h.mu.Unlock()
+		h.cond.Broadcast()
+
+		//内部Handler支持时整批格式化后只写一次
+		if bh, ok := h.inner.(BatchHandler); ok {
+			bh.LogBatch(batch)
+		} else {
+			for i := range batch {
+				h.inner.Log(batch[i])
+			}
+		}
+		for i := range batch {
+			batch[i] = nil
+		}
+		batch = batch[:0]
+
+		h.mu.Lock()
+		h.writing = false
+		h.mu.Unlock()
+		h.cond.Broadcast()
+	}
+}
+
+//Flush 等待缓冲区中的日记全部输出
+func (h *AsyncHandler) Flush() {
+	h.mu.Lock()
+	for h.count > 0 || h.writing {
+		h.cond.Wait()
+	}
+	h.mu.Unlock()
+}
+
+//Stop 输出缓冲区中剩余的日记并停止写日记的协程,之后的日记同步输出,不会关闭内部的Handler
+func (h *AsyncHandler) Stop() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.cond.Broadcast()
+	<-h.done
+}
+
+func (h *AsyncHandler) close() {
+	h.Stop()
+	h.inner.close()
+}
+
+func (h *AsyncHandler) DebugDoo(v ...interface{}) {
+	h.Log(newEntry(DEBUG, 2, "", v, nil))
+}
+
+func (h *AsyncHandler) InfoDoo(v ...interface{}) {
+	h.Log(newEntry(INFO, 2, "", v, nil))
+}
+
+func (h *AsyncHandler) WarnDoo(v ...interface{}) {
+	h.Log(newEntry(WARN, 2, "", v, nil))
+}
+
+func (h *AsyncHandler) ErrorDoo(v ...interface{}) {
+	h.Log(newEntry(ERROR, 2, "", v, nil))
+}
+
+func (h *AsyncHandler) SetOutput(w io.Writer) {
+	h.Flush()
+	h.inner.SetOutput(w)
+}
+
+func (h *AsyncHandler) Output(calldepth int, s string) error {
+	h.Flush()
+	return h.inner.Output(calldepth+1, s)
+}
+
+//Format 内部Handler的输出格式,内部Handler没有实现FormatHandler时为TextFormat
+func (h *AsyncHandler) Format() Format {
+	if fh, ok := h.inner.(FormatHandler); ok {
+		return fh.Format()
+	}
+	return TextFormat
+}
+
+func (h *AsyncHandler) SetFormat(f Format) {
+	if fh, ok := h.inner.(FormatHandler); ok {
+		fh.SetFormat(f)
+	}
+}
+
+//Level 内部Handler的最低输出级别,内部Handler没有实现LevelHandler时输出所有级别
+func (h *AsyncHandler) Level() Level {
+	if lh, ok := h.inner.(LevelHandler); ok {
+		return lh.Level()
+	}
+	return DEBUG
+}
+
+func (h *AsyncHandler) SetLevel(level Level) {
+	if lh, ok := h.inner.(LevelHandler); ok {
+		lh.SetLevel(level)
+	}
+}
+
+func (h *AsyncHandler) Flags() int {
+	return h.inner.Flags()
+}
+
+func (h *AsyncHandler) SetFlags(flag int) {
+	h.inner.SetFlags(flag)
+}
+
+func (h *AsyncHandler) Prefix() string {
+	return h.inner.Prefix()
+}
+
+func (h *AsyncHandler) SetPrefix(prefix string) {
+	h.inner.SetPrefix(prefix)
+}
@@ -0,0 +1,250 @@
+package logdoo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//gateHandler 在gate关闭前阻塞输出,用于把异步日记的缓冲区塞满
+type gateHandler struct {
+	captureHandler
+	gate    chan struct{}
+	started chan struct{}
+	closed  bool
+}
+
+func newGateHandler() *gateHandler {
+	return &gateHandler{gate: make(chan struct{}), started: make(chan struct{}, 1)}
+}
+
+func (h *gateHandler) Log(e *Entry) {
+	select {
+	case h.started <- struct{}{}:
+	default:
+	}
+	<-h.gate
+	h.captureHandler.Log(e)
+}
+
+func (h *gateHandler) close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+}
+
+func (h *gateHandler) Msgs() []string {
+	var msgs []string
+	for _, e := range h.Entries() {
+		msgs = append(msgs, e.Msg)
+	}
+	return msgs
+}
+
+//fillAsync 写入第一条并等它被写日记的协程取出(阻塞在gate),再写入n条
+func fillAsync(t *testing.T, h *AsyncHandler, inner *gateHandler, n int) {
+	h.Log(&Entry{Msg: "m0"})
+	select {
+	case <-inner.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("writer goroutine not started")
+	}
+	for i := 1; i <= n; i++ {
+		h.Log(&Entry{Msg: fmt.Sprintf("m%d", i)})
+	}
+}
+
+func TestAsyncDropOnFull(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   []string
+	}{
+		{OverflowDropNewest, []string{"m0", "m1", "m2", "m3"}},
+		{OverflowDropOldest, []string{"m0", "m4", "m5", "m6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			inner := newGateHandler()
+			h := NewAsyncHandler(inner, 3, tt.policy)
+
+			//m0在输出中,缓冲区放3条,另外3条被丢弃
+			fillAsync(t, h, inner, 6)
+			if n := h.Dropped(); n != 3 {
+				t.Errorf("dropped %d, want 3", n)
+			}
+
+			close(inner.gate)
+			h.Stop()
+			if got := inner.Msgs(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("output %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncBlockOnFull(t *testing.T) {
+	inner := newGateHandler()
+	h := NewAsyncHandler(inner, 2, OverflowBlock)
+	fillAsync(t, h, inner, 2)
+
+	logged := make(chan struct{})
+	go func() {
+		h.Log(&Entry{Msg: "m3"})
+		close(logged)
+	}()
+	select {
+	case <-logged:
+		t.Fatal("Log returned while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(inner.gate)
+	<-logged
+	h.Stop()
+	if got := inner.Msgs(); fmt.Sprint(got) != "[m0 m1 m2 m3]" || h.Dropped() != 0 {
+		t.Errorf("output %v dropped %d", got, h.Dropped())
+	}
+}
+
+func TestAsyncCloseDrain(t *testing.T) {
+	inner := newGateHandler()
+	h := NewAsyncHandler(inner, 100, OverflowBlock)
+	fillAsync(t, h, inner, 50)
+
+	closed := make(chan struct{})
+	go func() {
+		h.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close returned before the buffer was drained")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(inner.gate)
+	<-closed
+	if n := len(inner.Msgs()); n != 51 {
+		t.Errorf("output %d entries after close, want 51", n)
+	}
+	if !inner.closed {
+		t.Error("inner handler not closed")
+	}
+
+	//停止后同步输出
+	h.Log(&Entry{Msg: "after"})
+	if msgs := inner.Msgs(); msgs[len(msgs)-1] != "after" {
+		t.Errorf("log after close not written, last %s", msgs[len(msgs)-1])
+	}
+}
+
+func TestAsyncFlush(t *testing.T) {
+	inner := &captureHandler{}
+	h := NewAsyncHandler(inner, 16, OverflowBlock)
+	defer h.Stop()
+
+	for i := 0; i < 100; i++ {
+		h.Log(&Entry{Msg: "m"})
+	}
+	h.Flush()
+	if n := len(inner.Entries()); n != 100 {
+		t.Errorf("output %d entries after Flush, want 100", n)
+	}
+}
+
+//benchLog 通过dispatch写日记到h,跟业务代码调用日记接口的路径相同
+func benchLog(b *testing.B, h Handler) {
+	old := Handlers()
+	SetHandlers(h)
+	defer SetHandlers(old...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info("check service state", String("service", "TCS_MT4_d06f-1e8d6b745"), Int("state", i))
+	}
+	b.StopTimer()
+}
+
+//BenchmarkSyncLog 当前的同步路径:每条日记直接写按天切换的文件
+func BenchmarkSyncLog(b *testing.B) {
+	h := NewDayLogHandle(tempDir(b), 500*1024*1024)
+	defer h.close()
+	benchLog(b, h)
+}
+
+//BenchmarkAsyncLog 同样的文件日记包一层异步缓冲区,只计调用方的耗时
+func BenchmarkAsyncLog(b *testing.B) {
+	inner := NewDayLogHandle(tempDir(b), 500*1024*1024)
+	h := NewAsyncHandler(inner, 4096, OverflowBlock)
+	defer h.close()
+	benchLog(b, h)
+}
+
+//gateWriter 记录每次Write的内容,第一次Write在gate关闭前阻塞
+type gateWriter struct {
+	gate    chan struct{}
+	started chan struct{}
+	writes  []string
+	mu      sync.Mutex
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	first := len(w.writes) == 0
+	w.writes = append(w.writes, string(p))
+	w.mu.Unlock()
+	if first {
+		close(w.started)
+		<-w.gate
+	}
+	return len(p), nil
+}
+
+func (w *gateWriter) Writes() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.writes...)
+}
+
+func TestAsyncBatchWrite(t *testing.T) {
+	for _, format := range []Format{TextFormat, JSONFormat} {
+		t.Run(format.String(), func(t *testing.T) {
+			w := &gateWriter{gate: make(chan struct{}), started: make(chan struct{})}
+			inner := NewConsoleHandler()
+			inner.SetOutput(w)
+			inner.SetFormat(format)
+			h := NewAsyncHandler(inner, 64, OverflowBlock)
+			defer h.Stop()
+
+			h.Log(newEntry(INFO, 1, "m0", nil, nil))
+			select {
+			case <-w.started:
+			case <-time.After(2 * time.Second):
+				t.Fatal("writer goroutine not started")
+			}
+			for i := 1; i <= 10; i++ {
+				h.Log(newEntry(INFO, 1, fmt.Sprintf("m%d", i), nil, nil))
+			}
+			close(w.gate)
+			h.Flush()
+
+			//阻塞期间写入的10条合并成一次写入,顺序不变
+			writes := w.Writes()
+			if len(writes) != 2 {
+				t.Fatalf("%d writes, want 2: %q", len(writes), writes)
+			}
+			rest := writes[1]
+			for i := 1; i <= 10; i++ {
+				pos := strings.Index(rest, fmt.Sprintf("m%d", i))
+				if pos < 0 {
+					t.Fatalf("m%d not found in order in %q", i, writes[1])
+				}
+				rest = rest[pos+1:]
+			}
+		})
+	}
+}
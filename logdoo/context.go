@@ -0,0 +1,160 @@
+package logdoo
+
+import "time"
+
+//Context 带有固定字段的子日记,通过它输出的每条日记都会带上这些字段,nil表示没有固定字段
+type Context struct {
+	fields  []Field
+	limiter *Limiter
+}
+
+//With 创建带固定字段的子日记,参数为key,value成对出现,也可以直接传Field
+func With(kv ...interface{}) *Context {
+	return &Context{fields: toFields(nil, kv)}
+}
+
+//With 在当前子日记的字段上再增加字段,当前子日记不受影响
+func (c *Context) With(kv ...interface{}) *Context {
+	return &Context{fields: toFields(c.Fields(), kv), limiter: c.Limiter()}
+}
+
+//Limited 创建限流的子日记,同样的日记(级别+消息+字段相同)在window内只输出第一条,之后输出时带上被抑制的条数
+func Limited(window time.Duration) *Context {
+	return &Context{limiter: NewLimiter(window)}
+}
+
+//Limited 在当前子日记的基础上限流,返回的子日记以及由它With出来的子日记共用限流的状态
+func (c *Context) Limited(window time.Duration) *Context {
+	return &Context{fields: c.Fields(), limiter: NewLimiter(window)}
+}
+
+//Limiter 子日记的限流器,nil表示不限流
+func (c *Context) Limiter() *Limiter {
+	if c == nil {
+		return nil
+	}
+	return c.limiter
+}
+
+//allow 限流判断,通过时如果之前有被抑制的日记加上suppressed字段
+func (c *Context) allow(level Level, msg string, args []interface{}, fields []Field) ([]Field, bool) {
+	l := c.Limiter()
+	if l == nil {
+		return fields, true
+	}
+
+	//汇总日记的调用位置:newEntry <- 这个函数 <- Limiter.allow <- allow <- Debug/Info等 <- 调用日记接口的地方
+	ok, suppressed := l.allow(limitKey(level, msg, args, fields), func() *Entry { return newEntry(level, 5, msg, args, fields) })
+	if ok && suppressed > 0 {
+		fields = append(fields[:len(fields):len(fields)], Int("suppressed", suppressed))
+	}
+	return fields, ok
+}
+
+//Fields 子日记的固定字段
+func (c *Context) Fields() []Field {
+	if c == nil {
+		return nil
+	}
+	return c.fields
+}
+
+//toFields 把key,value参数转换成Field追加到base的拷贝后面
+func toFields(base []Field, kv []interface{}) []Field {
+	fields := make([]Field, len(base), len(base)+len(kv)/2+1)
+	copy(fields, base)
+	for i := 0; i < len(kv); i++ {
+		if f, ok := kv[i].(Field); ok {
+			fields = append(fields, f)
+			continue
+		}
+
+		key, ok := kv[i].(string)
+		if !ok || i+1 == len(kv) {
+			//不成对的参数
+			fields = append(fields, Any("!badkey", kv[i]))
+			continue
+		}
+		fields = append(fields, Any(key, kv[i+1]))
+		i++
+	}
+	return fields
+}
+
+//merge 固定字段在前,本次调用的字段在后
+func (c *Context) merge(fields []Field) []Field {
+	if len(c.Fields()) == 0 {
+		return fields
+	}
+	all := make([]Field, 0, len(c.fields)+len(fields))
+	all = append(all, c.fields...)
+	return append(all, fields...)
+}
+
+//Debug 结构化日记,带上子日记的固定字段
+func (c *Context) Debug(msg string, fields ...Field) {
+	if GetLevel() <= DEBUG {
+		if fields, ok := c.allow(DEBUG, msg, nil, c.merge(fields)); ok {
+			dispatch(newEntry(DEBUG, 2, msg, nil, fields))
+		}
+	}
+}
+
+//Info 结构化日记,带上子日记的固定字段
+func (c *Context) Info(msg string, fields ...Field) {
+	if GetLevel() <= INFO {
+		if fields, ok := c.allow(INFO, msg, nil, c.merge(fields)); ok {
+			dispatch(newEntry(INFO, 2, msg, nil, fields))
+		}
+	}
+}
+
+//Warn 结构化日记,带上子日记的固定字段
+func (c *Context) Warn(msg string, fields ...Field) {
+	if GetLevel() <= WARN {
+		if fields, ok := c.allow(WARN, msg, nil, c.merge(fields)); ok {
+			dispatch(newEntry(WARN, 2, msg, nil, fields))
+		}
+	}
+}
+
+//Error 结构化日记,带上子日记的固定字段
+func (c *Context) Error(msg string, fields ...Field) {
+	if GetLevel() <= ERROR {
+		if fields, ok := c.allow(ERROR, msg, nil, c.merge(fields)); ok {
+			dispatch(newEntry(ERROR, 2, msg, nil, fields))
+		}
+	}
+}
+
+func (c *Context) DebugDoo(v ...interface{}) {
+	if GetLevel() <= DEBUG {
+		if fields, ok := c.allow(DEBUG, "", v, c.Fields()); ok {
+			dispatch(newEntry(DEBUG, 2, "", v, fields))
+		}
+	}
+}
+
+func (c *Context) InfoDoo(v ...interface{}) {
+	if GetLevel() <= INFO {
+		if fields, ok := c.allow(INFO, "", v, c.Fields()); ok {
+			dispatch(newEntry(INFO, 2, "", v, fields))
+		}
+	}
+}
+
+func (c *Context) WarnDoo(v ...interface{}) {
+	if GetLevel() <= WARN {
+		if fields, ok := c.allow(WARN, "", v, c.Fields()); ok {
+			dispatch(newEntry(WARN, 2, "", v, fields))
+		}
+	}
+}
+
+func (c *Context) ErrorDoo(v ...interface{}) {
+	if GetLevel() <= ERROR {
+		if fields, ok := c.allow(ERROR, "", v, c.Fields()); ok {
+			dispatch(newEntry(ERROR, 2, "", v, fields))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package logdoo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Format 日记的输出格式
+type Format int32
+
+const (
+	TextFormat Format = iota
+	JSONFormat
+)
+
+//ParseFormat 把配置中的格式名(text/json)转换成Format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return TextFormat, fmt.Errorf("unknow log format %s", name)
+}
+
+func (f Format) String() string {
+	if f == JSONFormat {
+		return "json"
+	}
+	return "text"
+}
+
+func (l Level) String() string {
+	switch l {
+	case DEBUG:
+		return "debug"
+	case INFO:
+		return "info"
+	case WARN:
+		return "warn"
+	case ERROR:
+		return "error"
+	}
+	return "level" + strconv.Itoa(int(l))
+}
+
+//Entry 一条日记,由接口函数生成后分发给各个Handler按自己的格式输出
+type Entry struct {
+	Time   time.Time
+	Level  Level
+	Msg    string
+	Args   []interface{} //旧的变参接口(DebugDoo等)的参数
+	Fields []Field
+	File   string
+	Line   int
+}
+
+//newEntry 生成一条日记,calldepth为相对调用newEntry的函数往上跳过的调用层数
+func newEntry(level Level, calldepth int, msg string, args []interface{}, fields []Field) *Entry {
+	e := &Entry{Time: time.Now(), Level: level, Msg: msg, Args: args, Fields: fields}
+	var ok bool
+	if _, e.File, e.Line, ok = runtime.Caller(calldepth); !ok {
+		e.File = "???"
+		e.Line = 0
+	}
+	return redactEntry(e)
+}
+
+//Message 日记的消息内容(旧接口的参数以空格连接)
+func (e *Entry) Message() string {
+	if e.Args == nil {
+		return e.Msg
+	}
+	return strings.TrimSuffix(fmt.Sprintln(e.Args...), "\n")
+}
+
+//Caller 调用日记接口的文件名和行号
+func (e *Entry) Caller() string {
+	short := e.File
+	for i := len(e.File) - 1; i > 0; i-- {
+		if e.File[i] == '/' {
+			short = e.File[i+1:]
+			break
+		}
+	}
+	return short + ":" + strconv.Itoa(e.Line)
+}
+
+//Text 文本格式的内容(不包括时间和调用位置的头部),旧接口保持原来的输出格式
+func (e *Entry) Text() string {
+	parts := make([]interface{}, 0, len(e.Fields)+3)
+	parts = append(parts, e.Level.String())
+	if e.Args != nil {
+		parts = append(parts, e.Args)
+	} else {
+		parts = append(parts, e.Msg)
+	}
+	for _, f := range e.Fields {
+		parts = append(parts, f.Key+"="+quoteText(f.String()))
+	}
+	parts = append(parts, "\r\n")
+	return fmt.Sprintln(parts...)
+}
+
+//JSON json格式的内容,包括时间、级别、调用位置、消息以及所有字段
+func (e *Entry) JSON() string {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSONValue(&buf, e.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(&buf, e.Level.String())
+	buf.WriteString(`,"caller":`)
+	writeJSONValue(&buf, e.Caller())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(&buf, e.Message())
+	for i, f := range e.Fields {
+		//同名的字段(如子logger的字段和调用时的字段)只输出最后一个
+		if fieldOverridden(e.Fields, i) {
+			continue
+		}
+		buf.WriteByte(',')
+		writeJSONValue(&buf, jsonFieldKey(f.Key))
+		buf.WriteByte(':')
+		writeJSONValue(&buf, f.Value())
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+//jsonFieldKey 跟固定字段(time/level/caller/msg)重名的字段加上fields.前缀,避免出现重复的key
+func jsonFieldKey(key string) string {
+	switch key {
+	case "time", "level", "caller", "msg":
+		return "fields." + key
+	}
+	return key
+}
+
+//fieldOverridden fields[i]后面是否还有输出到json时同名的字段
+func fieldOverridden(fields []Field, i int) bool {
+	key := jsonFieldKey(fields[i].Key)
+	for _, f := range fields[i+1:] {
+		if jsonFieldKey(f.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+//quoteText 文本格式中包含空格等特殊字符的值加上引号
+func quoteText(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package logdoo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEntryJSONReservedKeys(t *testing.T) {
+	e := newEntry(INFO, 1, "hello", nil, []Field{
+		String("time", "user time"),
+		String("level", "user level"),
+		String("msg", "user msg"),
+		String("caller", "user caller"),
+		String("service", "Doo"),
+	})
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(e.JSON()), &m); err != nil {
+		t.Fatalf("unmarshal %s err:%s", e.JSON(), err)
+	}
+	if m["msg"] != "hello" || m["level"] != "info" {
+		t.Fatalf("fixed keys overridden: %v", m)
+	}
+	for _, key := range []string{"time", "level", "msg", "caller"} {
+		if m["fields."+key] != "user "+key {
+			t.Errorf("field %s = %v, want renamed to fields.%s", key, m["fields."+key], key)
+		}
+	}
+	if m["service"] != "Doo" {
+		t.Errorf("service = %v", m["service"])
+	}
+}
+
+func TestEntryJSONDuplicateKeys(t *testing.T) {
+	c := With("service", "Doo", "worker", 1)
+	e := newEntry(INFO, 1, "hello", nil, c.merge([]Field{String("service", "Foo"), String("fields.msg", "a"), String("msg", "b")}))
+
+	data := e.JSON()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatalf("unmarshal %s err:%s", data, err)
+	}
+	if m["service"] != "Foo" || m["worker"] != float64(1) || m["fields.msg"] != "b" {
+		t.Errorf("fields %v, want the last one", m)
+	}
+	for _, key := range []string{`"service"`, `"fields.msg"`} {
+		if n := strings.Count(data, key); n != 1 {
+			t.Errorf("%s appears %d times in %s", key, n, data)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package logdoo
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type FieldType int32
+
+const (
+	StringType FieldType = iota
+	IntType
+	FloatType
+	BoolType
+	DurationType
+	TimeType
+	ErrorType
+	AnyType
+)
+
+//Field 结构化日记的key/value字段
+type Field struct {
+	Key   string
+	Type  FieldType
+	Str   string
+	Int   int64
+	Float float64
+	Any   interface{}
+}
+
+//String 字符串字段
+func String(key, value string) Field {
+	return Field{Key: key, Type: StringType, Str: value}
+}
+
+//Int 整数字段
+func Int(key string, value int) Field {
+	return Field{Key: key, Type: IntType, Int: int64(value)}
+}
+
+//Int64 整数字段
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Type: IntType, Int: value}
+}
+
+//Float64 浮点数字段
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Type: FloatType, Float: value}
+}
+
+//Bool 布尔字段
+func Bool(key string, value bool) Field {
+	var i int64
+	if value {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolType, Int: i}
+}
+
+//Duration 时间间隔字段
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Int: int64(value)}
+}
+
+//Time 时间字段
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Type: TimeType, Any: value}
+}
+
+//Err 错误字段,key固定为error
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Type: AnyType, Any: nil}
+	}
+	return Field{Key: "error", Type: ErrorType, Str: err.Error()}
+}
+
+//Any 任意类型的字段,根据值的类型转换成对应的字段
+func Any(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint32:
+		return Int64(key, int64(v))
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return Field{Key: key, Type: ErrorType, Str: v.Error()}
+	}
+	return Field{Key: key, Type: AnyType, Any: value}
+}
+
+//Value 字段的值(用于json编码)
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case StringType, ErrorType:
+		return f.Str
+	case IntType:
+		return f.Int
+	case FloatType:
+		return f.Float
+	case BoolType:
+		return f.Int == 1
+	case DurationType:
+		return time.Duration(f.Int).String()
+	case TimeType:
+		return f.Any.(time.Time).Format(time.RFC3339Nano)
+	}
+	return f.Any
+}
+
+//String 字段值的文本形式
+func (f Field) String() string {
+	switch f.Type {
+	case StringType, ErrorType:
+		return f.Str
+	case IntType:
+		return strconv.FormatInt(f.Int, 10)
+	case FloatType:
+		return strconv.FormatFloat(f.Float, 'g', -1, 64)
+	case BoolType:
+		return strconv.FormatBool(f.Int == 1)
+	case DurationType:
+		return time.Duration(f.Int).String()
+	case TimeType:
+		return f.Any.(time.Time).Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(f.Any)
+}
@@ -0,0 +1,158 @@
+package logdoo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//JournaldSocket systemd-journald接收原生协议日记的socket
+const JournaldSocket = "/run/systemd/journal/socket"
+
+//JournaldHandler 按journald原生协议发送日记,结构化字段会转换成大写的journal字段
+type JournaldHandler struct {
+	LogHandler
+	path       string
+	identifier string
+	conn       *net.UnixConn
+	mu         sync.Mutex
+}
+
+//NewJournaldHandler New一个journald日记,path为空时使用JournaldSocket
+func NewJournaldHandler(path, identifier string) (*JournaldHandler, error) {
+	if path == "" {
+		path = JournaldSocket
+	}
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &JournaldHandler{
+		LogHandler: LogHandler{lg: New(ioutil.Discard, "", 0)},
+		path:       path,
+		identifier: identifier,
+		conn:       conn,
+	}, nil
+}
+
+//JournaldAvailable 本机是否运行着journald
+func JournaldAvailable() bool {
+	_, err := os.Stat(JournaldSocket)
+	return err == nil
+}
+
+//Log 发送一条日记,发送失败时重新连接再发送一次
+func (h *JournaldHandler) Log(e *Entry) {
+	var buf bytes.Buffer
+	journalField(&buf, "MESSAGE", e.Message())
+	journalField(&buf, "PRIORITY", strconv.Itoa(Severity(e.Level)))
+	journalField(&buf, "SYSLOG_IDENTIFIER", h.identifier)
+	journalField(&buf, "CODE_FILE", e.File)
+	journalField(&buf, "CODE_LINE", strconv.Itoa(e.Line))
+	for _, f := range e.Fields {
+		journalField(&buf, journalFieldName(f.Key), f.String())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		if _, err := h.conn.Write(buf.Bytes()); err == nil {
+			return
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: h.path, Net: "unixgram"})
+	if err != nil {
+		Println("journald connect", h.path, "err", err)
+		return
+	}
+	h.conn = conn
+	if _, err := h.conn.Write(buf.Bytes()); err != nil {
+		Println("journald write", h.path, "err", err)
+	}
+}
+
+//journalField 写一个字段,值包含换行时用二进制格式:KEY\n + 8字节小端长度 + 值 + \n
+func journalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+
+	buf.WriteString(key + "\n")
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value + "\n")
+}
+
+//journalReserved 日记本身使用的以及journald有特殊含义的字段,用户字段重名时加上F_前缀
+var journalReserved = map[string]bool{
+	"MESSAGE": true, "MESSAGE_ID": true, "PRIORITY": true, "ERRNO": true,
+	"CODE_FILE": true, "CODE_LINE": true, "CODE_FUNC": true,
+	"SYSLOG_IDENTIFIER": true, "SYSLOG_FACILITY": true, "SYSLOG_PID": true, "SYSLOG_TIMESTAMP": true,
+}
+
+//journalFieldName journal字段名只能是大写字母、数字和下划线,不能以下划线或数字开头,也不能跟保留的字段重名
+func journalFieldName(key string) string {
+	b := make([]byte, 0, len(key))
+	for _, c := range strings.ToUpper(key) {
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b = append(b, byte(c))
+		} else {
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 || b[0] == '_' || (b[0] >= '0' && b[0] <= '9') || journalReserved[string(b)] {
+		b = append([]byte("F_"), b...)
+	}
+	return string(b)
+}
+
+func (h *JournaldHandler) Output(calldepth int, s string) error {
+	h.Log(newEntry(INFO, calldepth+1, s, nil, nil))
+	return nil
+}
+
+func (h *JournaldHandler) DebugDoo(v ...interface{}) {
+	h.Log(newEntry(DEBUG, 2, "", v, nil))
+}
+
+func (h *JournaldHandler) InfoDoo(v ...interface{}) {
+	h.Log(newEntry(INFO, 2, "", v, nil))
+}
+
+func (h *JournaldHandler) WarnDoo(v ...interface{}) {
+	h.Log(newEntry(WARN, 2, "", v, nil))
+}
+
+func (h *JournaldHandler) ErrorDoo(v ...interface{}) {
+	h.Log(newEntry(ERROR, 2, "", v, nil))
+}
+
+//Close 关闭连接
+func (h *JournaldHandler) Close() {
+	h.close()
+}
+
+func (h *JournaldHandler) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+}
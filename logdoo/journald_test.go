@@ -0,0 +1,95 @@
+package logdoo
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//listenJournald 在临时目录监听一个unixgram socket代替journald
+func listenJournald(t *testing.T) (*net.UnixConn, string) {
+	dir, err := ioutil.TempDir("", "journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram not supported: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+func TestJournaldReservedFields(t *testing.T) {
+	conn, path := listenJournald(t)
+	h, err := NewJournaldHandler(path, "gomonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.Log(newEntry(WARN, 1, "real message", nil, []Field{
+		String("message", "fake message"),
+		String("priority", "0"),
+		String("service", "Doo"),
+	}))
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSuffix(string(buf[:n]), "\n"), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			t.Fatalf("unexpected line %q", line)
+		}
+		fields[kv[0]] = append(fields[kv[0]], kv[1])
+	}
+
+	want := map[string]string{
+		"MESSAGE":           "real message",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "gomonitor",
+		"F_MESSAGE":         "fake message",
+		"F_PRIORITY":        "0",
+		"SERVICE":           "Doo",
+	}
+	for key, value := range want {
+		if got := fields[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("%s = %q, want [%q]", key, got, value)
+		}
+	}
+}
+
+func TestJournaldMultilineField(t *testing.T) {
+	conn, path := listenJournald(t)
+	h, err := NewJournaldHandler(path, "gomonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.Log(newEntry(INFO, 1, "line1\nline2", nil, nil))
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MESSAGE\n\x0b\x00\x00\x00\x00\x00\x00\x00line1\nline2\n"
+	if !strings.HasPrefix(string(buf[:n]), want) {
+		t.Errorf("packet %q, want prefix %q", buf[:n], want)
+	}
+}
@@ -0,0 +1,128 @@
+package logdoo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//limitPruneSize 限流状态超过这个数量时清理过期的状态
+const limitPruneSize = 1024
+
+//Limiter 日记限流器,同一个key在window内只放行第一次,之后放行时返回期间被抑制的次数;
+//被抑制后一直没有再出现的日记,window结束时由定时器输出一条带suppressed的汇总
+type Limiter struct {
+	window time.Duration
+	seen   map[string]*limitState
+	timer  *time.Timer //等待输出汇总的定时器,没有被抑制的日记时为nil
+	mu     sync.Mutex
+}
+
+type limitState struct {
+	last       time.Time //最近一次放行的时间
+	suppressed int
+	summary    *Entry //被抑制的日记,用于输出汇总
+}
+
+//NewLimiter New一个限流器
+func NewLimiter(window time.Duration) *Limiter {
+	return &Limiter{window: window, seen: make(map[string]*limitState)}
+}
+
+//Allow 判断key是否放行,放行时suppressed为上次放行之后被抑制的次数
+func (l *Limiter) Allow(key string) (ok bool, suppressed int) {
+	return l.allow(key, nil)
+}
+
+//allow 同Allow,第一次被抑制时通过entry生成汇总使用的日记
+func (l *Limiter) allow(key string, entry func() *Entry) (ok bool, suppressed int) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st, exist := l.seen[key]
+	if exist && now.Sub(st.last) < l.window {
+		if st.suppressed == 0 && entry != nil {
+			st.summary = entry()
+			if l.timer == nil {
+				l.timer = time.AfterFunc(st.last.Add(l.window).Sub(now), l.flush)
+			}
+		}
+		st.suppressed++
+		return false, 0
+	}
+
+	if !exist {
+		if len(l.seen) >= limitPruneSize {
+			l.prune(now)
+		}
+		st = &limitState{}
+		l.seen[key] = st
+	}
+	suppressed = st.suppressed
+	st.last, st.suppressed, st.summary = now, 0, nil
+	return true, suppressed
+}
+
+//flush 输出已经过了window但是一直没有再放行的日记的汇总,还有没到期的时重新设置定时器
+func (l *Limiter) flush() {
+	now := time.Now()
+	var entries []*Entry
+	var next time.Duration
+
+	l.mu.Lock()
+	l.timer = nil
+	for _, st := range l.seen {
+		if st.summary == nil {
+			continue
+		}
+		if wait := st.last.Add(l.window).Sub(now); wait > 0 {
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+		e := st.summary
+		e.Time = now
+		e.Fields = append(e.Fields[:len(e.Fields):len(e.Fields)], Int("suppressed", st.suppressed))
+		entries = append(entries, e)
+		st.suppressed, st.summary = 0, nil
+	}
+	if next > 0 {
+		l.timer = time.AfterFunc(next, l.flush)
+	}
+	l.mu.Unlock()
+
+	for _, e := range entries {
+		dispatch(e)
+	}
+}
+
+//prune 清理过了window并且没有被抑制的日记的状态
+func (l *Limiter) prune(now time.Time) {
+	for key, st := range l.seen {
+		if st.suppressed == 0 && now.Sub(st.last) >= l.window {
+			delete(l.seen, key)
+		}
+	}
+}
+
+//limitKey 限流的key:级别+消息(旧接口为参数)+所有字段
+func limitKey(level Level, msg string, args []interface{}, fields []Field) string {
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte('|')
+	if args != nil {
+		b.WriteString(fmt.Sprint(args...))
+	} else {
+		b.WriteString(msg)
+	}
+	for _, f := range fields {
+		b.WriteByte('|')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
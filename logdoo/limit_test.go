@@ -0,0 +1,111 @@
+package logdoo
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//captureHandler 记录收到的日记,用于测试
+type captureHandler struct {
+	LogHandler
+	entries []*Entry
+	mu      sync.Mutex
+}
+
+func (h *captureHandler) Log(e *Entry) {
+	h.mu.Lock()
+	h.entries = append(h.entries, e)
+	h.mu.Unlock()
+}
+
+func (h *captureHandler) Entries() []*Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Entry(nil), h.entries...)
+}
+
+//useCapture 把日记只输出到captureHandler,测试结束后恢复
+func useCapture(t *testing.T) *captureHandler {
+	old := Handlers()
+	h := &captureHandler{}
+	SetHandlers(h)
+	t.Cleanup(func() { SetHandlers(old...) })
+	return h
+}
+
+func suppressedField(e *Entry) (int, bool) {
+	for _, f := range e.Fields {
+		if f.Key == "suppressed" {
+			n, ok := f.Value().(int64)
+			return int(n), ok
+		}
+	}
+	return 0, false
+}
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter(50 * time.Millisecond)
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first a not allowed")
+	}
+	for i := 0; i < 4; i++ {
+		if ok, _ := l.Allow("a"); ok {
+			t.Fatal("a allowed in window")
+		}
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("first b not allowed")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, n := l.Allow("a"); !ok || n != 4 {
+		t.Errorf("a after window = %v %d, want true 4", ok, n)
+	}
+	if ok, n := l.Allow("b"); !ok || n != 0 {
+		t.Errorf("b after window = %v %d, want true 0", ok, n)
+	}
+}
+
+func TestLimitedFlushSummary(t *testing.T) {
+	h := useCapture(t)
+	log := Limited(50 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		log.Error("connect fail", String("addr", "a"))
+	}
+	log.Error("connect fail", String("addr", "b"))
+
+	//重复的日记停止后,window结束时输出汇总
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.Entries()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries := h.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 2 first entries and 1 summary", len(entries))
+	}
+
+	summary := entries[2]
+	if n, ok := suppressedField(summary); !ok || n != 2 {
+		t.Errorf("summary suppressed = %d %v, want 2", n, ok)
+	}
+	if summary.Msg != "connect fail" || summary.Level != ERROR || !strings.HasSuffix(summary.File, "limit_test.go") {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	//汇总之后不会再重复输出
+	time.Sleep(120 * time.Millisecond)
+	if n := len(h.Entries()); n != 3 {
+		t.Errorf("got %d entries after summary, want 3", n)
+	}
+
+	//汇总之后再出现时正常输出,不再带suppressed
+	log.Error("connect fail", String("addr", "a"))
+	entries = h.Entries()
+	if _, ok := suppressedField(entries[len(entries)-1]); ok || len(entries) != 4 {
+		t.Errorf("entries after summary = %d, last %+v", len(entries), entries[len(entries)-1])
+	}
+}
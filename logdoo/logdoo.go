@@ -6,7 +6,7 @@ import (
 	"os"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 type Level int32
@@ -64,6 +64,9 @@ type Handler interface {
 	WarnDoo(v ...interface{})
 	ErrorDoo(v ...interface{})
 
+	//Log 按Handler自己的格式输出一条日记
+	Log(e *Entry)
+
 	Flags() int
 	SetFlags(flag int)
 	Prefix() string
@@ -71,8 +74,27 @@ type Handler interface {
 	close()
 }
 
+//FormatHandler 支持text/json两种输出格式的Handler(可选,没有实现的Handler按自己的方式输出)
+type FormatHandler interface {
+	Format() Format
+	SetFormat(f Format)
+}
+
+//LevelHandler 有自己最低输出级别的Handler(可选,没有实现的Handler输出所有级别)
+type LevelHandler interface {
+	Level() Level
+	SetLevel(level Level)
+}
+
+//BatchHandler 能把一批日记合并成一次写入的Handler(可选,异步日记取出的一批日记优先通过它输出)
+type BatchHandler interface {
+	LogBatch(entries []*Entry)
+}
+
 type LogHandler struct {
-	lg *Logger
+	lg     *Logger
+	format Format
+	level  Level
 }
 
 type ConsoleHander struct {
@@ -84,15 +106,15 @@ type FileHandler struct {
 	logfile *os.File
 }
 
+//RotatingHandler 通过Rotator按时间或大小切换文件的日记
 type RotatingHandler struct {
 	LogHandler
-	dir      string
-	filename string
-	maxNum   int
-	maxSize  int64
-	suffix   int
-	logfile  *os.File
-	mu       sync.Mutex
+	rotator      *Rotator
+	retention    Retention
+	cleaning     int32    //是否正在清理旧文件
+	cleanPending int32    //是否有等待进行的清理
+	rotated      []string //切换下来等待压缩的文件
+	mu           sync.Mutex
 }
 
 //LogInfo 存储日记文件信息
@@ -111,80 +133,60 @@ func init() {
 //NewConsoleHandler New一个控制台日记变量
 func NewConsoleHandler() *ConsoleHander {
 	l := New(os.Stderr, "", Ltime|Lmicroseconds|Lshortfile)
-	return &ConsoleHander{LogHandler: LogHandler{l}}
+	return &ConsoleHander{LogHandler: LogHandler{lg: l}}
 }
 
 func NewFileHandler(filepath string) *FileHandler {
 	logfile, _ := os.OpenFile(filepath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
 	l := New(logfile, "", LstdFlags)
 	return &FileHandler{
-		LogHandler: LogHandler{l},
+		LogHandler: LogHandler{lg: l},
 		logfile:    logfile,
 	}
 }
 
+//NewRotatingHandler 固定文件名的日记,超过maxSize时旧文件依次改名为filename.1.log...filename.maxNum.log
 func NewRotatingHandler(dir string, filename string, maxNum int, maxSize int64) *RotatingHandler {
-	logfile, _ := os.OpenFile(dir+"/"+filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
-	l := New(logfile, "", LstdFlags)
-
-	h := &RotatingHandler{
-		LogHandler: LogHandler{l},
-		dir:        dir,
-		filename:   filename,
-		maxNum:     maxNum,
-		maxSize:    maxSize,
-		suffix:     0,
+	if maxNum <= 0 {
+		maxNum = 1
 	}
-
-	if h.isMustRename() {
-		h.rename()
-	} else {
-		h.mu.Lock()
-		defer h.mu.Unlock()
-		h.lg.SetOutput(logfile)
+	r := NewRotator(dir, FixedPattern(filename), RotateNone, maxSize, maxNum)
+	return &RotatingHandler{
+		LogHandler: LogHandler{lg: New(r, "", LstdFlags)},
+		rotator:    r,
 	}
-
-	// monitor filesize per second
-	go func() {
-		timer := time.NewTicker(1 * time.Second)
-		for {
-			select {
-			case <-timer.C:
-				h.fileCheck()
-			}
-		}
-	}()
-
-	return h
 }
 
-//NewDayLogHandle 创建每天日记文件
+//NewDayLogHandle 创建每天日记文件,同一天超过maxSize时再分割成YYYYMMDD_N.log
 func NewDayLogHandle(dir string, maxSize int64) *RotatingHandler {
+	r := NewRotator(dir, DayPattern, RotateDaily, maxSize, 0)
 	h := &RotatingHandler{
-		LogHandler: LogHandler{nil},
-		dir:        dir,
-		maxNum:     1,
-		maxSize:    maxSize,
-		suffix:     0,
+		LogHandler: LogHandler{lg: New(r, "", Ltime|Lmicroseconds|Lshortfile)},
+		rotator:    r,
 	}
-
+	//切换文件后按保留策略压缩和删除旧文件
+	r.OnRotate(h.onRotate)
 	return h
 }
 
 func SetDayLogHandleDir(path string) {
-	LogInfo.mu.Lock()
-	LogInfo.dir = path
-	LogInfo.mu.Unlock()
+	LogInfo.rotator.SetDir(path)
 }
 
 func SetDayLogHandleFileSize(size int64) {
 	if size <= 0 {
 		return
 	}
+	LogInfo.rotator.SetMaxSize(size * 1024 * 1024)
+}
 
-	LogInfo.mu.Lock()
-	LogInfo.maxSize = size * 1024 * 1024
-	LogInfo.mu.Unlock()
+//SetDayLogRotate 设置每天日记文件的切换方式,按小时切换时文件名为YYYYMMDDHH.log
+func SetDayLogRotate(policy RotatePolicy) {
+	pattern := DayPattern
+	if policy == RotateHourly {
+		pattern = HourPattern
+	}
+	LogInfo.rotator.SetPolicy(policy, pattern)
 }
 
 /*
@@ -236,139 +238,104 @@ func (l *LogHandler) SetPrefix(prefix string) {
 	l.lg.SetPrefix(prefix)
 }
 
-func (l *LogHandler) DebugDoo(v ...interface{}) {
-	LogInfo.RenameDoo()
-	l.lg.Output(3, fmt.Sprintln("debug", v, "\r\n"))
+func (l *LogHandler) Format() Format {
+	return Format(atomic.LoadInt32((*int32)(&l.format)))
 }
 
-func (l *LogHandler) InfoDoo(v ...interface{}) {
-
-	LogInfo.RenameDoo()
-	l.lg.OutputNoCallDep(fmt.Sprintln("info", v, "\r\n"))
+func (l *LogHandler) SetFormat(f Format) {
+	atomic.StoreInt32((*int32)(&l.format), int32(f))
 }
 
-func (l *LogHandler) WarnDoo(v ...interface{}) {
-	LogInfo.RenameDoo()
-	l.lg.Output(3, fmt.Sprintln("warn", v, "\r\n"))
+func (l *LogHandler) Level() Level {
+	return Level(atomic.LoadInt32((*int32)(&l.level)))
 }
 
-func (l *LogHandler) ErrorDoo(v ...interface{}) {
-	LogInfo.RenameDoo()
-	l.lg.Output(3, fmt.Sprintln("error", v, "\r\n"))
+func (l *LogHandler) SetLevel(level Level) {
+	atomic.StoreInt32((*int32)(&l.level), int32(level))
 }
 
-//RenameDoo 操作当前日记文件的名字
-func (h *RotatingHandler) RenameDoo() {
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
+//Log 按当前格式输出一条日记
+func (l *LogHandler) Log(e *Entry) {
+	l.output(l.lg, e)
+}
 
-	if h.maxSize <= 0 {
+//logBatch 按当前格式把一批日记格式化到同一个缓冲区,只写一次
+func (l *LogHandler) logBatch(entries []*Entry) {
+	if l.lg == nil || len(entries) == 0 {
 		return
 	}
+	l.lg.OutputEntries(entries, l.Format())
+}
 
-	now := time.Now() // get this early.
-	year, month, day := now.Date()
-	fileName := fmt.Sprintf("%d%02d%02d.log", year, month, day)
+func (l *LogHandler) output(lg *Logger, e *Entry) {
+	if lg == nil {
+		return
+	}
 
-	//是当天的分割文件
-	if strings.Contains(h.filename, "_") && isExist(fileName) {
-		fileName = h.filename
+	if l.Format() == JSONFormat {
+		lg.OutputRaw(e.JSON())
+	} else {
+		lg.OutputAt(e.Time, e.File, e.Line, e.Text())
 	}
+}
 
-	//文件超过最大限制新建一个后缀文件
-	if isExist(h.dir+"/"+fileName) && fileSize(h.dir+"/"+fileName) >= h.maxSize {
+func (l *LogHandler) DebugDoo(v ...interface{}) {
+	l.Log(newEntry(DEBUG, 2, "", v, nil))
+}
 
-	LOOP: //如果对应的后缀文件已经存在就继续累计后缀
-		if isExist(h.dir+"/"+fileName) && fileSize(h.dir+"/"+fileName) >= h.maxSize {
-			h.suffix++
-			fileName = fmt.Sprintf("%d%02d%02d_%d.log", year, month, day, h.suffix)
-			goto LOOP
-		}
+func (l *LogHandler) InfoDoo(v ...interface{}) {
+	l.Log(newEntry(INFO, 2, "", v, nil))
+}
 
-		logfile, _ := os.OpenFile(h.dir+"/"+fileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
-		l := New(logfile, "", Ltime|Lmicroseconds|Lshortfile)
-		h.lg = l
-		h.filename = fileName
-		if h.logfile != nil {
-			h.logfile.Close()
-			h.logfile = logfile
-		}
-		h.lg.SetOutput(logfile)
-		return
-	}
+func (l *LogHandler) WarnDoo(v ...interface{}) {
+	l.Log(newEntry(WARN, 2, "", v, nil))
+}
 
-	//每天一个文件
-	if !isExist(h.dir+"/"+fileName) || h.lg == nil {
-		logfile, _ := os.OpenFile(h.dir+"/"+fileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
-		l := New(logfile, "", Ltime|Lmicroseconds|Lshortfile)
-		h.lg = l
-		h.filename = fileName
-		if h.logfile != nil {
-			h.logfile.Close()
-			h.logfile = logfile
-		}
-		h.lg.SetOutput(logfile)
-		return
-	}
+func (l *LogHandler) ErrorDoo(v ...interface{}) {
+	l.Log(newEntry(ERROR, 2, "", v, nil))
+}
 
+//Rotator 切换文件的Rotator,可以通过它添加切换后的回调
+func (h *RotatingHandler) Rotator() *Rotator {
+	return h.rotator
 }
 
-func (l *LogHandler) close() {
+//RenameDoo 兼容旧接口,文件的切换已经在写入时由Rotator完成
+func (h *RotatingHandler) RenameDoo() {
+}
 
+//Stop 停止Rotator的协程
+func (h *RotatingHandler) Stop() {
+	h.rotator.Stop()
 }
 
-func (h *FileHandler) close() {
-	if h.logfile != nil {
-		h.logfile.Close()
-	}
+func (l *LogHandler) close() {
+
 }
 
-func (h *RotatingHandler) close() {
-	if h.logfile != nil {
-		h.logfile.Close()
-	}
+//LogBatch 一批日记合并成一次写入
+func (h *ConsoleHander) LogBatch(entries []*Entry) {
+	h.logBatch(entries)
 }
 
-func (h *RotatingHandler) isMustRename() bool {
-	if h.maxNum > 1 {
-		if fileSize(h.dir+"/"+h.filename) >= h.maxSize {
-			return true
-		}
-	}
-	return false
+//LogBatch 一批日记合并成一次写入
+func (h *FileHandler) LogBatch(entries []*Entry) {
+	h.logBatch(entries)
 }
 
-func (h *RotatingHandler) rename() {
-	h.suffix = h.suffix%h.maxNum + 1
+//LogBatch 一批日记合并成一次写入文件
+func (h *RotatingHandler) LogBatch(entries []*Entry) {
+	h.logBatch(entries)
+}
 
+func (h *FileHandler) close() {
 	if h.logfile != nil {
 		h.logfile.Close()
 	}
-
-	newpath := fmt.Sprintf("%s/%s.%d.log", h.dir, h.filename, h.suffix)
-	if isExist(newpath) {
-		os.Remove(newpath)
-	}
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	filepath := h.dir + "/" + h.filename
-	os.Rename(filepath, newpath)
-	h.logfile, _ = os.Create(filepath)
-	h.lg.SetOutput(h.logfile)
 }
 
-func (h *RotatingHandler) fileCheck() {
-	defer func() {
-		if err := recover(); err != nil {
-			Println(err)
-		}
-	}()
-	if h.isMustRename() {
-		h.rename()
-	}
+func (h *RotatingHandler) close() {
+	h.rotator.Close()
 }
 
 /*
@@ -379,7 +346,7 @@ func (h *RotatingHandler) fileCheck() {
 type _Logger struct {
 	handlers []Handler
 	level    Level
-	mu       sync.Mutex
+	mu       sync.RWMutex
 }
 
 var logger = &_Logger{
@@ -391,47 +358,130 @@ var logger = &_Logger{
 
 //SetHandlers 设置打印日记变量
 func SetHandlers(handlers ...Handler) {
+	logger.mu.Lock()
 	logger.handlers = handlers
+	logger.mu.Unlock()
+}
+
+//AddHandler 添加一个打印日记变量
+func AddHandler(h Handler) {
+	logger.mu.Lock()
+	logger.handlers = append(logger.handlers, h)
+	logger.mu.Unlock()
+}
+
+//RemoveHandler 移除一个打印日记变量(不会关闭它)
+func RemoveHandler(h Handler) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	handlers := make([]Handler, 0, len(logger.handlers))
+	for _, v := range logger.handlers {
+		if v != h {
+			handlers = append(handlers, v)
+		}
+	}
+	logger.handlers = handlers
+}
+
+//Handlers 当前所有的打印日记变量
+func Handlers() []Handler {
+	logger.mu.RLock()
+	defer logger.mu.RUnlock()
+	return logger.handlers
 }
 
+//SetLevel 设置全局的最低输出级别(各Handler还会按自己的级别过滤)
 func SetLevel(level Level) {
-	logger.level = level
+	atomic.StoreInt32((*int32)(&logger.level), int32(level))
 }
 
-func DebugDoo(v ...interface{}) {
-	if logger.level <= DEBUG {
-		for i := range logger.handlers {
-			logger.handlers[i].DebugDoo(v...)
+//GetLevel 获取全局的最低输出级别
+func GetLevel() Level {
+	return Level(atomic.LoadInt32((*int32)(&logger.level)))
+}
+
+//ParseLevel 把配置中的级别名(debug/info/warn/error)转换成Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	}
+	return DEBUG, fmt.Errorf("unknow log level %s", name)
+}
+
+//dispatch 把日记分发给级别满足的Handler
+func dispatch(e *Entry) {
+	//SetHandlers等都是整体替换切片,这里拿到的切片不会再被修改
+	handlers := Handlers()
+	for i := range handlers {
+		if lh, ok := handlers[i].(LevelHandler); ok && e.Level < lh.Level() {
+			continue
 		}
+		handlers[i].Log(e)
+	}
+}
+
+func DebugDoo(v ...interface{}) {
+	if GetLevel() <= DEBUG {
+		dispatch(newEntry(DEBUG, 2, "", v, nil))
 	}
 }
 
 func InfoDoo(v ...interface{}) {
-	if logger.level <= INFO {
-		for i := range logger.handlers {
-			logger.handlers[i].InfoDoo(v...)
-		}
+	if GetLevel() <= INFO {
+		dispatch(newEntry(INFO, 2, "", v, nil))
 	}
 }
 
 func WarnDoo(v ...interface{}) {
-	if logger.level <= WARN {
-		for i := range logger.handlers {
-			logger.handlers[i].WarnDoo(v...)
-		}
+	if GetLevel() <= WARN {
+		dispatch(newEntry(WARN, 2, "", v, nil))
 	}
 }
 
 func ErrorDoo(v ...interface{}) {
-	if logger.level <= ERROR {
-		for i := range logger.handlers {
-			logger.handlers[i].ErrorDoo(v...)
-		}
+	if GetLevel() <= ERROR {
+		dispatch(newEntry(ERROR, 2, "", v, nil))
+	}
+}
+
+//Debug 结构化日记,msg为固定的消息,变化的内容放在fields中
+func Debug(msg string, fields ...Field) {
+	if GetLevel() <= DEBUG {
+		dispatch(newEntry(DEBUG, 2, msg, nil, fields))
+	}
+}
+
+//Info 结构化日记
+func Info(msg string, fields ...Field) {
+	if GetLevel() <= INFO {
+		dispatch(newEntry(INFO, 2, msg, nil, fields))
+	}
+}
+
+//Warn 结构化日记
+func Warn(msg string, fields ...Field) {
+	if GetLevel() <= WARN {
+		dispatch(newEntry(WARN, 2, msg, nil, fields))
+	}
+}
+
+//Error 结构化日记
+func Error(msg string, fields ...Field) {
+	if GetLevel() <= ERROR {
+		dispatch(newEntry(ERROR, 2, msg, nil, fields))
 	}
 }
 
 func Close() {
-	for i := range logger.handlers {
-		logger.handlers[i].close()
+	handlers := Handlers()
+	for i := range handlers {
+		handlers[i].close()
 	}
 }
@@ -0,0 +1,69 @@
+package logdoo
+
+import "testing"
+
+//plainHandler 没有实现LevelHandler/FormatHandler的Handler
+type plainHandler struct {
+	Handler
+	capture *captureHandler
+}
+
+func (h *plainHandler) Log(e *Entry) {
+	h.capture.Log(e)
+}
+
+func (h *plainHandler) close() {}
+
+func TestDispatchOptionalInterfaces(t *testing.T) {
+	leveled := useCapture(t)
+	leveled.SetLevel(WARN)
+	plain := &plainHandler{capture: &captureHandler{}}
+	SetHandlers(leveled, plain)
+
+	Debug("debug")
+	Warn("warn")
+	if n := len(plain.capture.Entries()); n != 2 {
+		t.Errorf("handler without level got %d entries, want all 2", n)
+	}
+	if n := len(leveled.Entries()); n != 1 {
+		t.Errorf("handler with level warn got %d entries, want 1", n)
+	}
+
+	async := NewAsyncHandler(plain, 16, OverflowBlock)
+	defer async.close()
+	async.SetLevel(ERROR)
+	async.SetFormat(JSONFormat)
+	if async.Level() != DEBUG || async.Format() != TextFormat {
+		t.Errorf("async over plain handler level %s format %s", async.Level(), async.Format())
+	}
+}
+
+func TestDispatchHandlerLevel(t *testing.T) {
+	info := useCapture(t)
+	info.SetLevel(INFO)
+	errs := &captureHandler{}
+	errs.SetLevel(ERROR)
+	SetHandlers(info, errs)
+
+	Debug("debug")
+	Info("info")
+	WarnDoo("warn")
+	Error("error")
+	if n := len(info.Entries()); n != 3 {
+		t.Errorf("info handler got %d entries, want 3", n)
+	}
+	if e := errs.Entries(); len(e) != 1 || e[0].Msg != "error" {
+		t.Errorf("error handler got %d entries, want only error", len(e))
+	}
+
+	//全局级别先过滤,Handler的级别再过滤
+	old := GetLevel()
+	SetLevel(WARN)
+	defer SetLevel(old)
+	errs.SetLevel(DEBUG)
+	Info("info")
+	Warn("warn")
+	if n := len(errs.Entries()); n != 2 {
+		t.Errorf("debug handler got %d entries under global warn, want 2", n)
+	}
+}
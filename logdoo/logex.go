@@ -150,21 +150,28 @@ func (l *Logger) Output(calldepth int, s string) error {
 	now := time.Now() // get this early.
 	var file string
 	var line int
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.flag&(Lshortfile|Llongfile) != 0 {
-		// Release lock while getting caller info - it's expensive.
-		l.mu.Unlock()
+	if l.Flags()&(Lshortfile|Llongfile) != 0 {
 		var ok bool
 		_, file, line, ok = runtime.Caller(calldepth)
 		if !ok {
 			file = "???"
 			line = 0
 		}
-		l.mu.Lock()
 	}
+	return l.OutputAt(now, file, line, s)
+}
+
+func (l *Logger) OutputNoCallDep(s string) error {
+	return l.OutputAt(time.Now(), "", 0, s)
+}
+
+// OutputAt writes the output for a logging event whose time and caller
+// have already been recorded, e.g. by an Entry.
+func (l *Logger) OutputAt(t time.Time, file string, line int, s string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	l.buf = l.buf[:0]
-	l.formatHeader(&l.buf, now, file, line)
+	l.formatHeader(&l.buf, t, file, line)
 	l.buf = append(l.buf, s...)
 	if len(s) == 0 || s[len(s)-1] != '\n' {
 		l.buf = append(l.buf, '\n')
@@ -173,15 +180,12 @@ func (l *Logger) Output(calldepth int, s string) error {
 	return err
 }
 
-func (l *Logger) OutputNoCallDep(s string) error {
-	now := time.Now() // get this early.
-	var file string
-	var line int
+// OutputRaw writes s without any header, used by formats that carry
+// their own time and caller such as JSON.
+func (l *Logger) OutputRaw(s string) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.buf = l.buf[:0]
-	l.formatHeader(&l.buf, now, file, line)
-	l.buf = append(l.buf, s...)
+	l.buf = append(l.buf[:0], s...)
 	if len(s) == 0 || s[len(s)-1] != '\n' {
 		l.buf = append(l.buf, '\n')
 	}
@@ -189,6 +193,29 @@ func (l *Logger) OutputNoCallDep(s string) error {
 	return err
 }
 
+// OutputEntries writes a batch of entries with a single Write call, each one
+// formatted as OutputAt (text) or OutputRaw (JSON) would.
+func (l *Logger) OutputEntries(entries []*Entry, format Format) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = l.buf[:0]
+	for _, e := range entries {
+		var s string
+		if format == JSONFormat {
+			s = e.JSON()
+		} else {
+			l.formatHeader(&l.buf, e.Time, e.File, e.Line)
+			s = e.Text()
+		}
+		l.buf = append(l.buf, s...)
+		if len(s) == 0 || s[len(s)-1] != '\n' {
+			l.buf = append(l.buf, '\n')
+		}
+	}
+	_, err := l.out.Write(l.buf)
+	return err
+}
+
 // Printf calls l.Output to print to the logger.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Printf(format string, v ...interface{}) {
@@ -0,0 +1,157 @@
+package logdoo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//RedactMask 敏感内容替换成的字符串
+const RedactMask = "***"
+
+//RedactPatterns 内置的脱敏规则,有捕获组时第一个捕获组的内容保留(如password=保留,后面的值替换掉)
+var RedactPatterns = map[string]string{
+	"password": `(?i)((?:password|passwd|pwd|pass|secret|sendp)\s*[=:]\s*)[^\s,;&"']+`,
+	"token":    `(?i)((?:token|api[_-]?key|access[_-]?key|authorization:\s*bearer|bearer)\s*[=:\s]\s*)[^\s,;&"']+`,
+	"email":    `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"path":     `((?:^|[\s=:"'(]))(?:[A-Za-z]:\\|\\\\|/)(?:[^\\/\s"',;]+[\\/])+[^\\/\s"',;]*`,
+}
+
+//redactRules 当前生效的脱敏规则,整体替换,分发日记时无锁读取
+type redactRules struct {
+	patterns []*regexp.Regexp
+	keys     map[string]bool //值需要整体替换的字段名(小写)
+	secrets  []string        //需要替换的明文(如解析后的密码),长的在前
+}
+
+var redaction atomic.Value
+
+//redactMu 修改规则时加锁,读取不需要
+var redactMu sync.Mutex
+
+func init() {
+	redaction.Store(&redactRules{})
+}
+
+func currentRules() *redactRules {
+	return redaction.Load().(*redactRules)
+}
+
+//SetRedactPatterns 设置脱敏规则,可以是内置规则名(password/token/email/path)或者正则表达式
+func SetRedactPatterns(patterns []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if builtin, ok := RedactPatterns[strings.ToLower(p)]; ok {
+			p = builtin
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("redact pattern %s err:%s", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	old := currentRules()
+	redaction.Store(&redactRules{patterns: compiled, keys: old.keys, secrets: old.secrets})
+	return nil
+}
+
+//SetRedactKeys 设置值需要整体替换的字段名(不区分大小写)
+func SetRedactKeys(keys []string) {
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			m[k] = true
+		}
+	}
+
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	old := currentRules()
+	redaction.Store(&redactRules{patterns: old.patterns, keys: m, secrets: old.secrets})
+}
+
+//AddRedactSecret 登记需要脱敏的明文(如解析后的SMTP密码),之后日记中出现的地方都会被替换
+func AddRedactSecret(secret string) {
+	if secret == "" {
+		return
+	}
+
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	old := currentRules()
+	for _, s := range old.secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets := append(append(make([]string, 0, len(old.secrets)+1), old.secrets...), secret)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	redaction.Store(&redactRules{patterns: old.patterns, keys: old.keys, secrets: secrets})
+}
+
+//Redact 按当前的脱敏规则处理字符串
+func Redact(s string) string {
+	return currentRules().redact(s)
+}
+
+func (r *redactRules) empty() bool {
+	return len(r.patterns) == 0 && len(r.keys) == 0 && len(r.secrets) == 0
+}
+
+func (r *redactRules) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, RedactMask, -1)
+	}
+	for _, re := range r.patterns {
+		if re.NumSubexp() > 0 {
+			s = re.ReplaceAllString(s, "${1}"+RedactMask)
+		} else {
+			s = re.ReplaceAllLiteralString(s, RedactMask)
+		}
+	}
+	return s
+}
+
+//redactEntry 返回脱敏后的日记,没有规则时直接返回原来的日记(newEntry生成日记时调用,所有Handler输出的都是脱敏后的内容)
+func redactEntry(e *Entry) *Entry {
+	r := currentRules()
+	if r.empty() {
+		return e
+	}
+
+	c := *e
+	c.Msg = r.redact(e.Msg)
+	if e.Args != nil {
+		c.Args = make([]interface{}, len(e.Args))
+		for i, v := range e.Args {
+			c.Args[i] = r.redact(fmt.Sprint(v))
+		}
+	}
+	if e.Fields != nil {
+		c.Fields = make([]Field, len(e.Fields))
+		for i, f := range e.Fields {
+			switch {
+			case r.keys[strings.ToLower(f.Key)]:
+				c.Fields[i] = String(f.Key, RedactMask)
+			case f.Type == StringType || f.Type == ErrorType || (f.Type == AnyType && f.Any != nil):
+				c.Fields[i] = Field{Key: f.Key, Type: f.Type, Str: r.redact(f.String())}
+				if f.Type == AnyType {
+					c.Fields[i].Type = StringType
+				}
+			default:
+				c.Fields[i] = f
+			}
+		}
+	}
+	return &c
+}
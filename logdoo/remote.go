@@ -0,0 +1,351 @@
+package logdoo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	RemoteBatchSize     = 100              //每次最多发送的日记条数
+	RemoteFlushInterval = time.Second      //不够一批时多久发送一次
+	RemoteQueueSize     = 4096             //内存中等待发送的日记条数
+	RemoteMaxBackoff    = time.Minute      //发送失败后重试的最长间隔
+	RemoteSpoolSize     = 64 * 1024 * 1024 //磁盘缓冲文件默认的最大大小
+)
+
+//RemoteHandler 把json格式的日记批量发送到远程的收集服务,支持HTTP(每行一条json)和TCP
+//发送失败的日记写入磁盘缓冲文件,收集服务恢复后按顺序补发,缓冲文件超过上限时丢弃新的日记
+type RemoteHandler struct {
+	LogHandler
+	url       string
+	client    *http.Client
+	conn      net.Conn
+	spoolPath string
+	spoolMax  int64
+	spoolSize int64
+	dropped   uint64
+	queue     chan []byte
+	flush     chan chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closed    int32
+}
+
+//NewRemoteHandler New一个远程日记,url为http(s)://...或者tcp://host:port,spoolPath为磁盘缓冲文件,spoolMax为它的最大字节数
+func NewRemoteHandler(url, spoolPath string, spoolMax int64) (*RemoteHandler, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "tcp://") {
+		return nil, fmt.Errorf("remote log url %s should be http(s):// or tcp://", url)
+	}
+	if spoolMax <= 0 {
+		spoolMax = RemoteSpoolSize
+	}
+
+	h := &RemoteHandler{
+		LogHandler: LogHandler{lg: New(ioutil.Discard, "", 0), format: JSONFormat},
+		url:        url,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		spoolPath:  spoolPath,
+		spoolMax:   spoolMax,
+		queue:      make(chan []byte, RemoteQueueSize),
+		flush:      make(chan chan struct{}),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if fi, err := os.Stat(spoolPath); err == nil {
+		h.spoolSize = fi.Size()
+	}
+
+	go h.run()
+	return h, nil
+}
+
+//Url 收集服务的地址
+func (h *RemoteHandler) Url() string {
+	return h.url
+}
+
+//Dropped 因为队列满或者缓冲文件超过上限被丢弃的日记条数
+func (h *RemoteHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+//Log 把日记放入发送队列,队列满时丢弃
+func (h *RemoteHandler) Log(e *Entry) {
+	if atomic.LoadInt32(&h.closed) == 1 {
+		return
+	}
+
+	select {
+	case h.queue <- []byte(e.JSON()):
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+}
+
+//Flush 马上发送队列中的日记(发送失败的会写入缓冲文件)
+func (h *RemoteHandler) Flush() {
+	ch := make(chan struct{})
+	select {
+	case h.flush <- ch:
+		<-ch
+	case <-h.done:
+	}
+}
+
+func (h *RemoteHandler) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(RemoteFlushInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	var retryAt time.Time
+	backoff := time.Second
+
+	for {
+		var flushed chan struct{}
+		select {
+		case line := <-h.queue:
+			batch = append(batch, line)
+			if len(batch) < RemoteBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case flushed = <-h.flush:
+			batch = h.drain(batch)
+		case <-h.stop:
+			h.send(h.drain(batch))
+			h.closeConn()
+			return
+		}
+
+		//重试的时间还没到,攒够一批就先写入缓冲文件
+		if flushed == nil && time.Now().Before(retryAt) {
+			if len(batch) >= RemoteBatchSize {
+				h.spool(batch)
+				batch = nil
+			}
+			continue
+		}
+
+		if err := h.send(batch); err != nil {
+			retryAt = time.Now().Add(backoff)
+			if backoff *= 2; backoff > RemoteMaxBackoff {
+				backoff = RemoteMaxBackoff
+			}
+		} else {
+			retryAt = time.Time{}
+			backoff = time.Second
+		}
+		batch = nil
+
+		if flushed != nil {
+			close(flushed)
+		}
+	}
+}
+
+//drain 取出队列中所有的日记
+func (h *RemoteHandler) drain(batch [][]byte) [][]byte {
+	for {
+		select {
+		case line := <-h.queue:
+			batch = append(batch, line)
+		default:
+			return batch
+		}
+	}
+}
+
+//send 发送一批日记,缓冲文件中还有日记时先补发缓冲文件保证顺序,补发失败时这一批也写入缓冲文件
+func (h *RemoteHandler) send(batch [][]byte) error {
+	if h.spoolSize > 0 {
+		if err := h.replay(); err != nil {
+			h.spool(batch)
+			return err
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := h.post(bytes.Join(batch, []byte("\n"))); err != nil {
+		Println("send remote log", h.url, "err", err)
+		h.spool(batch)
+		return err
+	}
+	return nil
+}
+
+//post 把以换行分隔的日记发送出去
+func (h *RemoteHandler) post(body []byte) error {
+	body = append(body, '\n')
+	if strings.HasPrefix(h.url, "tcp://") {
+		if h.conn == nil {
+			conn, err := net.DialTimeout("tcp", strings.TrimPrefix(h.url, "tcp://"), 10*time.Second)
+			if err != nil {
+				return err
+			}
+			h.conn = conn
+		}
+		h.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := h.conn.Write(body); err != nil {
+			h.closeConn()
+			return err
+		}
+		return nil
+	}
+
+	resp, err := h.client.Post(h.url, "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+func (h *RemoteHandler) closeConn() {
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+}
+
+//spool 把日记追加到缓冲文件,超过上限的丢弃
+func (h *RemoteHandler) spool(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+
+	file, err := os.OpenFile(h.spoolPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		Println("open remote log spool", h.spoolPath, "err", err)
+		atomic.AddUint64(&h.dropped, uint64(len(batch)))
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for i, line := range batch {
+		if h.spoolSize+int64(len(line))+1 > h.spoolMax {
+			atomic.AddUint64(&h.dropped, uint64(len(batch)-i))
+			break
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+		h.spoolSize += int64(len(line)) + 1
+	}
+	if err := w.Flush(); err != nil {
+		Println("write remote log spool", h.spoolPath, "err", err)
+	}
+}
+
+//replay 按顺序补发缓冲文件中的日记,失败时把没发送的部分保留在缓冲文件中
+func (h *RemoteHandler) replay() error {
+	file, err := os.Open(h.spoolPath)
+	if err != nil {
+		h.spoolSize = 0
+		return nil
+	}
+
+	var sent int64
+	var sendErr error
+	r := bufio.NewReader(file)
+	for {
+		var batch [][]byte
+		var size int64
+		for len(batch) < RemoteBatchSize {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				size += int64(len(line))
+				batch = append(batch, line[:len(line)-1])
+			}
+			if err != nil {
+				break
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		if sendErr = h.post(bytes.Join(batch, []byte("\n"))); sendErr != nil {
+			Println("replay remote log spool", h.url, "err", sendErr)
+			break
+		}
+		sent += size
+	}
+
+	//剩下没发送的部分写到临时文件再替换缓冲文件
+	if sendErr == nil {
+		file.Close()
+		os.Remove(h.spoolPath)
+		h.spoolSize = 0
+		return nil
+	}
+
+	tmp := h.spoolPath + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err == nil {
+		file.Seek(sent, io.SeekStart)
+		_, err = io.Copy(out, file)
+		out.Close()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(tmp, h.spoolPath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		Println("rewrite remote log spool", h.spoolPath, "err", err)
+	}
+	if fi, err := os.Stat(h.spoolPath); err == nil {
+		h.spoolSize = fi.Size()
+	}
+	return sendErr
+}
+
+//Close 把队列中的日记发送或写入缓冲文件后停止
+func (h *RemoteHandler) Close() {
+	h.close()
+}
+
+func (h *RemoteHandler) close() {
+	if !atomic.CompareAndSwapInt32(&h.closed, 0, 1) {
+		return
+	}
+	close(h.stop)
+	<-h.done
+}
+
+func (h *RemoteHandler) Output(calldepth int, s string) error {
+	h.Log(newEntry(INFO, calldepth+1, s, nil, nil))
+	return nil
+}
+
+func (h *RemoteHandler) DebugDoo(v ...interface{}) {
+	h.Log(newEntry(DEBUG, 2, "", v, nil))
+}
+
+func (h *RemoteHandler) InfoDoo(v ...interface{}) {
+	h.Log(newEntry(INFO, 2, "", v, nil))
+}
+
+func (h *RemoteHandler) WarnDoo(v ...interface{}) {
+	h.Log(newEntry(WARN, 2, "", v, nil))
+}
+
+func (h *RemoteHandler) ErrorDoo(v ...interface{}) {
+	h.Log(newEntry(ERROR, 2, "", v, nil))
+}
@@ -0,0 +1,195 @@
+package logdoo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//collector 模拟远程日记收集服务,记录收到的每条日记的msg
+type collector struct {
+	msgs []string
+	down bool
+	mu   sync.Mutex
+}
+
+func (c *collector) setDown(down bool) {
+	c.mu.Lock()
+	c.down = down
+	c.mu.Unlock()
+}
+
+func (c *collector) add(t *testing.T, line string) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Errorf("line %q err:%s", line, err)
+		return
+	}
+	c.mu.Lock()
+	c.msgs = append(c.msgs, fmt.Sprint(m["msg"]))
+	c.mu.Unlock()
+}
+
+func (c *collector) Msgs() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.msgs, ",")
+}
+
+//httpCollector http收集服务,down时返回503
+func httpCollector(t *testing.T, c *collector) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		down := c.down
+		c.mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			c.add(t, line)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func logMsgs(h *RemoteHandler, from, to int) {
+	for i := from; i <= to; i++ {
+		h.Log(newEntry(INFO, 1, fmt.Sprintf("m%d", i), nil, nil))
+	}
+}
+
+func TestRemoteHTTPSpoolReplay(t *testing.T) {
+	c := &collector{}
+	ts := httpCollector(t, c)
+	spool := filepath.Join(tempDir(t), "collector.spool")
+	h, err := NewRemoteHandler(ts.URL, spool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	logMsgs(h, 0, 0)
+	h.Flush()
+	if got := c.Msgs(); got != "m0" {
+		t.Fatalf("received %s", got)
+	}
+
+	//收集服务停止期间的日记写入缓冲文件,补发失败的也继续追加在后面
+	c.setDown(true)
+	logMsgs(h, 1, 5)
+	h.Flush()
+	logMsgs(h, 6, 6)
+	h.Flush()
+	if got := c.Msgs(); got != "m0" {
+		t.Fatalf("received %s while collector is down", got)
+	}
+	if fi, err := os.Stat(spool); err != nil || fi.Size() == 0 {
+		t.Fatalf("spool not written: %v", err)
+	}
+
+	//恢复后先按顺序补发缓冲文件,再发送新的日记
+	c.setDown(false)
+	logMsgs(h, 7, 7)
+	h.Flush()
+	if got := c.Msgs(); got != "m0,m1,m2,m3,m4,m5,m6,m7" {
+		t.Errorf("received %s", got)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool left after replay: %v", err)
+	}
+	if h.Dropped() != 0 {
+		t.Errorf("dropped %d", h.Dropped())
+	}
+}
+
+func TestRemoteTCPSpoolReplay(t *testing.T) {
+	//先拿到一个空闲的端口,收集服务一开始不可用
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	spool := filepath.Join(tempDir(t), "collector.spool")
+	h, err := NewRemoteHandler("tcp://"+addr, spool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	logMsgs(h, 1, 3)
+	h.Flush()
+	if fi, err := os.Stat(spool); err != nil || fi.Size() == 0 {
+		t.Fatalf("spool not written: %v", err)
+	}
+
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("listen %s again err:%s", addr, err)
+	}
+	defer l.Close()
+	c := &collector{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			c.add(t, s.Text())
+		}
+	}()
+
+	logMsgs(h, 4, 4)
+	h.Flush()
+	h.Close()
+	<-done
+	if got := c.Msgs(); got != "m1,m2,m3,m4" {
+		t.Errorf("received %s", got)
+	}
+}
+
+func TestRemoteSpoolLimit(t *testing.T) {
+	c := &collector{down: true}
+	ts := httpCollector(t, c)
+	line := []byte(newEntry(INFO, 1, "m0", nil, nil).JSON())
+	//缓冲文件只放得下3条
+	max := int64(len(line)+1)*3 + 10
+	spool := filepath.Join(tempDir(t), "collector.spool")
+	h, err := NewRemoteHandler(ts.URL, spool, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	logMsgs(h, 0, 9)
+	h.Flush()
+	fi, err := os.Stat(spool)
+	if err != nil || fi.Size() > max {
+		t.Fatalf("spool size %v err %v, max %d", fi, err, max)
+	}
+	if h.Dropped() != 7 {
+		t.Errorf("dropped %d, want 7", h.Dropped())
+	}
+
+	//超过上限时丢弃新的日记,已经缓冲的按顺序补发
+	c.setDown(false)
+	h.Flush()
+	if got := c.Msgs(); got != "m0,m1,m2" {
+		t.Errorf("received %s", got)
+	}
+}
@@ -0,0 +1,189 @@
+package logdoo
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//Retention 日记文件的保留策略,0表示不限制
+type Retention struct {
+	MaxAge   time.Duration //最长保留时间
+	MaxTotal int64         //目录下日记文件的总大小(字节)
+	MaxFiles int           //最多保留的文件数
+	Compress bool          //切换文件后是否把旧文件压缩成.gz
+}
+
+//retentionGrace 扫描目录时最近修改过的文件不压缩也不删除(可能还有正在进行的写入),刚切换下来的文件不受限制
+const retentionGrace = time.Minute
+
+//dayLogRegexp 按天(小时)分割的日记文件名:YYYYMMDD.log YYYYMMDDHH.log YYYYMMDD_N.log 以及压缩后的.gz
+var dayLogRegexp = regexp.MustCompile(`^\d{8}(\d{2})?(_\d+)?\.log(\.gz)?$`)
+
+//SetDayLogRetention 设置每天日记文件的保留策略
+func SetDayLogRetention(r Retention) {
+	LogInfo.SetRetention(r)
+}
+
+//SetRetention 设置保留策略并马上在后台清理一次
+func (h *RotatingHandler) SetRetention(r Retention) {
+	h.mu.Lock()
+	h.retention = r
+	h.mu.Unlock()
+	go h.Clean()
+}
+
+//Clean 按保留策略压缩和删除旧的日记文件,当前正在写的文件不处理
+func (h *RotatingHandler) Clean() {
+	//同一时间只有一个清理在进行,清理过程中又有新的请求时清理完再来一次
+	atomic.StoreInt32(&h.cleanPending, 1)
+	for atomic.LoadInt32(&h.cleanPending) == 1 {
+		if !atomic.CompareAndSwapInt32(&h.cleaning, 0, 1) {
+			return
+		}
+		for atomic.SwapInt32(&h.cleanPending, 0) == 1 {
+			h.clean()
+		}
+		//最后一次Swap之后、清除cleaning之前的请求会被上面的CAS拒绝,这里再检查一次
+		atomic.StoreInt32(&h.cleaning, 0)
+	}
+}
+
+//onRotate 切换文件后的回调,记下切换下来的文件再清理
+func (h *RotatingHandler) onRotate(path string) {
+	h.mu.Lock()
+	h.rotated = append(h.rotated, path)
+	h.mu.Unlock()
+	h.Clean()
+}
+
+func (h *RotatingHandler) clean() {
+	h.mu.Lock()
+	r, rotated := h.retention, h.rotated
+	h.rotated = nil
+	h.mu.Unlock()
+	dir, current := h.rotator.Dir(), h.rotator.Name()
+
+	if r.Compress {
+		//切换下来的文件已经关闭,不会再有写入,马上压缩
+		for _, path := range rotated {
+			if !dayLogRegexp.MatchString(filepath.Base(path)) || strings.HasSuffix(path, ".gz") || !isExist(path) {
+				continue
+			}
+			if err := gzipFile(path); err != nil {
+				Println("gzip log file", path, "err", err)
+			}
+		}
+
+		for _, fi := range listDayLogs(dir) {
+			if fi.Name() == current || strings.HasSuffix(fi.Name(), ".gz") || time.Since(fi.ModTime()) < retentionGrace {
+				continue
+			}
+			if err := gzipFile(dir + "/" + fi.Name()); err != nil {
+				Println("gzip log file", fi.Name(), "err", err)
+			}
+		}
+	}
+
+	if r.MaxAge <= 0 && r.MaxTotal <= 0 && r.MaxFiles <= 0 {
+		return
+	}
+
+	//从最旧的文件开始删除
+	files := listDayLogs(dir)
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	var total int64
+	for _, fi := range files {
+		total += fi.Size()
+	}
+
+	count := len(files)
+	for _, fi := range files {
+		expired := r.MaxAge > 0 && time.Since(fi.ModTime()) > r.MaxAge
+		tooMany := r.MaxFiles > 0 && count > r.MaxFiles
+		tooLarge := r.MaxTotal > 0 && total > r.MaxTotal
+		if !expired && !tooMany && !tooLarge {
+			break
+		}
+
+		if fi.Name() == current || time.Since(fi.ModTime()) < retentionGrace {
+			continue
+		}
+		if err := os.Remove(dir + "/" + fi.Name()); err != nil {
+			Println("remove log file", fi.Name(), "err", err)
+			continue
+		}
+		count--
+		total -= fi.Size()
+	}
+}
+
+func listDayLogs(dir string) []os.FileInfo {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, fi := range infos {
+		if !fi.IsDir() && dayLogRegexp.MatchString(fi.Name()) {
+			files = append(files, fi)
+		}
+	}
+	return files
+}
+
+//gzipFile 把文件压缩成path.gz,先写临时文件,成功后才删除原文件;path.gz已经存在时不覆盖,返回错误
+func gzipFile(path string) error {
+	if isExist(path + ".gz") {
+		return fmt.Errorf("%s.gz already exists", path)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if er := zw.Close(); err == nil {
+		err = er
+	}
+	if er := dst.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	//保留原文件的修改时间,按时间保留的策略才准确
+	os.Chtimes(tmp, fi.ModTime(), fi.ModTime())
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
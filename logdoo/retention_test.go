@@ -0,0 +1,158 @@
+package logdoo
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGzipFile(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "20200101.log")
+	if err := ioutil.WriteFile(path, []byte("day log\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gzipFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if isExist(path) {
+		t.Error("original file not removed")
+	}
+	if got := readGzip(t, path+".gz"); got != "day log\n" {
+		t.Errorf("archive content %q", got)
+	}
+}
+
+func TestGzipFileKeepExistingArchive(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "20200101.log")
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("second\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gzipFile(path); err == nil {
+		t.Fatal("gzip over an existing archive should fail")
+	}
+	if got := readGzip(t, path+".gz"); got != "first\n" {
+		t.Errorf("existing archive overwritten, content %q", got)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "second\n" {
+		t.Errorf("original file lost: %q %v", data, err)
+	}
+	if isExist(path + ".gz.tmp") {
+		t.Error("temp file left")
+	}
+}
+
+func TestCleanRetention(t *testing.T) {
+	dir := tempDir(t)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"20200101.log", "20200102.log", "20200103.log", "other.txt"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+		old = old.Add(time.Hour)
+	}
+
+	h := NewDayLogHandle(dir, 0)
+	defer h.close()
+	h.retention = Retention{MaxFiles: 2, Compress: true}
+	h.Clean()
+
+	var names []string
+	for _, fi := range listDayLogs(dir) {
+		names = append(names, fi.Name())
+	}
+	if len(names) != 2 || names[0] != "20200102.log.gz" || names[1] != "20200103.log.gz" {
+		t.Errorf("day logs after clean %v", names)
+	}
+	if !isExist(filepath.Join(dir, "other.txt")) {
+		t.Error("non log file removed")
+	}
+}
+
+func TestCleanNoLostRequest(t *testing.T) {
+	h := NewDayLogHandle(tempDir(t), 0)
+	defer h.close()
+
+	//任何时候请求清理,返回后都不能有被丢掉的请求
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				h.Clean()
+			}
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&h.cleaning) != 0 || atomic.LoadInt32(&h.cleanPending) != 0 {
+		t.Errorf("cleaning %d pending %d after all Clean returned", h.cleaning, h.cleanPending)
+	}
+}
+
+func TestCleanCompressRotated(t *testing.T) {
+	dir := tempDir(t)
+	h := NewDayLogHandle(dir, 0)
+	defer h.close()
+	h.retention = Retention{Compress: true}
+
+	h.InfoDoo("before rotate")
+	rotated := filepath.Join(dir, h.rotator.Name())
+	//目录中最近修改过的其他文件仍然等到retentionGrace之后才压缩
+	recent := filepath.Join(dir, "20200101.log")
+	if err := ioutil.WriteFile(recent, []byte("recent\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	//切换下来的文件不等retentionGrace,马上压缩
+	deadline := time.Now().Add(5 * time.Second)
+	for !isExist(rotated+".gz") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if isExist(rotated) || !isExist(rotated+".gz") {
+		t.Fatalf("rotated file %s not compressed", rotated)
+	}
+	if got := readGzip(t, rotated+".gz"); !strings.Contains(got, "before rotate") {
+		t.Errorf("archive content %q", got)
+	}
+	if !isExist(recent) || isExist(recent+".gz") {
+		t.Error("recent file compressed within the grace period")
+	}
+}
@@ -0,0 +1,340 @@
+package logdoo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//RotatePolicy 按时间切换日记文件的方式
+type RotatePolicy int32
+
+const (
+	RotateNone   RotatePolicy = iota //不按时间切换,只按大小切换
+	RotateHourly                     //每小时一个文件
+	RotateDaily                      //每天一个文件
+)
+
+//ParseRotatePolicy 把配置中的切换方式(size/hourly/daily)转换成RotatePolicy
+func ParseRotatePolicy(name string) (RotatePolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "daily":
+		return RotateDaily, nil
+	case "hourly":
+		return RotateHourly, nil
+	case "size", "none":
+		return RotateNone, nil
+	}
+	return RotateDaily, fmt.Errorf("unknow log rotate policy %s", name)
+}
+
+func (p RotatePolicy) String() string {
+	switch p {
+	case RotateHourly:
+		return "hourly"
+	case RotateDaily:
+		return "daily"
+	}
+	return "size"
+}
+
+//NamePattern 日记文件名,t为文件所属时间段的开始时间(不按时间切换时为创建文件的时间),index为同一时间段内按大小切换的序号
+type NamePattern func(t time.Time, index int) string
+
+//DayPattern 按天的文件名:20060102.log 20060102_1.log
+func DayPattern(t time.Time, index int) string {
+	year, month, day := t.Date()
+	if index == 0 {
+		return fmt.Sprintf("%d%02d%02d.log", year, month, day)
+	}
+	return fmt.Sprintf("%d%02d%02d_%d.log", year, month, day, index)
+}
+
+//HourPattern 按小时的文件名:2006010215.log 2006010215_1.log
+func HourPattern(t time.Time, index int) string {
+	year, month, day := t.Date()
+	if index == 0 {
+		return fmt.Sprintf("%d%02d%02d%02d.log", year, month, day, t.Hour())
+	}
+	return fmt.Sprintf("%d%02d%02d%02d_%d.log", year, month, day, t.Hour(), index)
+}
+
+//FixedPattern 固定的文件名,用于备份模式(旧文件改名为name.N.log)
+func FixedPattern(name string) NamePattern {
+	return func(t time.Time, index int) string {
+		return name
+	}
+}
+
+//Rotator 按时间和大小切换文件的io.Writer,文件大小在内存中累计,写日记时不需要查询文件状态
+//maxBackups>0时为备份模式:当前文件名不变,切换时旧文件依次改名为name.1.log...name.N.log
+type Rotator struct {
+	dir        string
+	pattern    NamePattern
+	policy     RotatePolicy
+	maxSize    int64
+	maxBackups int
+	flag       int
+	hooks      []func(path string)
+
+	file   *os.File
+	name   string
+	size   int64
+	period time.Time
+	index  int
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+//NewRotator New一个Rotator,文件在第一次写入时才创建;按时间切换时会启动一个协程在时间段结束时切换文件,用Stop停止
+func NewRotator(dir string, pattern NamePattern, policy RotatePolicy, maxSize int64, maxBackups int) *Rotator {
+	r := &Rotator{
+		dir:        dir,
+		pattern:    pattern,
+		policy:     policy,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+//OnRotate 添加切换文件后的回调,参数为切换前的文件路径,回调在新的协程中执行(如上传或压缩文件)
+func (r *Rotator) OnRotate(hook func(path string)) {
+	r.mu.Lock()
+	r.hooks = append(r.hooks, hook)
+	r.mu.Unlock()
+}
+
+//Dir 日记文件所在的目录
+func (r *Rotator) Dir() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dir
+}
+
+//Name 当前正在写的文件名
+func (r *Rotator) Name() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.name
+}
+
+//SetDir 修改目录,下次写入时在新的目录中创建文件
+func (r *Rotator) SetDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dir = dir
+	r.closeFile()
+}
+
+//SetMaxSize 设置单个文件的最大字节数,0表示不限制
+func (r *Rotator) SetMaxSize(size int64) {
+	r.mu.Lock()
+	r.maxSize = size
+	r.mu.Unlock()
+}
+
+//SetPolicy 修改按时间切换的方式和文件名,下次写入时生效
+func (r *Rotator) SetPolicy(policy RotatePolicy, pattern NamePattern) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pattern != nil {
+		r.pattern = pattern
+	}
+	if r.policy != policy {
+		r.policy = policy
+		r.closeFile()
+	}
+}
+
+//Write 写入数据,时间段结束或者超过最大大小时先切换文件
+func (r *Rotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.file == nil {
+		if err := r.open(now, 0); err != nil {
+			return 0, err
+		}
+	} else if r.due(now, int64(len(p))) {
+		if err := r.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+//Rotate 马上切换文件
+func (r *Rotator) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.rotate(time.Now())
+}
+
+//Stop 停止按时间切换的协程,文件不会关闭
+func (r *Rotator) Stop() {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+//Close 停止协程并关闭当前文件
+func (r *Rotator) Close() error {
+	r.Stop()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeFile()
+}
+
+func (r *Rotator) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+//periodStart 时间所在时间段的开始时间,不按时间切换时为零值
+func (r *Rotator) periodStart(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch r.policy {
+	case RotateHourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+func (r *Rotator) due(now time.Time, n int64) bool {
+	if r.policy != RotateNone && !r.periodStart(now).Equal(r.period) {
+		return true
+	}
+	return r.maxSize > 0 && r.size > 0 && r.size+n > r.maxSize
+}
+
+//open 打开时间段内第一个没有写满的文件(从序号index开始找),已经被压缩成.gz的文件也算写满
+func (r *Rotator) open(now time.Time, index int) error {
+	period := r.periodStart(now)
+	nameTime := period
+	if r.policy == RotateNone {
+		nameTime = now
+	}
+
+	if r.maxBackups > 0 {
+		index = 0
+	}
+	for {
+		name := r.pattern(nameTime, index)
+		fi, err := os.Stat(r.dir + "/" + name)
+		if r.maxBackups == 0 && (isExist(r.dir+"/"+name+".gz") || err == nil && r.maxSize > 0 && fi.Size() >= r.maxSize) {
+			index++
+			continue
+		}
+
+		file, err := os.OpenFile(r.dir+"/"+name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+		r.file, r.name, r.period, r.index = file, name, period, index
+		r.size = 0
+		if fi, err := file.Stat(); err == nil {
+			r.size = fi.Size()
+		}
+		return nil
+	}
+}
+
+func (r *Rotator) rotate(now time.Time) error {
+	old := r.dir + "/" + r.name
+	index := 0
+	if r.periodStart(now).Equal(r.period) {
+		index = r.index + 1
+	}
+	r.closeFile()
+
+	if r.maxBackups > 0 {
+		old = r.shift(old)
+	}
+	if err := r.open(now, index); err != nil {
+		return err
+	}
+
+	for _, hook := range r.hooks {
+		go hook(old)
+	}
+	return nil
+}
+
+//shift 备份模式下把path.N-1.log依次改名为path.N.log,当前文件改名为path.1.log
+func (r *Rotator) shift(path string) string {
+	os.Remove(fmt.Sprintf("%s.%d.log", path, r.maxBackups))
+	for i := r.maxBackups - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d.log", path, i)
+		if isExist(from) {
+			os.Rename(from, fmt.Sprintf("%s.%d.log", path, i+1))
+		}
+	}
+
+	backup := path + ".1.log"
+	if err := os.Rename(path, backup); err != nil {
+		Println("rotate log file", path, "err", err)
+		return path
+	}
+	return backup
+}
+
+//run 在时间段结束时切换文件,没有日记写入时也能按时生成新文件并执行回调
+func (r *Rotator) run() {
+	defer close(r.done)
+	for {
+		r.mu.Lock()
+		wait := time.Minute
+		if r.policy != RotateNone && r.file != nil {
+			wait = time.Until(r.period.Add(r.periodLength()))
+		}
+		r.mu.Unlock()
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		r.mu.Lock()
+		if now := time.Now(); r.file != nil && r.policy != RotateNone && !r.periodStart(now).Equal(r.period) {
+			if err := r.rotate(now); err != nil {
+				Println("rotate log file err", err)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+//periodLength 一个时间段的长度(跨夏令时的那天按24小时算,到点后会重新计算)
+func (r *Rotator) periodLength() time.Duration {
+	if r.policy == RotateHourly {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
@@ -0,0 +1,61 @@
+package logdoo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//tempDir 测试用的临时目录,测试结束后删除
+func tempDir(t testing.TB) string {
+	dir, err := ioutil.TempDir("", "logdoo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestRotatorSkipCompressed(t *testing.T) {
+	dir := tempDir(t)
+	today := DayPattern(time.Now(), 0)
+	//上次运行时今天的文件已经被切换并压缩了
+	if err := ioutil.WriteFile(filepath.Join(dir, today+".gz"), []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRotator(dir, DayPattern, RotateDaily, 0, 0)
+	defer r.Close()
+	if _, err := r.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := DayPattern(time.Now(), 1); r.Name() != want {
+		t.Errorf("writing %s, want %s", r.Name(), want)
+	}
+	if isExist(filepath.Join(dir, today)) {
+		t.Errorf("%s reused although %s.gz exists", today, today)
+	}
+}
+
+func TestRotatorSkipFull(t *testing.T) {
+	dir := tempDir(t)
+	today := DayPattern(time.Now(), 0)
+	if err := ioutil.WriteFile(filepath.Join(dir, today), make([]byte, 100), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, DayPattern(time.Now(), 1)+".gz"), []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRotator(dir, DayPattern, RotateDaily, 100, 0)
+	defer r.Close()
+	if _, err := r.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := DayPattern(time.Now(), 2); r.Name() != want {
+		t.Errorf("writing %s, want %s", r.Name(), want)
+	}
+}
@@ -0,0 +1,310 @@
+package logdoo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Facility syslog的facility
+type Facility int32
+
+const (
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityLocal0 Facility = 16
+)
+
+//SyslogSDID 结构化字段使用的SD-ID(32473为RFC5612中留作示例的企业号)
+const SyslogSDID = "fields@32473"
+
+const (
+	SyslogDialTimeout  = 5 * time.Second //连接syslog的超时
+	SyslogWriteTimeout = time.Second     //发送一条日记的超时
+	SyslogMaxBackoff   = time.Minute     //连接失败后重试的最长间隔
+)
+
+//syslogSockets 本机syslog的unix socket
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+//Severity 日记级别对应的syslog severity(journald的PRIORITY也是同样的值)
+func Severity(level Level) int {
+	switch level {
+	case DEBUG:
+		return 7
+	case INFO:
+		return 6
+	case WARN:
+		return 4
+	}
+	return 3
+}
+
+//SyslogHandler 按RFC5424格式把日记发送到syslog,支持udp、tcp(octet-counting分帧)以及unix socket
+//连接断开后在后台按退避间隔重新连接,连接恢复前的日记直接丢弃,不阻塞写日记的协程
+type SyslogHandler struct {
+	LogHandler
+	network  string
+	addr     string
+	tag      string
+	hostname string
+	facility Facility
+	conn     net.Conn
+	stream   bool //当前连接是否为流式连接(tcp/unix),需要octet-counting分帧
+	dialing  bool //是否正在后台重新连接
+	retryAt  time.Time
+	backoff  time.Duration
+	dropped  uint64
+	closed   bool
+	mu       sync.Mutex
+}
+
+//NewSyslogHandler New一个syslog日记,network为udp/tcp/unix/unixgram,network和addr都为空时连接本机的syslog
+func NewSyslogHandler(network, addr, tag string) (*SyslogHandler, error) {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	h := &SyslogHandler{
+		LogHandler: LogHandler{lg: New(ioutil.Discard, "", 0)},
+		network:    network,
+		addr:       addr,
+		tag:        tag,
+		hostname:   hostname,
+		facility:   FacilityDaemon,
+		backoff:    time.Second,
+	}
+
+	conn, stream, err := h.dial()
+	if err != nil {
+		return nil, err
+	}
+	h.conn, h.stream = conn, stream
+	return h, nil
+}
+
+//ParseSyslogAddr 解析配置中的syslog地址,如udp://127.0.0.1:514、tcp://host:601、unix:///dev/log,local表示本机syslog
+func ParseSyslogAddr(s string) (network, addr string, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "local") {
+		return "", "", nil
+	}
+
+	i := strings.Index(s, "://")
+	if i <= 0 {
+		return "", "", fmt.Errorf("syslog address %s should be network://addr", s)
+	}
+	network, addr = strings.ToLower(s[:i]), s[i+3:]
+	switch network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return "", "", fmt.Errorf("unknow syslog network %s", network)
+	}
+	if addr == "" {
+		return "", "", fmt.Errorf("syslog address %s is empty", s)
+	}
+	return network, addr, nil
+}
+
+//Addr syslog的地址(network://addr)
+func (h *SyslogHandler) Addr() string {
+	if h.network == "" {
+		return "local"
+	}
+	return h.network + "://" + h.addr
+}
+
+//Facility syslog的facility,默认为daemon
+func (h *SyslogHandler) Facility() Facility {
+	return Facility(atomic.LoadInt32((*int32)(&h.facility)))
+}
+
+//SetFacility 设置syslog的facility
+func (h *SyslogHandler) SetFacility(f Facility) {
+	atomic.StoreInt32((*int32)(&h.facility), int32(f))
+}
+
+//Dropped 连接断开期间被丢弃的日记条数
+func (h *SyslogHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+//dial 建立连接,返回连接以及它是否为流式连接
+func (h *SyslogHandler) dial() (net.Conn, bool, error) {
+	if h.network != "" {
+		conn, err := net.DialTimeout(h.network, h.addr, SyslogDialTimeout)
+		if err != nil {
+			return nil, false, err
+		}
+		return conn, h.network == "tcp" || h.network == "unix", nil
+	}
+
+	for _, path := range syslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.DialTimeout(network, path, SyslogDialTimeout); err == nil {
+				return conn, network == "unix", nil
+			}
+		}
+	}
+	return nil, false, fmt.Errorf("no local syslog socket in %s", strings.Join(syslogSockets, ","))
+}
+
+//redial 在后台重新连接,失败时加倍下次重试的间隔
+func (h *SyslogHandler) redial() {
+	conn, stream, err := h.dial()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dialing = false
+	if h.closed {
+		if conn != nil {
+			conn.Close()
+		}
+		return
+	}
+
+	if err != nil {
+		Println("syslog connect", h.Addr(), "err", err, "retry after", h.backoff)
+		h.retryAt = time.Now().Add(h.backoff)
+		if h.backoff *= 2; h.backoff > SyslogMaxBackoff {
+			h.backoff = SyslogMaxBackoff
+		}
+		return
+	}
+	h.conn, h.stream = conn, stream
+	h.backoff = time.Second
+}
+
+//Log 发送一条日记,连接断开时丢弃并在后台重新连接
+func (h *SyslogHandler) Log(e *Entry) {
+	msg := h.format(e)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	if h.conn == nil {
+		atomic.AddUint64(&h.dropped, 1)
+		if !h.dialing && !time.Now().Before(h.retryAt) {
+			h.dialing = true
+			go h.redial()
+		}
+		return
+	}
+
+	//tcp和unix流式连接需要用octet-counting分帧
+	if h.stream {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(SyslogWriteTimeout))
+	if _, err := h.conn.Write(msg); err != nil {
+		Println("syslog write", h.Addr(), "err", err)
+		atomic.AddUint64(&h.dropped, 1)
+		h.conn.Close()
+		h.conn = nil
+		h.dialing = true
+		go h.redial()
+	}
+}
+
+//format RFC5424格式:<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ELEMENT] MSG(不包括分帧)
+func (h *SyslogHandler) format(e *Entry) []byte {
+	var buf bytes.Buffer
+	pri := int(h.Facility())*8 + Severity(e.Level)
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d - ", pri, e.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(h.hostname, 255), syslogHeader(h.tag, 48), os.Getpid())
+
+	buf.WriteString("[" + SyslogSDID)
+	buf.WriteString(` caller="` + syslogParam(e.Caller()) + `"`)
+	for _, f := range e.Fields {
+		buf.WriteString(" " + syslogParamName(f.Key) + `="` + syslogParam(f.String()) + `"`)
+	}
+	buf.WriteString("] ")
+	buf.WriteString(e.Message())
+	return buf.Bytes()
+}
+
+//syslogHeader 头部字段只能是可见的ASCII字符,为空时用-
+func syslogHeader(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			b = append(b, s[i])
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+//syslogParamName SD-PARAM的名字不能包含= ] " 空格,最长32个字符
+func syslogParamName(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < 32; i++ {
+		c := s[i]
+		if c > 32 && c < 127 && c != '=' && c != ']' && c != '"' {
+			b = append(b, c)
+		} else {
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+//syslogParam SD-PARAM的值需要转义" \ ]
+func syslogParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+func (h *SyslogHandler) Output(calldepth int, s string) error {
+	h.Log(newEntry(INFO, calldepth+1, s, nil, nil))
+	return nil
+}
+
+func (h *SyslogHandler) DebugDoo(v ...interface{}) {
+	h.Log(newEntry(DEBUG, 2, "", v, nil))
+}
+
+func (h *SyslogHandler) InfoDoo(v ...interface{}) {
+	h.Log(newEntry(INFO, 2, "", v, nil))
+}
+
+func (h *SyslogHandler) WarnDoo(v ...interface{}) {
+	h.Log(newEntry(WARN, 2, "", v, nil))
+}
+
+func (h *SyslogHandler) ErrorDoo(v ...interface{}) {
+	h.Log(newEntry(ERROR, 2, "", v, nil))
+}
+
+//Close 关闭连接
+func (h *SyslogHandler) Close() {
+	h.close()
+}
+
+func (h *SyslogHandler) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+}
@@ -0,0 +1,255 @@
+package logdoo
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//syslogRegexp RFC5424格式:<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ELEMENT] MSG
+var syslogRegexp = regexp.MustCompile(`(?s)^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) - \[fields@32473 caller="syslog_test\.go:\d+"((?:[^\]\\]|\\.)*)\] (.*)$`)
+
+//checkSyslog 检查一条日记的格式,返回结构化字段和消息
+func checkSyslog(t *testing.T, msg string, pri int) (string, string) {
+	m := syslogRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("not RFC5424: %q", msg)
+	}
+	if m[1] != strconv.Itoa(pri) {
+		t.Errorf("pri %s, want %d", m[1], pri)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, m[2]); err != nil {
+		t.Errorf("timestamp %s err:%s", m[2], err)
+	}
+	if m[4] != "gomonitor" || m[5] != strconv.Itoa(os.Getpid()) {
+		t.Errorf("app %s pid %s", m[4], m[5])
+	}
+	return m[6], m[7]
+}
+
+//readFrame 读取一条octet-counting分帧的日记:MSG-LEN SP MSG
+func readFrame(r *bufio.Reader) (string, error) {
+	n, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(n, " "))
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+//acceptFrames 接受连接并把读到的每一条日记发送到返回的chan
+func acceptFrames(l net.Listener) <-chan string {
+	frames := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := readFrame(r)
+					if err != nil {
+						return
+					}
+					frames <- msg
+				}
+			}()
+		}
+	}()
+	return frames
+}
+
+func waitFrame(t *testing.T, frames <-chan string) string {
+	select {
+	case msg := <-frames:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+	}
+	return ""
+}
+
+func syslogSocketDir(t *testing.T) string {
+	dir := tempDir(t)
+	if len(dir) > 80 {
+		t.Skipf("temp dir %s too long for unix socket", dir)
+	}
+	return dir
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	h, err := NewSyslogHandler("udp", pc.LocalAddr().String(), "gomonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.Log(newEntry(WARN, 1, "disk full", nil, []Field{String("service", "Doo"), String("a b]", `x"y]`)}))
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//udp每个包一条日记,不分帧
+	fields, msg := checkSyslog(t, string(buf[:n]), int(FacilityDaemon)*8+4)
+	if fields != ` service="Doo" a_b_="x\"y\]"` || msg != "disk full" {
+		t.Errorf("fields %q msg %q", fields, msg)
+	}
+}
+
+func TestSyslogStreamFraming(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string //监听的network
+		local   bool   //是否通过本机syslog socket连接
+	}{
+		{"tcp", "tcp", false},
+		{"unix", "unix", false},
+		{"local unix stream", "unix", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if tt.network == "unix" {
+				addr = filepath.Join(syslogSocketDir(t), "log")
+			}
+			l, err := net.Listen(tt.network, addr)
+			if err != nil {
+				t.Skipf("listen %s err:%s", tt.network, err)
+			}
+			defer l.Close()
+			frames := acceptFrames(l)
+
+			network, target := tt.network, l.Addr().String()
+			if tt.local {
+				old := syslogSockets
+				syslogSockets = []string{target}
+				defer func() { syslogSockets = old }()
+				network, target = "", ""
+			}
+			h, err := NewSyslogHandler(network, target, "gomonitor")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			h.Log(newEntry(INFO, 1, "line1\nline2", nil, nil))
+			h.Log(newEntry(ERROR, 1, "second", nil, nil))
+			if _, msg := checkSyslog(t, waitFrame(t, frames), int(FacilityDaemon)*8+6); msg != "line1\nline2" {
+				t.Errorf("first msg %q", msg)
+			}
+			if _, msg := checkSyslog(t, waitFrame(t, frames), int(FacilityDaemon)*8+3); msg != "second" {
+				t.Errorf("second msg %q", msg)
+			}
+		})
+	}
+}
+
+func TestSyslogLocalDatagram(t *testing.T) {
+	path := filepath.Join(syslogSocketDir(t), "log")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram not supported: %s", err)
+	}
+	defer conn.Close()
+	old := syslogSockets
+	syslogSockets = []string{path}
+	defer func() { syslogSockets = old }()
+
+	h, err := NewSyslogHandler("", "", "gomonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.Log(newEntry(INFO, 1, "hello", nil, nil))
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, msg := checkSyslog(t, string(buf[:n]), int(FacilityDaemon)*8+6); msg != "hello" {
+		t.Errorf("msg %q", msg)
+	}
+}
+
+func TestSyslogReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	frames := acceptFrames(l)
+
+	h, err := NewSyslogHandler("tcp", addr, "gomonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.Log(newEntry(INFO, 1, "before", nil, nil))
+	if _, msg := checkSyslog(t, waitFrame(t, frames), int(FacilityDaemon)*8+6); msg != "before" {
+		t.Fatalf("msg %q", msg)
+	}
+
+	//收集服务停止后写日记不阻塞,日记被丢弃
+	l.Close()
+	h.mu.Lock()
+	h.conn.Close()
+	h.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Dropped() == 0 && time.Now().Before(deadline) {
+		start := time.Now()
+		h.Log(newEntry(INFO, 1, "down", nil, nil))
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Fatalf("log blocked %s while syslog is down", d)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h.Dropped() == 0 {
+		t.Fatal("no entry dropped while syslog is down")
+	}
+
+	//恢复后重新连接
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("listen %s again err:%s", addr, err)
+	}
+	defer l.Close()
+	frames = acceptFrames(l)
+	deadline = time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		h.Log(newEntry(INFO, 1, "after", nil, nil))
+		select {
+		case msg := <-frames:
+			if _, m := checkSyslog(t, msg, int(FacilityDaemon)*8+6); m != "after" {
+				t.Errorf("msg %q after reconnect", m)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatal("syslog not reconnected")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogWatchPollInterval = time.Second     //检查日记新增内容的间隔
+	LogWatchContextWait  = 5 * time.Second //匹配后最多等待多久收集后面的上下文
+)
+
+//通知的标题
+const (
+	LogMatchReason        = "log matched alert pattern!"
+	LogMatchRestartReason = "log matched alert pattern and restart!"
+)
+
+//Notifier 日记监控匹配时发送通知或者请求重启service
+type Notifier interface {
+	Restarter
+	Notify(name, reason, detail string)
+}
+
+//LogWatchCfg [LogWatch]一个service的日记监控规则
+type LogWatchCfg struct {
+	Name     string
+	Service  string
+	Path     string        //日记文件或者目录(跟踪目录下最后修改的文件),默认为service的AttachX
+	Pattern  string        //需要告警的行的正则
+	Context  int           //通知中带上匹配行前后各多少行
+	Cooldown time.Duration //同一规则两次通知的最小间隔
+	Restart  bool          //匹配时先停止再启动service
+}
+
+//LogWatchMonitor 管理所有的日记监控,每条规则一个协程
+type LogWatchMonitor struct {
+	watchers map[string]*LogWatcher
+	mu       sync.Mutex
+}
+
+//LogWatcher 一条日记监控规则
+type LogWatcher struct {
+	cfg        LogWatchCfg
+	re         *regexp.Regexp
+	notifier   Notifier
+	tail       *Tailer
+	before     []string    //最近的行,用于匹配行前面的上下文
+	pending    []*logMatch //还在收集后面上下文的匹配
+	lastFire   time.Time
+	suppressed int //冷却期间被抑制的匹配数
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+type logMatch struct {
+	file   string
+	line   string
+	before []string
+	after  []string
+	time   time.Time
+}
+
+//NewLogWatchMonitor New一个日记监控管理
+func NewLogWatchMonitor() *LogWatchMonitor {
+	return &LogWatchMonitor{watchers: make(map[string]*LogWatcher)}
+}
+
+//Update 按新的配置更新日记监控,配置没有变化的规则继续运行(不会重新读已经读过的内容)
+func (lm *LogWatchMonitor) Update(cfgs []LogWatchCfg, n Notifier) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	keep := make(map[string]bool, len(cfgs))
+	for _, c := range cfgs {
+		key := fmt.Sprintf("%+v", c)
+		keep[key] = true
+		if _, ok := lm.watchers[key]; ok {
+			continue
+		}
+		w, err := NewLogWatcher(c, n)
+		if err != nil {
+			logdoo.Error("create log watch fail", logdoo.String("name", c.Name), logdoo.Err(err))
+			continue
+		}
+		lm.watchers[key] = w
+		go w.run()
+		logdoo.Info("log watch start", logdoo.String("name", c.Name), logdoo.String("service", c.Service), logdoo.String("path", c.Path), logdoo.String("pattern", c.Pattern))
+	}
+
+	for key, w := range lm.watchers {
+		if !keep[key] {
+			w.Stop()
+			delete(lm.watchers, key)
+			logdoo.Info("log watch stop", logdoo.String("name", w.cfg.Name), logdoo.String("service", w.cfg.Service))
+		}
+	}
+}
+
+//Close 停止所有的日记监控
+func (lm *LogWatchMonitor) Close() {
+	lm.Update(nil, nil)
+}
+
+//NewLogWatcher New一条日记监控规则,从日记当前的末尾开始监控
+func NewLogWatcher(c LogWatchCfg, n Notifier) (*LogWatcher, error) {
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &LogWatcher{
+		cfg:      c,
+		re:       re,
+		notifier: n,
+		tail:     NewTailer(c.Path, true),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+//Stop 停止监控的协程
+func (w *LogWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *LogWatcher) run() {
+	defer close(w.done)
+	log := logdoo.With("service", w.cfg.Service, "watch", w.cfg.Name).Limited(LogLimitWindow)
+	ticker := time.NewTicker(LogWatchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		lines, err := w.tail.Poll()
+		if err != nil {
+			log.Warn("tail log fail", logdoo.String("path", w.cfg.Path), logdoo.Err(err))
+		}
+		w.Feed(w.tail.Name(), lines, time.Now())
+	}
+}
+
+//Feed 处理新增的行,匹配的行收集完上下文(或者超时)后发送通知
+func (w *LogWatcher) Feed(file string, lines []string, now time.Time) {
+	for _, line := range lines {
+		for _, m := range w.pending {
+			if len(m.after) < w.cfg.Context {
+				m.after = append(m.after, line)
+			}
+		}
+
+		if w.re.MatchString(line) {
+			before := make([]string, len(w.before))
+			copy(before, w.before)
+			w.pending = append(w.pending, &logMatch{file: file, line: line, before: before, time: now})
+		}
+
+		if w.cfg.Context > 0 {
+			if len(w.before) == w.cfg.Context {
+				w.before = w.before[1:]
+			}
+			w.before = append(w.before, line)
+		}
+	}
+
+	remain := w.pending[:0]
+	for _, m := range w.pending {
+		if len(m.after) >= w.cfg.Context || now.Sub(m.time) >= LogWatchContextWait {
+			w.fire(m)
+		} else {
+			remain = append(remain, m)
+		}
+	}
+	w.pending = remain
+}
+
+//fire 发送通知,匹配时间在冷却期间的只计数
+func (w *LogWatcher) fire(m *logMatch) {
+	if !w.lastFire.IsZero() && m.time.Sub(w.lastFire) < w.cfg.Cooldown {
+		w.suppressed++
+		return
+	}
+	suppressed := w.suppressed
+	w.lastFire, w.suppressed = m.time, 0
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s matched %s in %s", w.cfg.Name, w.cfg.Pattern, m.file)
+	if suppressed > 0 {
+		fmt.Fprintf(&b, " (%d matches suppressed in cooldown)", suppressed)
+	}
+	b.WriteString("\n")
+	for _, l := range m.before {
+		b.WriteString("  " + l + "\n")
+	}
+	b.WriteString("> " + m.line + "\n")
+	for _, l := range m.after {
+		b.WriteString("  " + l + "\n")
+	}
+	detail := strings.TrimRight(b.String(), "\n")
+
+	log := logdoo.With("service", w.cfg.Service, "watch", w.cfg.Name)
+	log.Error("log matched alert pattern", logdoo.String("file", m.file), logdoo.String("line", m.line), logdoo.Int("suppressed", suppressed))
+	if w.notifier == nil {
+		return
+	}
+	if w.cfg.Restart {
+		if !w.notifier.RequestRestart(w.cfg.Service, LogMatchRestartReason, detail, true) {
+			log.Warn("service is not monitored or is restarting, skip restart")
+		}
+		return
+	}
+	w.notifier.Notify(w.cfg.Service, LogMatchReason, detail)
+}
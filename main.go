@@ -2,8 +2,8 @@ package main
 
 import (
 	"GoMonitor/logdoo"
+	"GoMonitor/probe"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -21,9 +21,31 @@ const (
 	IsRelease = 2
 )
 
+//CfgReloadDelay 配置文件修改后延迟多久再加载(编辑器可能分多次写入,合并成一次加载)
+const CfgReloadDelay = 500 * time.Millisecond
+
 var monitorCfg = NewMonitorCfg()
 var monitorService = NewMonitorService()
 var monitorEmail = NewEmail()
+var controlApi = NewControlApi()
+var healthMonitor = NewHealthMonitor()
+var logWatchMonitor = NewLogWatchMonitor()
+var resourceMonitor = NewResourceMonitor()
+var hostMonitor = NewHostMonitor()
+
+//logLevels 各个日记Handler的级别,控制接口修改的级别重新加载配置后仍然保留
+var logLevels = NewLogLevels()
+
+//asyncLog 开启异步日记时包装文件日记的Handler
+var asyncLog *logdoo.AsyncHandler
+
+//sysLog journalLog 配置开启时输出到系统日记的Handler
+var sysLog *logdoo.SyslogHandler
+var journalLog *logdoo.JournaldHandler
+
+//collectorLog 配置开启时发送到远程日记收集服务的Handler
+var collectorLog *logdoo.RemoteHandler
+var collectorSpoolSize int64
 
 func main() {
 	RunWindowService(IsDebug)
@@ -40,96 +62,254 @@ func ServerMain() {
 	}
 
 	if monitorCfg == nil {
-		logdoo.ErrorDoo("init monitor config file fail")
+		logdoo.Error("init monitor config file fail")
 		return
 	}
 
-	logdoo.InfoDoo("***service start***")
+	logdoo.Info("***service start***")
 
 	//获取配置文件目录
 	cfgPath, err := GetCfgPath()
 	if err != nil {
-		logdoo.ErrorDoo("GetCfgPath err", err)
+		logdoo.Error("GetCfgPath fail", logdoo.Err(err))
 		return
 	}
 
 	if err := LoadCfgService(monitorCfg, monitorService, monitorEmail, cfgPath); err != nil {
-		logdoo.ErrorDoo(err)
+		logdoo.Error("load config fail", logdoo.Err(err))
 	}
 	monitorService.StartMonitor(monitorCfg, monitorEmail)
 
+	RegisterCfgApi(controlApi, monitorCfg)
+	RegisterLogApi(controlApi, logLevels)
+	RegisterHealthApi(controlApi, healthMonitor)
+	RegisterMetricsApi(controlApi, resourceMonitor)
+	controlApi.Update(monitorCfg.GetApiCfg())
+	defer controlApi.Close()
+	defer healthMonitor.Close()
+	defer logWatchMonitor.Close()
+	defer resourceMonitor.Close()
+	defer hostMonitor.Close()
+
+	//hasModify不关闭,退出时关闭done通知监听协程停止,避免协程往已关闭的channel发送
 	hasModify := make(chan int)
-	defer close(hasModify)
-	timer := time.NewTicker(time.Duration(monitorCfg.GetRefreshTime()) * time.Second) //默认是5分钟刷新一次
-	go WatchCfgFile(cfgPath, hasModify)
+	done := make(chan struct{})
+	defer close(done)
+	refresh := monitorCfg.GetTimerCfg().RefreshInterval
+	timer := time.NewTicker(refresh) //默认是5分钟刷新一次
+	go WatchCfgFile(cfgPath, monitorCfg, hasModify, done)
+	go WatchRemoteCfg(cfgPath, monitorCfg, hasModify, done)
+
+	//配置文件修改事件去抖,最后一次修改后CfgReloadDelay才重新加载
+	reload := time.NewTimer(CfgReloadDelay)
+	reload.Stop()
 
 	for {
 		select {
 		case event := <-hasModify:
 			if event == WatcherModify {
-				if err := UpdateCfgService(monitorCfg, monitorService, monitorEmail, cfgPath); err != nil {
-					logdoo.ErrorDoo(err)
+				reload.Stop()
+				select {
+				case <-reload.C:
+				default:
 				}
+				reload.Reset(CfgReloadDelay)
+			}
+
+		case <-reload.C:
+			if err := UpdateCfgService(monitorCfg, monitorService, monitorEmail, cfgPath); err != nil {
+				logdoo.Error("load config fail", logdoo.Err(err))
+			}
+			controlApi.Update(monitorCfg.GetApiCfg())
+
+			//刷新间隔修改了需要重建定时器
+			if t := monitorCfg.GetTimerCfg(); t.RefreshInterval != refresh {
+				timer.Stop()
+				refresh = t.RefreshInterval
+				timer = time.NewTicker(refresh)
+				logdoo.Info("refresh interval change", logdoo.Duration("interval", refresh))
 			}
 
 		case <-timer.C:
 			if err := UpdateMoniService(monitorCfg, monitorService, monitorEmail, cfgPath); err != nil {
-				logdoo.ErrorDoo(err)
+				logdoo.Error("load config fail", logdoo.Err(err))
 			}
 
 		case <-monitorService.stopChan:
 			monitorService.Release()
-			break
+			return
 		}
 	}
 }
 
 func CloseService() {
 	monitorService.stopChan <- true
-	logdoo.InfoDoo("***service close***")
+	logdoo.Info("***service close***")
 }
 
 //LoadCfgService 根据配置文件加载监控服务信息
 func LoadCfgService(mc *MonitorCfg, ms *MonitorService, e *Email, cfgPath string) error {
-	if err := mc.LoadCfg(cfgPath); err != nil {
+	if _, err := mc.LoadCfg(cfgPath); err != nil {
 		return fmt.Errorf("LoadCfg err:%s", err)
 	}
 
+	ApplyLogCfg(mc.GetLogCfg())
 	e.UpdateEmail(mc.GetEmailData())
+	ms.ApplyTimerCfg(mc.GetTimerCfg(), mc, e)
 	specServices := mc.GetSpecServices()
 	partServices := mc.GetPartServices()
 	ms.AddSpecService(specServices)
 	ms.AddPartService(partServices)
+	ApplyHealthCfg(mc, ms)
 	services := ms.GetMointorServices()
 	var str string
 	for _, service := range services {
 		str += service + "\n"
 	}
-	logdoo.InfoDoo(fmt.Sprintf("LoadCfgService cur monitor services:%d\r\n%s", len(services), str))
+	logdoo.Info("LoadCfgService cur monitor services", logdoo.Int("count", len(services)), logdoo.String("services", str))
 
 	return nil
 }
 
-//UpdateCfgService 配置文件修改时更新同时更新监控数据
+//UpdateCfgService 配置文件修改时更新同时更新监控数据(配置无效时保留原来的配置)
 func UpdateCfgService(mc *MonitorCfg, ms *MonitorService, e *Email, cfgPath string) error {
-	if err := mc.LoadCfg(cfgPath); err != nil {
-		return fmt.Errorf("LoadCfg err:%s", err)
+	diff, err := mc.LoadCfg(cfgPath)
+	if err != nil {
+		return fmt.Errorf("LoadCfg err:%s, keep the last config", err)
 	}
 
+	before := ms.GetMointorServices()
+	ApplyLogCfg(mc.GetLogCfg())
 	e.UpdateEmail(mc.GetEmailData())
+	ms.ApplyTimerCfg(mc.GetTimerCfg(), mc, e)
 	specServices := mc.GetSpecServices()
 	partServices := mc.GetPartServices()
 	ms.UpdateServices(specServices, partServices)
+	ApplyHealthCfg(mc, ms)
 	services := ms.GetMointorServices()
+	diff.AddedServices, diff.RemovedServices = DiffNames(before, services)
+	mc.SetLastDiff(diff)
+
 	var str string
 	for _, service := range services {
 		str += service + "\n"
 	}
-	logdoo.InfoDoo(fmt.Sprintf("UpdateCfgService cur monitor services:%d\r\n%s", len(services), str))
+	logdoo.Info("UpdateCfgService config diff", logdoo.String("diff", diff.String()))
+	logdoo.Info("UpdateCfgService cur monitor services", logdoo.Int("count", len(services)), logdoo.String("services", str))
 
 	return nil
 }
 
+//ApplyHealthCfg 应用依赖关系、恢复步骤、hook脚本、健康检查、日记监控、资源监控以及主机检查相关的配置
+func ApplyHealthCfg(mc *MonitorCfg, ms *MonitorService) {
+	ms.SetDependGraph(mc.GetDependGraph())
+	ms.SetRecovery(mc.GetRecoveries(), healthMonitor)
+	ms.SetHooks(mc.GetHooks())
+	probe.SetScriptConcurrency(mc.GetScriptConcurrency())
+	healthMonitor.Update(mc.GetHealthChecks(), ms)
+	logWatchMonitor.Update(mc.GetLogWatches(), ms)
+	resourceMonitor.Update(mc.GetResources(), ms)
+	hostMonitor.Update(mc.GetHostCfg(), ms)
+}
+
+//ApplyLogCfg 应用日记相关的配置
+func ApplyLogCfg(lc LogCfg) {
+	logdoo.Console.SetFormat(lc.ConsoleFormat)
+	logdoo.LogInfo.SetFormat(lc.FileFormat)
+	logLevels.Apply("console", logdoo.Console, lc.ConsoleLevel)
+	logLevels.Apply("file", logdoo.LogInfo, lc.FileLevel)
+	logdoo.SetDayLogRotate(lc.Rotate)
+	logdoo.SetDayLogHandleFileSize(lc.MaxSize)
+	logdoo.SetDayLogRetention(lc.Retention)
+	logdoo.SetRedactPatterns(lc.Redact)
+	logdoo.SetRedactKeys(lc.RedactKeys)
+	ApplyLogHandlers(lc)
+}
+
+//ApplyLogHandlers 按配置开启或关闭文件日记的异步输出以及syslog/journald日记,地址或缓冲区大小修改时重新创建
+func ApplyLogHandlers(lc LogCfg) {
+	var stops []func()
+
+	var file logdoo.Handler = logdoo.LogInfo
+	if lc.Async {
+		if asyncLog != nil && asyncLog.Size() == lc.AsyncSize {
+			asyncLog.SetPolicy(lc.AsyncPolicy)
+		} else {
+			if asyncLog != nil {
+				stops = append(stops, asyncLog.Stop)
+			}
+			asyncLog = logdoo.NewAsyncHandler(logdoo.LogInfo, lc.AsyncSize, lc.AsyncPolicy)
+		}
+		file = asyncLog
+	} else if asyncLog != nil {
+		stops = append(stops, asyncLog.Stop)
+		asyncLog = nil
+	}
+	handlers := []logdoo.Handler{logdoo.Console, file}
+
+	if sysLog != nil && (lc.Syslog == "" || sysLog.Addr() != lc.Syslog) {
+		stops = append(stops, sysLog.Close)
+		sysLog = nil
+	}
+	if lc.Syslog != "" && sysLog == nil {
+		network, addr, _ := logdoo.ParseSyslogAddr(lc.Syslog)
+		h, err := logdoo.NewSyslogHandler(network, addr, "GoMonitor")
+		if err != nil {
+			logdoo.Error("open syslog fail", logdoo.String("addr", lc.Syslog), logdoo.Err(err))
+		}
+		sysLog = h
+	}
+	if sysLog != nil {
+		logLevels.Apply("syslog", sysLog, lc.FileLevel)
+		handlers = append(handlers, sysLog)
+	} else {
+		logLevels.Remove("syslog")
+	}
+
+	if journalLog != nil && !lc.Journald {
+		stops = append(stops, journalLog.Close)
+		journalLog = nil
+	}
+	if lc.Journald && journalLog == nil {
+		h, err := logdoo.NewJournaldHandler("", "GoMonitor")
+		if err != nil {
+			logdoo.Error("open journald fail", logdoo.Err(err))
+		}
+		journalLog = h
+	}
+	if journalLog != nil {
+		logLevels.Apply("journald", journalLog, lc.FileLevel)
+		handlers = append(handlers, journalLog)
+	} else {
+		logLevels.Remove("journald")
+	}
+
+	if collectorLog != nil && (collectorLog.Url() != lc.Collector || collectorSpoolSize != lc.CollectorSpoolSize) {
+		stops = append(stops, collectorLog.Close)
+		collectorLog = nil
+	}
+	if lc.Collector != "" && collectorLog == nil {
+		spool := logdoo.LogInfo.Rotator().Dir() + "/collector.spool"
+		h, err := logdoo.NewRemoteHandler(lc.Collector, spool, lc.CollectorSpoolSize*1024*1024)
+		if err != nil {
+			logdoo.Error("open log collector fail", logdoo.String("url", lc.Collector), logdoo.Err(err))
+		}
+		collectorLog, collectorSpoolSize = h, lc.CollectorSpoolSize
+	}
+	if collectorLog != nil {
+		logLevels.Apply("collector", collectorLog, lc.FileLevel)
+		handlers = append(handlers, collectorLog)
+	} else {
+		logLevels.Remove("collector")
+	}
+
+	//先替换再停止旧的,旧的缓冲区中剩余的日记会输出完
+	logdoo.SetHandlers(handlers...)
+	for _, stop := range stops {
+		stop()
+	}
+}
+
 //UpdateMoniService 用于定时任务定时刷新任务管理器中需要监控的服务
 func UpdateMoniService(mc *MonitorCfg, ms *MonitorService, e *Email, cfgPath string) error {
 
@@ -141,54 +321,84 @@ func UpdateMoniService(mc *MonitorCfg, ms *MonitorService, e *Email, cfgPath str
 	for _, service := range services {
 		str += service + "\n"
 	}
-	logdoo.InfoDoo(fmt.Sprintf("UpdateMoniService cur monitor services:%d\r\n%s", len(services), str))
+	logdoo.Info("UpdateMoniService cur monitor services", logdoo.Int("count", len(services)), logdoo.String("services", str))
 
 	return nil
 }
 
-//WatchCfgFile 监控配置文件是否有被修改了
-func WatchCfgFile(cfgPath string, hasModify chan<- int) {
+//WatchCfgFile 监控配置文件(以及它include的文件)是否有被修改了,done关闭时退出
+func WatchCfgFile(cfgPath string, mc *MonitorCfg, hasModify chan<- int, done <-chan struct{}) {
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		logdoo.WarnDoo("watcher cfg file modify err:", err)
+		logdoo.Warn("watcher cfg file modify fail", logdoo.Err(err))
+		return
 	}
 	defer watcher.Close()
 
-	stop := make(chan int)
-	defer close(stop)
-
-	//开协程监听文件是否别修改
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					hasModify <- WatcherStop
-					stop <- WatcherStop
-					return
-				}
+	//include的文件可能随配置修改而变化,定时把新的文件加入监听
+	watched := make(map[string]bool)
+	syncFiles := func() {
+		files := append([]string{cfgPath}, mc.GetCfgFiles()...)
+		for _, file := range files {
+			if watched[file] {
+				continue
+			}
+			if err := watcher.Add(file); err != nil {
+				logdoo.Warn("add watcher cfg file fail", logdoo.String("file", file), logdoo.Err(err))
+				continue
+			}
+			watched[file] = true
+		}
+	}
+	syncFiles()
 
-				//当前监控的配置文件有write操作了证明被修改了
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					hasModify <- WatcherModify
-				}
+	timer := time.NewTicker(time.Second)
+	defer timer.Stop()
+
+	notify := func(event int) bool {
+		select {
+		case hasModify <- event:
+			return true
+		case <-done:
+			return false
+		}
+	}
 
-			case _, ok := <-watcher.Errors:
-				if !ok {
-					hasModify <- WatcherStop
-					stop <- WatcherStop
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				notify(WatcherStop)
+				return
+			}
+
+			//当前监控的配置文件有write操作了证明被修改了
+			if event.Op&fsnotify.Write == fsnotify.Write && !notify(WatcherModify) {
+				return
+			}
+
+			//文件被删除或者被替换(有些编辑器保存时是先写临时文件再改名)时监听会失效,需重新加入
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				delete(watched, event.Name)
+				if !notify(WatcherModify) {
 					return
 				}
 			}
-		}
-	}()
 
-	if err := watcher.Add(cfgPath); err != nil {
-		logdoo.WarnDoo("Add watcher cfg file modify err:", err)
-	}
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				notify(WatcherStop)
+				return
+			}
+
+		case <-timer.C:
+			syncFiles()
 
-	<-stop
+		case <-done:
+			return
+		}
+	}
 }
 
 //PathExists 判断路径是否存在
@@ -222,6 +432,12 @@ func CreateLogDir(logName string) (string, error) {
 	return logpath, nil
 }
 
+//GetCfgDir 获取当前配置文件所在目录
+func GetCfgDir() string {
+	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+	return dir + "\\monitorCfg"
+}
+
 //GetCfgPath 获取当前配置文件的路径
 func GetCfgPath() (string, error) {
 	// 获取当前路径
@@ -249,13 +465,124 @@ func GetCfgPath() (string, error) {
 		initContent := "#[Machine] 当前机器的标识名称\r\n" +
 			"#[SpecInfo] 指定具体监控服务名Name(x) 以及该服务重启时需发送的附件Attach(x)\r\n" +
 			"#[PartInfo] 指定监控服务名Name(x),支持模糊匹配(即service1表示监控含有service1开头的所有服务)，支持!运算(即!service1表示不监控含有service1名开头的服务)\r\n" +
-			"#[EmailInfo] 邮件配置信息\r\n" +
-			"#[Timer] 定时任务配置,其中RefreshCfg表示多少秒刷新监控的service,改参数修改需要重启服务后生效\r\n\n" +
+			"#[EmailInfo] 邮件配置信息,SendP支持引用(env:变量名,file:文件路径,secret:名字(通过encrypt命令加密保存))\r\n" +
+			"#[Include] 引用公共配置文件\r\n" +
+			"#  File(x) 引用的文件,支持相对当前文件的路径\r\n" +
+			"#  当前文件的配置会覆盖引用文件中的同名配置\r\n" +
+			"#  所有配置值支持${环境变量}\r\n" +
+			"#[Log] 日记配置\r\n" +
+			"#  ConsoleFormat/FileFormat 控制台和文件日记的格式(text或json)\r\n" +
+			"#  ConsoleLevel/FileLevel 控制台和文件日记的最低级别(debug/info/warn/error)\r\n" +
+			"#  MaxDays/MaxTotalSize(MB)/MaxFiles 日记文件的保留策略(0不限制)\r\n" +
+			"#  Compress=1 切换文件后压缩旧日记\r\n" +
+			"#  Rotate 文件切换方式(daily/hourly/size)\r\n" +
+			"#  MaxSize 单个文件最大大小(MB)\r\n" +
+			"#  Async=1 文件日记异步输出\r\n" +
+			"#  AsyncSize 缓冲区条数\r\n" +
+			"#  AsyncPolicy 缓冲区满时的处理(block/drop_oldest/drop_newest)\r\n" +
+			"#  Syslog syslog地址(udp://host:514、tcp://host:601、unix:///dev/log或local),使用FileLevel\r\n" +
+			"#  Journald=1 输出到journald,使用FileLevel\r\n" +
+			"#  Collector 远程日记收集服务地址(http(s)://按行发送json,tcp://host:port),使用FileLevel\r\n" +
+			"#  CollectorSpoolSize 发送失败时磁盘缓冲的上限(MB)\r\n" +
+			"#  Redact 内置的脱敏规则(password,token,email,path)\r\n" +
+			"#  RedactPattern1..N 自定义的脱敏正则(第一个捕获组保留)\r\n" +
+			"#  RedactKey 值需要整体脱敏的字段名(逗号分隔)\r\n" +
+			"#[Api] 本地控制接口\r\n" +
+			"#  Open=1 开启\r\n" +
+			"#  Addr 监听地址(如127.0.0.1:9980),只接受本机的请求\r\n" +
+			"#  Token 不为空时其它机器带上 Authorization: Bearer <Token> 也可以访问\r\n" +
+			"#  GET /cfg/diff 查看最近一次配置加载的差异\r\n" +
+			"#  GET/POST /log/level?handler=file&level=info 查看/修改日记级别,handler为console/file/syslog/journald/collector,修改的级别重新加载配置后仍然保留,level=config恢复为配置中的级别\r\n" +
+			"#[Remote] 远程公共配置,当前文件的配置会覆盖远程配置\r\n" +
+			"#  Open=1 开启\r\n" +
+			"#  Url HTTP地址(支持ETag)\r\n" +
+			"#  Path 共享目录下的配置文件(没有Url时使用)\r\n" +
+			"#  Interval 拉取间隔(最小10s)\r\n" +
+			"#  Cache 本地缓存文件(拉取失败或者校验不通过时使用最后一次有效的缓存)\r\n" +
+			"#  远程配置最大1MB,只能包含[Machine] [SpecInfo] [PartInfo] [Timer] [HttpProbe] [TcpCheck] [UdpCheck] [Resource] [HostCheck] [Depend],其余的section会被丢弃(只能写在本地配置中)\r\n" +
+			"#  远程配置中的[SpecInfo] AttachX、env:/file:/secret:引用和${ENV}同样会被丢弃\r\n" +
+			"#[Timer] 定时任务配置,时间支持300s、10ms、5m格式(纯数字表示秒),修改后重新加载即生效\r\n" +
+			"#  RefreshInterval 刷新监控的service的间隔\r\n" +
+			"#  CheckInterval 检查service状态的间隔\r\n" +
+			"#  RestartWorkers 同时重启service的协程数\r\n" +
+			"#  EmailInterval 同一service两次邮件通知的最小间隔(0不限制)\r\n" +
+			"#[HttpProbe] HTTP健康检查,不健康时先停止再启动service并发送通知,GET /health 查看所有健康检查的状态\r\n" +
+			"#  ServiceN 检查的service\r\n" +
+			"#  UrlN 请求地址\r\n" +
+			"#  MethodN 请求方法(默认GET)\r\n" +
+			"#  StatusN 期望的状态码(逗号分隔,默认2xx)\r\n" +
+			"#  BodyN 返回内容需要匹配的正则\r\n" +
+			"#  InsecureN=1 不校验https证书(自签名证书)\r\n" +
+			"#  TimeoutN 单次超时(默认5s)\r\n" +
+			"#  IntervalN 检查间隔(默认30s)\r\n" +
+			"#  ThresholdN 连续失败多少次认为不健康(默认3)\r\n" +
+			"#[TcpCheck]/[UdpCheck] 端口检查,连续失败达到阈值时service标记为不健康并先停止再启动\r\n" +
+			"#  ServiceN 检查的service\r\n" +
+			"#  AddrN host:port\r\n" +
+			"#  SendN 连接后发送的内容(支持\\r\\n\\xHH转义,UDP必填)\r\n" +
+			"#  ExpectN 返回内容需要匹配的正则(TCP为空时连接成功即可)\r\n" +
+			"#  TimeoutN IntervalN ThresholdN 同[HttpProbe]\r\n" +
+			"#[ScriptCheck] 脚本检查,命令行 check <service> [检查名] 可以单独运行一次检查\r\n" +
+			"#  ServiceN 检查的service\r\n" +
+			"#  CommandN 检查的命令行,按Nagios插件约定:退出码0正常,1警告只记日记,2异常,3未知也算失败\r\n" +
+			"#           输出会带到通知中,环境变量GOMONITOR_SERVICE/GOMONITOR_CHECK\r\n" +
+			"#  TimeoutN IntervalN ThresholdN 同[HttpProbe]\r\n" +
+			"#  Concurrency 同时运行的检查脚本数(默认4,[Hook]和[Recovery]的脚本不受限制)\r\n" +
+			"#[StaleCheck] 心跳检查\r\n" +
+			"#  ServiceN 检查的service\r\n" +
+			"#  PathN 心跳文件或者日记目录(默认为[SpecInfo]中的AttachN)\r\n" +
+			"#  MaxAgeN 超过这个时间(纯数字表示秒)没有修改认为service挂起了(同时参考文件修改时间和fsnotify的写入事件)\r\n" +
+			"#  TimeoutN IntervalN ThresholdN 同[HttpProbe]\r\n" +
+			"#[LogWatch] 日记监控\r\n" +
+			"#  ServiceN service\r\n" +
+			"#  PathN 日记文件或者目录(跟踪目录下最后修改的文件,默认为[SpecInfo]中的AttachN,支持切换、截断和替换)\r\n" +
+			"#  PatternN 需要告警的行的正则(如FATAL|OutOfMemory)\r\n" +
+			"#  ContextN 通知中带上匹配行前后各多少行(默认5)\r\n" +
+			"#  CooldownN 同一规则两次通知的最小间隔(默认5m)\r\n" +
+			"#  RestartN=1 匹配时先停止再启动service\r\n" +
+			"#[Resource] 资源监控(包括子进程),GET /metrics Prometheus格式的指标,GET /resource 最近一次采集的资源使用\r\n" +
+			"#  ServiceN service\r\n" +
+			"#  CPUN CPU使用率(占整机的百分比)\r\n" +
+			"#  RSSN 内存(MB)\r\n" +
+			"#  HandlesN 句柄数\r\n" +
+			"#  ThreadsN 线程数(0或不配置表示不检查)\r\n" +
+			"#  DurationN 持续超过阈值多久才处理(默认1m)\r\n" +
+			"#  IntervalN 采集间隔(默认10s)\r\n" +
+			"#  ActionN 超过阈值时notify只通知或restart先停止再启动\r\n" +
+			"#[HostCheck] 主机检查(有这个section才检查),同一项超过阈值只通知一次,恢复后才会再次通知\r\n" +
+			"#  Interval 检查间隔(默认1m)\r\n" +
+			"#  DiskN 需要检查剩余空间的目录\r\n" +
+			"#  DiskMinFreeN 最少剩余空间(10%表示百分比,纯数字表示MB,默认10%)\r\n" +
+			"#  LogMinFree 日记目录所在磁盘的最少剩余空间(默认10%)\r\n" +
+			"#  MemMinFree 最少可用内存\r\n" +
+			"#  MaxLoad 最大的1分钟平均负载(Windows为CPU繁忙的核数)\r\n" +
+			"#  Hysteresis 恢复时需要超过阈值的百分比(默认10)\r\n" +
+			"#[Depend] service之间的依赖,被依赖的先重启,加载配置时会检查循环依赖\r\n" +
+			"#  ServiceN 依赖其他service的service(以*结尾表示前缀匹配,如Doo_*)\r\n" +
+			"#  OnN 被依赖的service(逗号分隔,也需要在监控中),被依赖的service没有正常运行时不重启ServiceN\r\n" +
+			"#  RestartAfterN=1 被依赖的service重启恢复后也重启ServiceN\r\n" +
+			"#  FromScm=1 同时使用服务管理器中配置的依赖\r\n" +
+			"#[Recovery] service的恢复步骤(代替直接启动),每一步的结果记录在日记和通知中\r\n" +
+			"#  ServiceN service\r\n" +
+			"#  StepsN 逗号分隔的步骤:\r\n" +
+			"#    stop[:超时] 正常停止(默认30s)\r\n" +
+			"#    kill 停止超时时杀掉进程\r\n" +
+			"#    script[:超时]:命令行 运行清理脚本(如删除锁文件,默认超时1m)\r\n" +
+			"#    start[:参数] 带参数启动(必须有)\r\n" +
+			"#    wait[:超时] 等待健康检查通过(没有健康检查时等待进入运行状态,默认1m)\r\n" +
+			"#[Hook] service重启前后运行的脚本(如保存日记、清理缓存、通知负载均衡),脚本的输出会带到通知中\r\n" +
+			"#  ServiceN service\r\n" +
+			"#  PreRestartN 重启前运行的命令行\r\n" +
+			"#  PostRestartN 重启后运行的命令行\r\n" +
+			"#  TimeoutN 超时(默认1m)\r\n" +
+			"#  VetoN=1 PreRestart失败(退出码非0或者超时)时取消这次重启(5分钟后再次尝试,连续取消只在第一次发送通知)\r\n" +
+			"#  环境变量GOMONITOR_EVENT(pre_restart/post_restart) GOMONITOR_SERVICE GOMONITOR_MACHINE\r\n" +
+			"#          GOMONITOR_REASON GOMONITOR_DETAIL GOMONITOR_TIME GOMONITOR_RESULT(post_restart时为success/fail)\r\n\n" +
 			"[Machine]\r\nName=TradeA\r\n\n" +
 			"[SpecInfo]\r\nName1=myservice\r\nAttach1=D:\\MyService\\Log\r\n\n" +
 			"[PartInfo]\r\nName1=Doo_\r\nName2=!Doo_MonitorService\r\n\n" +
 			"[EmailInfo]\r\nOpen=0\r\nHost=smtp.qq.com\r\nPort=25\r\nSendU=eamil@qq.com\r\nSendP=password\r\nReceiveU=email1@163.com,email2@qq.com\r\n\n" +
-			"[Timer]\r\nRefresh=300"
+			"[Timer]\r\nRefreshInterval=300s\r\nCheckInterval=10ms\r\nRestartWorkers=10\r\nEmailInterval=0s"
 
 		file.WriteString(initContent)
 	}
@@ -279,13 +606,13 @@ func GetAttachByPath(path string) (attach string) {
 	}
 
 	if !PathExists(path) {
-		logdoo.ErrorDoo("path", path, "no exist")
+		logdoo.Error("attach path no exist", logdoo.String("path", path))
 		return ""
 	}
 
 	attach, err := GetLastModFilesByPath(path)
 	if err != nil {
-		logdoo.ErrorDoo("GetLastModFilesByPath err:", err, "attach path", path)
+		logdoo.Error("GetLastModFilesByPath fail", logdoo.String("path", path), logdoo.Err(err))
 		return ""
 	}
 
@@ -294,25 +621,10 @@ func GetAttachByPath(path string) (attach string) {
 
 //GetLastModFilesByPath 获取指定目录下最后修改的文件
 func GetLastModFilesByPath(dirPth string) (files string, err error) {
-	dir, err := ioutil.ReadDir(dirPth)
-	if err != nil {
+	last, err := GetLastModFile(dirPth)
+	if err != nil || last == nil {
 		return "", err
 	}
 
-	PthSep := string(os.PathSeparator)
-	var tempFile os.FileInfo
-	for i, fi := range dir {
-		if !fi.IsDir() {
-			if i == 0 {
-				tempFile = fi
-			} else {
-				if tempFile.ModTime().Before(fi.ModTime()) {
-					tempFile = fi
-				}
-			}
-			files = dirPth + PthSep + tempFile.Name()
-		}
-	}
-
-	return files, nil
+	return dirPth + string(os.PathSeparator) + last.Name(), nil
 }
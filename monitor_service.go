@@ -2,6 +2,8 @@ package main
 
 import (
 	"GoMonitor/logdoo"
+	"fmt"
+	"html"
 	"strings"
 	"sync"
 	"syscall"
@@ -14,59 +16,96 @@ import (
 )
 
 const (
-	ServiceChanNum = 10
+	ServiceChanNum = 10 //默认同时重启service的协程数
 )
 
+//LogLimitWindow 重复出现的错误日记的输出间隔
+const LogLimitWindow = time.Minute
+
+//ServiceStopTimeout 先停止再重启时等待service停止的最长时间
+const ServiceStopTimeout = 30 * time.Second
+
+//StoppedReason service停止后重启时通知的标题
+const StoppedReason = "has stop and restart!"
+
+//RestartTask 交给重启协程的任务
+type RestartTask struct {
+	Service   mgr.Service
+	Reason    string //通知标题中service名后面的说明
+	Detail    string //通知内容中的详细原因(如健康检查的输出)
+	StopFirst bool   //service还在运行(如健康检查失败),需要先停止再启动
+}
+
 const (
-	ServiceStoped  = 1
-	ServicePending = 2
-	ServiceRuning  = 3
-	ServiceUnknow  = 4
+	ServiceStoped    = 1
+	ServicePending   = 2
+	ServiceRuning    = 3
+	ServiceUnknow    = 4
+	ServiceUnhealthy = 5 //service在运行但健康检查连续失败
+	ServiceVetoed    = 6 //service已停止,PreRestart hook取消了重启,VetoRetryAfter后才再次尝试
 )
 
+//VetoRetryAfter 重启被PreRestart hook取消后,多久再次尝试重启
+const VetoRetryAfter = 5 * time.Minute
+
 type MonitorService struct {
-	scm                 *mgr.Mgr                //任务管理器连接
-	services            map[string]*mgr.Service //serviceName 与 实例句柄的映射
-	serviceEmail        map[string]bool         //当前服务监控过程是否已经发送过邮件通知了
-	serviceState        map[string]int          //记录当前服务的状态
-	serviceAddChan      []chan mgr.Service      //处理要监控的service的chan队列,当前要重启那个service就把对应的service放入改chan中
-	serviceAddChanIndex map[int]bool            //记录改service的chan是否有在处理中
-	curAddChanIndex     int                     //记录最后一个用到的service的chan
-	serviceDelChan      chan mgr.Service        //处理当前要移除那个service的chan队列,要移除对那个service的监控就把该service放入这个chan中
-	stop                bool                    //监控功能是否停止了
-	stopChan            chan bool               //停止监控通知
+	scm                 *mgr.Mgr                  //任务管理器连接
+	services            map[string]*mgr.Service   //serviceName 与 实例句柄的映射
+	serviceEmail        map[string]bool           //当前服务监控过程是否已经发送过邮件通知了
+	serviceEmailTime    map[string]time.Time      //当前服务最后一次发送邮件通知的时间
+	serviceState        map[string]int            //记录当前服务的状态
+	serviceAddChan      []chan RestartTask        //处理要监控的service的chan队列,当前要重启那个service就把对应的service放入改chan中
+	serviceAddChanIndex map[int]bool              //记录改service的chan是否有在处理中
+	curAddChanIndex     int                       //记录最后一个用到的service的chan
+	workerNum           int                       //当前使用的重启协程数(缩减时多出的协程空闲不再分配任务)
+	checkInterval       time.Duration             //检查service状态的间隔
+	emailInterval       time.Duration             //同一service两次邮件通知的最小间隔
+	serviceDelChan      chan mgr.Service          //处理当前要移除那个service的chan队列,要移除对那个service的监控就把该service放入这个chan中
+	stop                bool                      //监控功能是否停止了
+	stopChan            chan bool                 //停止监控通知
+	cfg                 *MonitorCfg               //发送通知时使用的配置
+	email               *Email                    //发送通知时使用的邮件
+	depend              *DependGraph              //service之间的依赖关系
+	scmDeps             map[string][]string       //服务管理器中配置的依赖(缓存)
+	running             map[string]bool           //最近一次检查时service是否在运行
+	recovery            map[string][]RecoveryStep //配置了恢复步骤的service
+	waiter              HealthWaiter              //恢复步骤中等待健康检查通过
+	hooks               map[string]HookCfg        //重启前后运行的hook脚本
+	vetoUntil           map[string]time.Time      //重启被PreRestart hook取消的service,到这个时间之前不再重启
+	limitLog            *logdoo.Context           //会重复出现的错误日记,同样的日记每LogLimitWindow只输出一次
 	mu                  sync.RWMutex
 }
 
 func NewMonitorService() *MonitorService {
 	manager, err := mgr.Connect()
 	if err != nil {
-		logdoo.ErrorDoo("NewMonitorService fail to open mgr err", err)
+		logdoo.Error("NewMonitorService fail to open mgr", logdoo.Err(err))
 		return nil
 	}
 	return &MonitorService{scm: manager,
 		services:            make(map[string]*mgr.Service),
 		serviceEmail:        make(map[string]bool),
+		serviceEmailTime:    make(map[string]time.Time),
 		serviceState:        make(map[string]int),
-		serviceAddChan:      make([]chan mgr.Service, ServiceChanNum),
+		scmDeps:             make(map[string][]string),
+		running:             make(map[string]bool),
+		recovery:            make(map[string][]RecoveryStep),
+		hooks:               make(map[string]HookCfg),
+		vetoUntil:           make(map[string]time.Time),
+		serviceAddChan:      make([]chan RestartTask, 0, ServiceChanNum),
 		serviceAddChanIndex: make(map[int]bool, ServiceChanNum),
 		curAddChanIndex:     0,
+		checkInterval:       10 * time.Millisecond,
 		serviceDelChan:      make(chan mgr.Service, 100),
 		stop:                false,
-		stopChan:            make(chan bool)}
+		stopChan:            make(chan bool),
+		limitLog:            logdoo.Limited(LogLimitWindow)}
 }
 
 //StartMonitor 开始监控功能
 func (ms *MonitorService) StartMonitor(c *MonitorCfg, e *Email) {
 
-	for i := 0; i < ServiceChanNum; i++ {
-		ms.serviceAddChan[i] = make(chan mgr.Service)
-		ms.serviceAddChanIndex[i] = false
-	}
-
-	for i := 0; i < ServiceChanNum; i++ {
-		go ms.Addmonitor(i, c, e)
-	}
+	ms.ApplyTimerCfg(c.GetTimerCfg(), c, e)
 
 	go ms.DelMonitor()
 
@@ -77,18 +116,49 @@ func (ms *MonitorService) StartMonitor(c *MonitorCfg, e *Email) {
 			if ms.stop {
 				ok = false
 			}
+			interval := ms.checkInterval
 			ms.mu.RUnlock()
 
 			ms.LoopCheck()
 			ms.RefreshServiceHandle()
-			time.Sleep(10 * time.Millisecond)
+			time.Sleep(interval)
 		}
 	}(ms)
 }
 
-//LoopCheck 轮训检查一遍服务
+//ApplyTimerCfg 应用定时相关的配置(检查间隔、重启协程数、邮件通知间隔)
+func (ms *MonitorService) ApplyTimerCfg(t TimerCfg, c *MonitorCfg, e *Email) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.stop {
+		return
+	}
+
+	ms.checkInterval = t.CheckInterval
+	ms.emailInterval = t.EmailInterval
+	ms.cfg, ms.email = c, e
+
+	if t.RestartWorkers == ms.workerNum {
+		return
+	}
+	logdoo.Info("restart workers change", logdoo.Int("from", ms.workerNum), logdoo.Int("to", t.RestartWorkers))
+
+	//不够的协程新建,多出的协程不关闭(可能正在发送任务给它),只是不再分配任务
+	for i := len(ms.serviceAddChan); i < t.RestartWorkers; i++ {
+		ch := make(chan RestartTask)
+		ms.serviceAddChan = append(ms.serviceAddChan, ch)
+		ms.serviceAddChanIndex[i] = false
+		go ms.Addmonitor(i, ch, c, e)
+	}
+	ms.workerNum = t.RestartWorkers
+	ms.curAddChanIndex = ms.curAddChanIndex % ms.workerNum
+}
+
+//LoopCheck 轮训检查一遍服务,依赖的service没有运行时不重启,被依赖的先重启
 func (ms *MonitorService) LoopCheck() {
-	var sers = make([]mgr.Service, 0)
+	var tasks = make([]RestartTask, 0)
+	var stopped = make([]string, 0)
 	ms.mu.Lock()
 	for _, service := range ms.services {
 		if service == nil {
@@ -102,7 +172,7 @@ func (ms *MonitorService) LoopCheck() {
 
 		status, err := service.Query()
 		if err != nil {
-			logdoo.ErrorDoo("Query service", service.Name, "err", err)
+			ms.limitLog.With("service", service.Name).Error("query service fail", logdoo.Err(err))
 			if v, ok := ms.services[service.Name]; ok {
 				if v != nil {
 					ms.services[service.Name].Close()
@@ -112,37 +182,242 @@ func (ms *MonitorService) LoopCheck() {
 			continue
 		}
 
-		if status.State == svc.Stopped {
-			sers = append(sers, *service)
-			ms.serviceState[service.Name] = ServicePending
+		ms.running[service.Name] = status.State == svc.Running
+		if status.State == svc.Running && ms.serviceState[service.Name] == ServiceVetoed {
+			//取消重启后service被手动启动了
+			ms.serviceState[service.Name] = ServiceRuning
+			delete(ms.vetoUntil, service.Name)
 		}
+		if status.State == svc.Stopped && !ms.vetoed(service.Name) {
+			stopped = append(stopped, service.Name)
+		}
+	}
+
+	SortByDepend(stopped, ms.dependsOf)
+	for _, name := range stopped {
+		if down := ms.downDeps(name); len(down) > 0 {
+			ms.limitLog.With("service", name).Warn("dependency is down, suppress restart", logdoo.String("depend", strings.Join(down, ",")))
+			continue
+		}
+		tasks = append(tasks, RestartTask{Service: *ms.services[name], Reason: StoppedReason})
+		ms.serviceState[name] = ServicePending
 	}
 	ms.mu.Unlock()
 
-	for _, service := range sers {
-		ms.serviceAddChan[ms.GetIdleChanIndex()] <- service
+	for _, task := range tasks {
+		ms.GetIdleChan() <- task
 	}
 }
 
-//GetIdleChanIndex 获取空闲的ChanIndex(内部会死循环直到能获取到)
-func (ms *MonitorService) GetIdleChanIndex() int {
-	ok := true
-	v := false
+//RequestRestart 请求重启一个在监控中的service(如健康检查失败),service不在监控中或者正在重启时返回false
+func (ms *MonitorService) RequestRestart(name, reason, detail string, stopFirst bool) bool {
+	ms.mu.Lock()
+	service, ok := ms.services[name]
+	if !ok || service == nil || ms.stop || ms.serviceState[name] == ServicePending {
+		ms.mu.Unlock()
+		return false
+	}
+	if ms.vetoed(name) {
+		ms.limitLog.With("service", name).Info("restart vetoed recently, suppress restart", logdoo.Time("retry_after", ms.vetoUntil[name]), logdoo.String("reason", reason))
+		ms.mu.Unlock()
+		return false
+	}
+	if down := ms.downDeps(name); len(down) > 0 {
+		ms.limitLog.With("service", name).Warn("dependency is down, suppress restart", logdoo.String("depend", strings.Join(down, ",")), logdoo.String("reason", reason))
+		ms.mu.Unlock()
+		return false
+	}
+	ms.serviceState[name] = ServicePending
+	ms.mu.Unlock()
+
+	ms.GetIdleChan() <- RestartTask{Service: *service, Reason: reason, Detail: detail, StopFirst: stopFirst}
+	return true
+}
+
+//vetoed service的重启是否被PreRestart hook取消了并且还没到再次尝试的时间(调用者需要加锁)
+func (ms *MonitorService) vetoed(name string) bool {
+	until, ok := ms.vetoUntil[name]
+	return ok && time.Now().Before(until)
+}
+
+//SetRecovery 更新service的恢复步骤,waiter用于等待健康检查通过
+func (ms *MonitorService) SetRecovery(cfgs []RecoveryCfg, waiter HealthWaiter) {
+	recovery := make(map[string][]RecoveryStep, len(cfgs))
+	for _, c := range cfgs {
+		recovery[c.Service] = c.Steps
+	}
+
+	ms.mu.Lock()
+	ms.recovery, ms.waiter = recovery, waiter
+	ms.mu.Unlock()
+}
+
+//SetHooks 更新service重启前后运行的hook脚本
+func (ms *MonitorService) SetHooks(cfgs []HookCfg) {
+	hooks := make(map[string]HookCfg, len(cfgs))
+	for _, c := range cfgs {
+		hooks[c.Service] = c
+	}
+
+	ms.mu.Lock()
+	ms.hooks = hooks
+	ms.mu.Unlock()
+}
+
+//SetDependGraph 更新service之间的依赖关系
+func (ms *MonitorService) SetDependGraph(g *DependGraph) {
+	ms.mu.Lock()
+	ms.depend = g
+	ms.scmDeps = make(map[string][]string)
+	ms.mu.Unlock()
+}
+
+//dependsOf service直接依赖的service(配置的以及服务管理器中的),调用时需要持有锁
+func (ms *MonitorService) dependsOf(name string) []string {
+	deps := ms.depend.Deps(name)
+	if ms.depend == nil || !ms.depend.FromScm {
+		return deps
+	}
+
+	scm, ok := ms.scmDeps[name]
+	if !ok {
+		if service := ms.services[name]; service != nil {
+			var err error
+			if scm, err = ScmDependencies(service); err != nil {
+				ms.limitLog.With("service", name).Warn("query service dependencies fail", logdoo.Err(err))
+			}
+		}
+		ms.scmDeps[name] = scm
+	}
+	for _, d := range scm {
+		found := false
+		for _, v := range deps {
+			found = found || strings.EqualFold(v, d)
+		}
+		if !found {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+//downDeps service依赖的service中没有在正常运行的(不在监控中的认为在运行),调用时需要持有锁
+func (ms *MonitorService) downDeps(name string) []string {
+	var down []string
+	for _, d := range ms.dependsOf(name) {
+		service, ok := ms.services[d]
+		if !ok {
+			continue
+		}
+		state := ms.serviceState[d]
+		if service == nil || !ms.running[d] || state == ServicePending || state == ServiceStoped || state == ServiceUnhealthy {
+			down = append(down, d)
+		}
+	}
+	return down
+}
+
+//RestartDependents service重启恢复后,重启配置了RestartAfter并且还在运行的依赖它的service(被依赖的先重启)
+func (ms *MonitorService) RestartDependents(name string) {
+	ms.mu.RLock()
+	var names []string
+	for n, service := range ms.services {
+		if service != nil && n != name && ms.running[n] && ms.serviceState[n] != ServicePending && ms.depend.RestartAfter(n, name) {
+			names = append(names, n)
+		}
+	}
+	depend := ms.depend
+	ms.mu.RUnlock()
+
+	SortByDepend(names, depend.Deps)
+	for _, n := range names {
+		logdoo.Info("dependency restarted, restart service", logdoo.String("service", n), logdoo.String("depend", name))
+		ms.RequestRestart(n, DependRestartReason, "dependency "+name+" has restarted", true)
+	}
+}
+
+//ScmDependencies 服务管理器中配置的service的依赖(不包括服务组)
+func ScmDependencies(service *mgr.Service) ([]string, error) {
+	var needed uint32
+	windows.QueryServiceConfig(windows.Handle(service.Handle), nil, 0, &needed)
+	if needed == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig get buffer size fail")
+	}
+	buf := make([]byte, needed)
+	cfg := (*windows.QUERY_SERVICE_CONFIG)(unsafe.Pointer(&buf[0]))
+	if err := windows.QueryServiceConfig(windows.Handle(service.Handle), cfg, needed, &needed); err != nil {
+		return nil, err
+	}
+
+	//Dependencies为以两个\0结尾的多个字符串
+	var deps []string
+	if cfg.Dependencies == nil {
+		return deps, nil
+	}
+	chars := (*[1 << 20]uint16)(unsafe.Pointer(cfg.Dependencies))
+	for start, i := 0, 0; i < len(chars); i++ {
+		if chars[i] != 0 {
+			continue
+		}
+		if i == start {
+			break
+		}
+		if s := windows.UTF16ToString(chars[start:i]); !strings.HasPrefix(s, "+") {
+			deps = append(deps, s)
+		}
+		start = i + 1
+	}
+	return deps, nil
+}
+
+//SetHealthy 健康检查的结果,连续失败达到阈值时标记为不健康,恢复后标记为运行中(正在重启的不修改)
+func (ms *MonitorService) SetHealthy(name string, healthy bool) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	for ok {
-		if v, ok = ms.serviceAddChanIndex[ms.curAddChanIndex]; ok {
-			if v == false {
-				index := ms.curAddChanIndex
+
+	if _, ok := ms.services[name]; !ok {
+		return
+	}
+	switch state := ms.serviceState[name]; {
+	case !healthy && state != ServicePending:
+		ms.serviceState[name] = ServiceUnhealthy
+	case healthy && state == ServiceUnhealthy:
+		ms.serviceState[name] = ServiceRuning
+	}
+}
+
+//GetUnhealthyServices 获取当前健康检查不通过的服务列表
+func (ms *MonitorService) GetUnhealthyServices() (services []string) {
+	ms.mu.RLock()
+	for k, v := range ms.serviceState {
+		if v == ServiceUnhealthy {
+			services = append(services, k)
+		}
+	}
+	ms.mu.RUnlock()
+
+	return services
+}
+
+//GetIdleChan 获取空闲的重启协程的chan(内部会循环直到能获取到)
+func (ms *MonitorService) GetIdleChan() chan RestartTask {
+	for {
+		ms.mu.Lock()
+		for i := 0; i < ms.workerNum; i++ {
+			index := ms.curAddChanIndex
+			ms.curAddChanIndex = (ms.curAddChanIndex + 1) % ms.workerNum
+			if !ms.serviceAddChanIndex[index] {
 				ms.serviceAddChanIndex[index] = true
-				ms.curAddChanIndex = (ms.curAddChanIndex + 1) % ServiceChanNum
-				return index
+				ch := ms.serviceAddChan[index]
+				ms.mu.Unlock()
+				return ch
 			}
-			ms.curAddChanIndex = (ms.curAddChanIndex + 1) % ServiceChanNum
 		}
-	}
+		ms.mu.Unlock()
 
-	return 0
+		//全部协程都在忙,释放锁等待它们处理完
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
 //RefreshServiceHandle 刷新监控服务的操作句柄
@@ -160,7 +435,7 @@ func (ms *MonitorService) RefreshServiceHandle() {
 		if err == nil {
 			ms.scm = manager
 		} else {
-			logdoo.ErrorDoo("Open service manager err", err)
+			ms.limitLog.Error("open service manager fail", logdoo.Err(err))
 			return
 		}
 	}
@@ -212,7 +487,7 @@ func (ms *MonitorService) Release() {
 
 	ms.stop = true
 
-	for i := 0; i < ServiceChanNum; i++ {
+	for i := range ms.serviceAddChan {
 		close(ms.serviceAddChan[i])
 	}
 
@@ -229,7 +504,7 @@ func (ms *MonitorService) AddSpecService(names []string) *[]string {
 		if err == nil {
 			ms.scm = manager
 		} else {
-			logdoo.ErrorDoo("Open service manager err", err)
+			ms.limitLog.Error("open service manager fail", logdoo.Err(err))
 			return nil
 		}
 	}
@@ -246,7 +521,7 @@ func (ms *MonitorService) AddSpecService(names []string) *[]string {
 		if err != nil {
 			ms.services[name] = nil
 			ms.serviceState[name] = ServiceStoped
-			logdoo.WarnDoo("service:", name, "open err:", err)
+			ms.limitLog.Warn("open service fail", logdoo.String("service", name), logdoo.Err(err))
 		} else {
 			ms.services[name] = service
 			ms.serviceState[name] = ServiceUnknow
@@ -273,7 +548,7 @@ func (ms *MonitorService) AddPartService(names []string) *[]string {
 
 	manager, err := mgr.Connect()
 	if err != nil {
-		logdoo.ErrorDoo("Open service manager err", err)
+		ms.limitLog.Error("open service manager fail", logdoo.Err(err))
 		return nil
 	}
 	defer manager.Disconnect()
@@ -286,7 +561,7 @@ func (ms *MonitorService) AddPartService(names []string) *[]string {
 
 	services := make([]byte, needBuf)
 	if err := windows.EnumServicesStatusEx(windows.Handle(manager.Handle), windows.SC_ENUM_PROCESS_INFO, windows.SERVICE_WIN32, windows.SERVICE_STATE_ALL, (*byte)(unsafe.Pointer(&services[0])), needBuf, &needBuf, &serviceNum, nil, nil); err != nil {
-		logdoo.ErrorDoo("EnumServicesStatusEx get part service list fail err:", err)
+		logdoo.Error("EnumServicesStatusEx get part service list fail", logdoo.Err(err))
 		return nil
 	}
 
@@ -336,7 +611,7 @@ func (ms *MonitorService) AddPartService(names []string) *[]string {
 		if err != nil {
 			ms.services[name] = nil
 			ms.serviceState[name] = ServiceStoped
-			logdoo.WarnDoo("service:", name, "maybe not exist and open err:", err)
+			ms.limitLog.Warn("service maybe not exist and open fail", logdoo.String("service", name), logdoo.Err(err))
 		} else {
 			ms.services[name] = s
 			ms.serviceState[name] = ServiceUnknow
@@ -408,36 +683,139 @@ func (ms *MonitorService) GetStopServices() (services []string) {
 }
 
 //Addmonitor 处理需要尝试启动的服务
-func (ms *MonitorService) Addmonitor(i int, c *MonitorCfg, e *Email) {
-
-	if i >= ServiceChanNum {
-		return
-	}
+func (ms *MonitorService) Addmonitor(i int, ch chan RestartTask, c *MonitorCfg, e *Email) {
 
-	var curState = ServiceUnknow
 	for {
 		select {
-		case service := <-ms.serviceAddChan[i]:
-			ms.SendEmail(service.Name, c, e)
-			logdoo.InfoDoo("goroutine", i, "begin restart service", service.Name)
-			//service.Start 这个函数是阻塞式的,没有及时响应会导致30秒后超时
-			if er := service.Start([]string{service.Name}); er != nil {
-				logdoo.ErrorDoo("goroutine", i, "restart service", service.Name, "err", er)
-				curState = ServiceStoped
-			} else {
-				logdoo.InfoDoo("goroutine", i, "restart service", service.Name, "success")
-				ms.UpdateSendEmailState(service.Name, false)
-				curState = ServiceRuning
+		case task, ok := <-ch:
+			if !ok {
+				return
 			}
 
+			service := task.Service
+			log := logdoo.With("service", service.Name, "worker", i)
+			curState, restarted := ms.restartService(log, task, c, e)
+
 			ms.mu.Lock()
+			ms.serviceAddChanIndex[i] = false
 			if _, ok := ms.services[service.Name]; ok {
-				ms.serviceAddChanIndex[i] = false
 				ms.serviceState[service.Name] = curState
+				ms.running[service.Name] = curState == ServiceRuning
+			}
+			if restarted {
+				delete(ms.vetoUntil, service.Name)
+			}
+			ms.mu.Unlock()
+
+			if restarted && curState == ServiceRuning {
+				go ms.RestartDependents(service.Name)
 			}
+		}
+	}
+}
+
+//restartService 重启service(配置了恢复步骤的按步骤恢复),前后运行hook脚本,
+//返回重启后service的状态以及是否真的重启了(被PreRestart hook取消时为false)
+func (ms *MonitorService) restartService(log *logdoo.Context, task RestartTask, c *MonitorCfg, e *Email) (int, bool) {
+	service := task.Service
+	ms.mu.RLock()
+	steps, waiter := ms.recovery[service.Name], ms.waiter
+	hook, hasHook := ms.hooks[service.Name]
+	ms.mu.RUnlock()
+
+	ev := HookEvent{Service: service.Name, Reason: task.Reason, Detail: task.Detail}
+	if c != nil {
+		ev.Machine = c.GetMachineName()
+	}
+	var hookRecord []string
+	if hook.PreRestart != "" {
+		ev.Event = HookPreRestart
+		record, err := RunHook(log, hook.PreRestart, hook.Timeout, ev)
+		hookRecord = append(hookRecord, record)
+		if err != nil && hook.Veto {
+			//记录取消的时间,VetoRetryAfter内不再重启,连续取消时只在第一次发送通知
+			ms.mu.Lock()
+			_, again := ms.vetoUntil[service.Name]
+			ms.vetoUntil[service.Name] = time.Now().Add(VetoRetryAfter)
 			ms.mu.Unlock()
+
+			log.Warn("restart vetoed by pre_restart hook", logdoo.String("reason", task.Reason), logdoo.Duration("retry_after", VetoRetryAfter), logdoo.Bool("again", again))
+			if !again {
+				task.Reason += " (restart vetoed)"
+				task.Detail = JoinDetail(task.Detail, "hooks", hookRecord)
+				ms.SendEmail(log, task, c, e)
+			}
+			if st, er := service.Query(); er == nil && st.State == svc.Running {
+				return ServiceRuning, false
+			}
+			return ServiceVetoed, false
+		}
+	}
+
+	//有hook时等重启完再发送通知,通知中带上hook的输出
+	if !hasHook && len(steps) == 0 {
+		ms.SendEmail(log, task, c, e)
+	}
+
+	ok := true
+	if len(steps) > 0 {
+		//配置了恢复步骤的按步骤恢复,通知中带上每一步的记录
+		log.Info("begin recovery service", logdoo.String("reason", task.Reason), logdoo.Int("steps", len(steps)))
+		var record []string
+		record, ok = RunRecovery(log, &service, steps, waiter)
+		task.Detail = JoinDetail(task.Detail, "recovery steps", record)
+		if !ok {
+			task.Reason += " (recovery fail)"
+			log.Error("recovery service fail")
+		} else {
+			log.Info("recovery service success")
 		}
+	} else {
+		if task.StopFirst {
+			log.Info("begin stop service", logdoo.String("reason", task.Reason))
+			if er := StopService(&service, ServiceStopTimeout); er != nil {
+				log.Warn("stop service fail, still try to start it", logdoo.Err(er))
+			}
+		}
+		log.Info("begin restart service")
+		//service.Start 这个函数是阻塞式的,没有及时响应会导致30秒后超时
+		if er := service.Start([]string{service.Name}); er != nil {
+			log.Error("restart service fail", logdoo.Err(er))
+			ok = false
+			if hasHook {
+				task.Detail = JoinDetail(task.Detail, "restart", []string{"fail " + er.Error()})
+			}
+		} else {
+			log.Info("restart service success")
+		}
+	}
+
+	if hook.PostRestart != "" {
+		ev.Event, ev.Result = HookPostRestart, "success"
+		if !ok {
+			ev.Result = "fail"
+		}
+		record, _ := RunHook(log, hook.PostRestart, hook.Timeout, ev)
+		hookRecord = append(hookRecord, record)
+	}
+	if hasHook || len(steps) > 0 {
+		task.Detail = JoinDetail(task.Detail, "hooks", hookRecord)
+		ms.SendEmail(log, task, c, e)
+	}
+
+	if !ok {
+		return ServiceStoped, true
 	}
+	ms.UpdateSendEmailState(service.Name, false)
+	return ServiceRuning, true
+}
+
+//JoinDetail 在通知的详细信息后面加上一段记录
+func JoinDetail(detail, title string, lines []string) string {
+	if len(lines) == 0 {
+		return detail
+	}
+	return strings.TrimSpace(detail + "\n\n" + title + ":\n" + strings.Join(lines, "\n"))
 }
 
 //DelMonitor 删除监控释放资源
@@ -445,44 +823,113 @@ func (ms *MonitorService) DelMonitor() {
 	for {
 		select {
 		case service := <-ms.serviceDelChan:
-			logdoo.InfoDoo("delete service:", service.Name, "monitor")
+			logdoo.Info("delete service monitor", logdoo.String("service", service.Name))
 			service.Close()
 		}
 	}
 }
 
-//SendEmail 发送邮件
-func (ms *MonitorService) SendEmail(name string, c *MonitorCfg, e *Email) {
+//SendEmail 重启service时发送邮件通知(同一次停止只通知一次),log为service的子日记
+func (ms *MonitorService) SendEmail(log *logdoo.Context, task RestartTask, c *MonitorCfg, e *Email) {
 	if e == nil {
-		logdoo.WarnDoo("email instance is nil and can't send email please confirm!")
+		log.Warn("email instance is nil and can't send email please confirm!")
 		return
 	}
+	name := task.Service.Name
 
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
-
 	//已经发送过的不再发送了
-	if _, ok := ms.serviceEmail[name]; ok {
-		if ms.serviceEmail[name] {
-			return
-		}
+	if ms.serviceEmail[name] {
+		ms.mu.Unlock()
+		return
+	}
+
+	//距离上次发送的间隔太短的不再发送了
+	if ms.emailInterval > 0 && time.Since(ms.serviceEmailTime[name]) < ms.emailInterval {
+		log.Info("service email throttled", logdoo.Time("last_send", ms.serviceEmailTime[name]))
+		ms.mu.Unlock()
+		return
 	}
+	ms.serviceEmailTime[name] = time.Now()
+	ms.serviceEmail[name] = true
+	ms.mu.Unlock()
 
-	//发送邮件通知有两种(有附件和没附件)
+	//发送邮件通知有两种(有附件和没附件),发送邮件比较慢,不能持有锁
+	content := "<b>please handle</b>"
+	var attachFile string
 	if attach, ok := c.GetServiceAttachPath(name); ok {
-		if GetAttachByPath(attach) != "" {
-			subject := "machine:" + c.GetMachineName() + " service: " + name + " has stop and restart!"
-			content := "<b>The crash file please the attach</b>"
-			e.SendEmailEx(subject, content, GetAttachByPath(attach))
-			ms.serviceEmail[name] = true
-			return
+		if attachFile = GetAttachByPath(attach); attachFile != "" {
+			content = "<b>The crash file please the attach</b>"
 		}
 	}
+	SendServiceEmail(log, c, e, name, task.Reason, content+DetailHtml(task.Detail), attachFile)
+}
 
-	subject := "machine:" + c.GetMachineName() + " service: " + name + " has stop and restart!"
-	content := "<b>please handle</b>"
-	e.SendEmail(subject, content)
-	ms.serviceEmail[name] = true
+//Notify 发送service相关的通知但不重启service(如日记中出现了错误)
+func (ms *MonitorService) Notify(name, reason, detail string) {
+	ms.mu.RLock()
+	c, e := ms.cfg, ms.email
+	ms.mu.RUnlock()
+
+	if c == nil || e == nil {
+		return
+	}
+	SendServiceEmail(logdoo.With("service", name), c, e, name, reason, "<b>please handle</b>"+DetailHtml(detail), "")
+}
+
+//NotifyHost 发送主机相关的通知(如磁盘空间不足),标题带上机器名
+func (ms *MonitorService) NotifyHost(reason, detail string) {
+	ms.mu.RLock()
+	c, e := ms.cfg, ms.email
+	ms.mu.RUnlock()
+
+	if c == nil || e == nil {
+		return
+	}
+	machine := c.GetMachineName()
+	e.SendEmail(logdoo.With("machine", machine), "machine:"+machine+" host "+reason, "<b>please handle</b>"+DetailHtml("machine: "+machine+"\n"+detail))
+}
+
+//SendServiceEmail 发送service相关的邮件,标题为"machine:机器名 service: service名 reason"
+func SendServiceEmail(log *logdoo.Context, c *MonitorCfg, e *Email, name, reason, content, attach string) {
+	subject := "machine:" + c.GetMachineName() + " service: " + name + " " + reason
+	if attach != "" {
+		e.SendEmailEx(log, subject, content, attach)
+	} else {
+		e.SendEmail(log, subject, content)
+	}
+}
+
+//DetailHtml 把详细原因转换成邮件内容中的html
+func DetailHtml(detail string) string {
+	if detail == "" {
+		return ""
+	}
+	return "<br><pre>" + html.EscapeString(detail) + "</pre>"
+}
+
+//StopService 停止service并等待它停止,超过timeout返回错误
+func StopService(service *mgr.Service, timeout time.Duration) error {
+	status, err := service.Control(svc.Stop)
+	if err != nil {
+		//已经停止了的不算失败
+		if st, er := service.Query(); er == nil && st.State == svc.Stopped {
+			return nil
+		}
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("wait service stop timeout %s", timeout)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = service.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //UpdateSendEmailState 更新发送邮件状态
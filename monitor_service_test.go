@@ -0,0 +1,78 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/winsvc/mgr"
+)
+
+func TestRequestRestartVetoed(t *testing.T) {
+	ms := &MonitorService{
+		services:     map[string]*mgr.Service{"Doo": {Name: "Doo"}},
+		serviceState: map[string]int{"Doo": ServiceVetoed},
+		vetoUntil:    map[string]time.Time{"Doo": time.Now().Add(VetoRetryAfter)},
+		limitLog:     logdoo.Limited(LogLimitWindow),
+	}
+
+	if ms.RequestRestart("Doo", "health check fail", "", true) {
+		t.Error("restart should be suppressed before retry after")
+	}
+	if ms.serviceState["Doo"] != ServiceVetoed {
+		t.Errorf("state %d, want vetoed", ms.serviceState["Doo"])
+	}
+
+	ms.vetoUntil["Doo"] = time.Now().Add(-time.Second)
+	if ms.vetoed("Doo") {
+		t.Error("veto should expire after retry after")
+	}
+	delete(ms.vetoUntil, "Doo")
+	if ms.vetoed("Doo") {
+		t.Error("service without veto")
+	}
+}
+
+func TestApplyTimerCfg(t *testing.T) {
+	ms := &MonitorService{
+		serviceAddChan:      make([]chan RestartTask, 0),
+		serviceAddChanIndex: make(map[int]bool),
+		limitLog:            logdoo.Limited(LogLimitWindow),
+	}
+	defer func() {
+		for _, ch := range ms.serviceAddChan {
+			close(ch)
+		}
+	}()
+
+	steps := []struct {
+		timer   TimerCfg
+		workers int //当前分配任务的协程数
+		chans   int //已经创建的协程数
+	}{
+		{TimerCfg{time.Minute, time.Second, 2, 0}, 2, 2},
+		{TimerCfg{time.Minute, 2 * time.Second, 4, time.Minute}, 4, 4},
+		{TimerCfg{time.Minute, 3 * time.Second, 1, 0}, 1, 4}, //缩减时多出的协程保留
+		{TimerCfg{time.Minute, time.Second, 3, 0}, 3, 4},
+	}
+	for i, s := range steps {
+		ms.curAddChanIndex = 3
+		ms.ApplyTimerCfg(s.timer, nil, nil)
+		if ms.workerNum != s.workers || len(ms.serviceAddChan) != s.chans {
+			t.Errorf("step %d workers %d chans %d, want %d %d", i, ms.workerNum, len(ms.serviceAddChan), s.workers, s.chans)
+		}
+		if ms.checkInterval != s.timer.CheckInterval || ms.emailInterval != s.timer.EmailInterval {
+			t.Errorf("step %d check %s email %s", i, ms.checkInterval, ms.emailInterval)
+		}
+		if ms.curAddChanIndex >= ms.workerNum {
+			t.Errorf("step %d next worker %d out of %d", i, ms.curAddChanIndex, ms.workerNum)
+		}
+	}
+
+	//停止后不再应用
+	ms.stop = true
+	ms.ApplyTimerCfg(TimerCfg{time.Minute, time.Hour, 8, 0}, nil, nil)
+	if ms.workerNum != 3 || ms.checkInterval != time.Second {
+		t.Errorf("stopped service applied timer, workers %d check %s", ms.workerNum, ms.checkInterval)
+	}
+}
@@ -0,0 +1,67 @@
+package probe
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+//DiskFree 目录所在文件系统的可用空间和总空间
+func DiskFree(path string) (free, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), st.Blocks * uint64(st.Bsize), nil
+}
+
+//MemoryAvailable 可用内存(/proc/meminfo的MemAvailable)和总内存
+func MemoryAvailable() (avail, total uint64, err error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var found int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+			found++
+		case "MemAvailable:":
+			avail = kb * 1024
+			found++
+		}
+	}
+	if found < 2 {
+		return 0, 0, fmt.Errorf("MemTotal or MemAvailable not found in /proc/meminfo")
+	}
+	return avail, total, scanner.Err()
+}
+
+//LoadAverage 1分钟的平均负载
+func LoadAverage() (float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid /proc/loadavg %q", data)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
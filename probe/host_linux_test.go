@@ -0,0 +1,40 @@
+package probe
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDiskFree(t *testing.T) {
+	free, total, err := DiskFree(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total == 0 || free > total {
+		t.Errorf("free %d total %d", free, total)
+	}
+
+	if _, _, err := DiskFree("/not/exist/dir"); err == nil {
+		t.Error("disk free of a not exist dir should fail")
+	}
+}
+
+func TestMemoryAvailable(t *testing.T) {
+	avail, total, err := MemoryAvailable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total == 0 || avail == 0 || avail > total {
+		t.Errorf("avail %d total %d", avail, total)
+	}
+}
+
+func TestLoadAverage(t *testing.T) {
+	load, err := LoadAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load < 0 {
+		t.Errorf("load %f", load)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package probe
+
+//DiskFree 当前平台不支持
+func DiskFree(path string) (free, total uint64, err error) {
+	return 0, 0, ErrNotSupported
+}
+
+//MemoryAvailable 当前平台不支持
+func MemoryAvailable() (avail, total uint64, err error) {
+	return 0, 0, ErrNotSupported
+}
+
+//LoadAverage 当前平台不支持
+func LoadAverage() (float64, error) {
+	return 0, ErrNotSupported
+}
@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGlobalMemoryStatusEx = modkernel32.NewProc("GlobalMemoryStatusEx")
+	procGetSystemTimes       = modkernel32.NewProc("GetSystemTimes")
+)
+
+//memoryStatusEx kernel32的MEMORYSTATUSEX
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+//DiskFree 目录所在磁盘的可用空间和总空间
+func DiskFree(path string) (free, total uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var totalFree uint64
+	err = windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree)
+	return free, total, err
+}
+
+//MemoryAvailable 可用的物理内存和总的物理内存
+func MemoryAvailable() (avail, total uint64, err error) {
+	var m memoryStatusEx
+	m.Length = uint32(unsafe.Sizeof(m))
+	if r, _, e := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&m))); r == 0 {
+		return 0, 0, e
+	}
+	return m.AvailPhys, m.TotalPhys, nil
+}
+
+//上一次GetSystemTimes的结果,用于计算两次检查之间的CPU繁忙程度
+var lastSystemTimes struct {
+	idle, total uint64
+	mu          sync.Mutex
+}
+
+//LoadAverage Windows没有平均负载,用两次调用之间CPU繁忙的核数代替(第一次调用为开机以来的平均值)
+func LoadAverage() (float64, error) {
+	var idle, kernel, user windows.Filetime
+	if r, _, e := procGetSystemTimes.Call(uintptr(unsafe.Pointer(&idle)), uintptr(unsafe.Pointer(&kernel)), uintptr(unsafe.Pointer(&user))); r == 0 {
+		return 0, e
+	}
+	//内核时间包括了空闲时间
+	i := uint64(filetimeDuration(idle))
+	t := uint64(filetimeDuration(kernel) + filetimeDuration(user))
+
+	lastSystemTimes.mu.Lock()
+	di, dt := i-lastSystemTimes.idle, t-lastSystemTimes.total
+	lastSystemTimes.idle, lastSystemTimes.total = i, t
+	lastSystemTimes.mu.Unlock()
+
+	if dt == 0 {
+		return 0, nil
+	}
+	return float64(dt-di) / float64(dt) * float64(runtime.NumCPU()), nil
+}
@@ -0,0 +1,129 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//HttpBodyLimit 检查返回内容时最多读取的字节数
+const HttpBodyLimit = 64 * 1024
+
+//HttpCfg HTTP探测的配置
+type HttpCfg struct {
+	Url      string
+	Method   string
+	Status   []int  //期望的状态码,为空时要求2xx;包含3xx时不跟随重定向
+	Body     string //返回内容需要匹配的正则,为空不检查
+	Insecure bool   //不校验https证书(自签名证书)
+}
+
+//HttpChecker HTTP探测,请求Url并检查状态码和返回内容
+type HttpChecker struct {
+	cfg    HttpCfg
+	body   *regexp.Regexp
+	client *http.Client
+}
+
+//NewHttpChecker New一个HTTP探测
+func NewHttpChecker(cfg HttpCfg) (*HttpChecker, error) {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+	transport := &http.Transport{DisableKeepAlives: true, Proxy: http.ProxyFromEnvironment}
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	hc := &HttpChecker{
+		cfg: cfg,
+		//每次探测都新建连接,避免复用到已经挂起的连接
+		client: &http.Client{Transport: transport},
+	}
+	if hc.expectRedirect() {
+		//期望的就是重定向的状态码,检查第一次请求的返回
+		hc.client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	if cfg.Body != "" {
+		re, err := regexp.Compile(cfg.Body)
+		if err != nil {
+			return nil, err
+		}
+		hc.body = re
+	}
+	return hc, nil
+}
+
+func (hc *HttpChecker) Kind() string {
+	return "http"
+}
+
+//Check 请求一次,状态码或返回内容不符合时返回错误
+func (hc *HttpChecker) Check(ctx context.Context) (string, error) {
+	req, err := http.NewRequest(hc.cfg.Method, hc.cfg.Url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := hc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, HttpBodyLimit))
+	output := fmt.Sprintf("%s %s: %s", hc.cfg.Method, hc.cfg.Url, resp.Status)
+	if err != nil {
+		return output, fmt.Errorf("read body err:%s", err)
+	}
+
+	if !hc.statusOk(resp.StatusCode) {
+		return output, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if hc.body != nil && !hc.body.Match(data) {
+		return output, fmt.Errorf("body not match %s", hc.cfg.Body)
+	}
+	return output, nil
+}
+
+func (hc *HttpChecker) expectRedirect() bool {
+	for _, status := range hc.cfg.Status {
+		if status >= 300 && status <= 399 {
+			return true
+		}
+	}
+	return false
+}
+
+func (hc *HttpChecker) statusOk(code int) bool {
+	if len(hc.cfg.Status) == 0 {
+		return code >= 200 && code <= 299
+	}
+	for _, status := range hc.cfg.Status {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseStatusList 解析逗号分隔的状态码列表,如200,204
+func ParseStatusList(s string) ([]int, error) {
+	status := make([]int, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("status %s invalid", v)
+		}
+		status = append(status, code)
+	}
+	return status, nil
+}
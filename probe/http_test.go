@@ -0,0 +1,123 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"UP"}`))
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"DOWN"}`))
+	})
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		cfg  HttpCfg
+		err  string
+	}{
+		{"default 2xx", HttpCfg{Url: srv.URL + "/ok"}, ""},
+		{"default 5xx", HttpCfg{Url: srv.URL + "/down"}, "unexpected status 503"},
+		{"status list", HttpCfg{Url: srv.URL + "/down", Status: []int{200, 503}}, ""},
+		{"status not in list", HttpCfg{Url: srv.URL + "/ok", Status: []int{204}}, "unexpected status 200"},
+		{"method", HttpCfg{Url: srv.URL + "/created", Method: http.MethodPost, Status: []int{201}}, ""},
+		{"body match", HttpCfg{Url: srv.URL + "/ok", Body: `"status":\s*"UP"`}, ""},
+		{"body not match", HttpCfg{Url: srv.URL + "/down", Status: []int{503}, Body: `"status":\s*"UP"`}, "body not match"},
+		{"redirect followed", HttpCfg{Url: srv.URL + "/moved", Body: "UP"}, ""},
+		{"redirect expected", HttpCfg{Url: srv.URL + "/moved", Status: []int{302}}, ""},
+		{"redirect not expected", HttpCfg{Url: srv.URL + "/moved", Status: []int{200, 301}}, "unexpected status 302"},
+		{"not found", HttpCfg{Url: srv.URL + "/none"}, "unexpected status 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkHttp(t, tt.cfg, tt.err, checkTimeout)
+		})
+	}
+}
+
+func TestHttpCheckTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	begin := time.Now()
+	checkHttp(t, HttpCfg{Url: srv.URL}, "deadline exceeded", 300*time.Millisecond)
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("slow handler returned after %s", d)
+	}
+}
+
+func TestHttpCheckTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("UP"))
+	}))
+	defer srv.Close()
+
+	//httptest的证书是自签名的,不跳过校验时失败
+	checkHttp(t, HttpCfg{Url: srv.URL}, "certificate", checkTimeout)
+	checkHttp(t, HttpCfg{Url: srv.URL, Insecure: true, Body: "UP"}, "", checkTimeout)
+}
+
+func TestNewHttpCheckerBadBody(t *testing.T) {
+	if _, err := NewHttpChecker(HttpCfg{Url: "http://127.0.0.1", Body: "("}); err == nil {
+		t.Error("invalid body regexp should fail")
+	}
+}
+
+func TestParseStatusList(t *testing.T) {
+	status, err := ParseStatusList(" 200, 204,,302 ")
+	if err != nil || len(status) != 3 || status[0] != 200 || status[1] != 204 || status[2] != 302 {
+		t.Errorf("status %v err %v", status, err)
+	}
+	for _, s := range []string{"abc", "99", "600"} {
+		if _, err := ParseStatusList(s); err == nil {
+			t.Errorf("status %s should fail", s)
+		}
+	}
+}
+
+//checkTimeout 不测试超时的用例的超时,-race下TLS握手可能要几百毫秒
+const checkTimeout = 5 * time.Second
+
+//checkHttp 检查一次,err为空时要求成功,否则要求错误信息包含err
+func checkHttp(t *testing.T, cfg HttpCfg, err string, timeout time.Duration) {
+	t.Helper()
+	hc, er := NewHttpChecker(cfg)
+	if er != nil {
+		t.Fatal(er)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, er := hc.Check(ctx)
+	if err == "" && er != nil {
+		t.Errorf("%s err %s", output, er)
+	}
+	if err != "" && (er == nil || !strings.Contains(er.Error(), err)) {
+		t.Errorf("%s err %v, want %s", output, er, err)
+	}
+}
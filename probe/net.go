@@ -0,0 +1,124 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//NetReadLimit TCP/UDP检查时最多读取的字节数
+const NetReadLimit = 64 * 1024
+
+//NetCfg TCP/UDP端口检查的配置
+type NetCfg struct {
+	Addr   string //host:port
+	Send   string //连接后发送的内容,支持\r\n\t\xHH转义,为空不发送
+	Expect string //返回内容需要匹配的正则,为空不检查
+}
+
+//NetChecker 端口检查,TCP连接(可选发送并检查返回)或者UDP发送并检查返回
+type NetChecker struct {
+	network string
+	cfg     NetCfg
+	send    []byte
+	expect  *regexp.Regexp
+}
+
+//NewNetChecker New一个端口检查,network为tcp或udp
+func NewNetChecker(network string, cfg NetCfg) (*NetChecker, error) {
+	nc := &NetChecker{network: network, cfg: cfg}
+	send, err := Unescape(cfg.Send)
+	if err != nil {
+		return nil, err
+	}
+	nc.send = []byte(send)
+	if cfg.Expect != "" {
+		if nc.expect, err = regexp.Compile(cfg.Expect); err != nil {
+			return nil, err
+		}
+	}
+	return nc, nil
+}
+
+func (nc *NetChecker) Kind() string {
+	return nc.network
+}
+
+//Check 连接一次,连接失败、发送失败或者返回内容不符合时返回错误
+func (nc *NetChecker) Check(ctx context.Context) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, nc.network, nc.cfg.Addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	output := fmt.Sprintf("%s %s: connected", nc.network, nc.cfg.Addr)
+	if len(nc.send) > 0 {
+		if _, err = conn.Write(nc.send); err != nil {
+			return output, fmt.Errorf("send err:%s", err)
+		}
+	}
+
+	//TCP没有要求检查返回时连接成功即可,UDP没有返回无法确认端口是否存活
+	if nc.expect == nil && nc.network == "tcp" {
+		return output, nil
+	}
+
+	data, err := nc.read(conn)
+	if len(data) > 0 {
+		output = fmt.Sprintf("%s %s: %s", nc.network, nc.cfg.Addr, strconv.Quote(string(data)))
+	}
+	if nc.expect != nil {
+		if nc.expect.Match(data) {
+			return output, nil
+		}
+		if err != nil && err != io.EOF {
+			return output, fmt.Errorf("read err:%s", err)
+		}
+		return output, fmt.Errorf("response not match %s", nc.cfg.Expect)
+	}
+	if err != nil {
+		return output, fmt.Errorf("read err:%s", err)
+	}
+	return output, nil
+}
+
+//read UDP读一个包,TCP一直读到匹配Expect、对方关闭或者超时
+func (nc *NetChecker) read(conn net.Conn) ([]byte, error) {
+	buf := make([]byte, NetReadLimit)
+	if nc.network == "udp" {
+		n, err := conn.Read(buf)
+		return buf[:n], err
+	}
+
+	var data []byte
+	for len(data) < NetReadLimit {
+		n, err := conn.Read(buf[:NetReadLimit-len(data)])
+		data = append(data, buf[:n]...)
+		if nc.expect == nil || nc.expect.Match(data) || err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+//Unescape 解析配置中的转义字符,如\r\n、\t、\x00
+func Unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	v, err := strconv.Unquote(`"` + strings.Replace(s, `"`, `\"`, -1) + `"`)
+	if err != nil {
+		return "", fmt.Errorf("unescape %s err:%s", s, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+//tcpServer 接受连接后按handle处理,返回监听的地址
+func tcpServer(t *testing.T, handle func(conn net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func checkNet(t *testing.T, network string, cfg NetCfg, timeout time.Duration) (string, error) {
+	nc, err := NewNetChecker(network, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return nc.Check(ctx)
+}
+
+func TestTcpCheck(t *testing.T) {
+	echo := tcpServer(t, func(conn net.Conn) {
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		if strings.HasPrefix(string(buf[:n]), "PING") {
+			conn.Write([]byte("+PONG\r\n"))
+		} else {
+			conn.Write([]byte("-ERR\r\n"))
+		}
+	})
+	silent := tcpServer(t, func(conn net.Conn) {
+		time.Sleep(time.Second)
+	})
+
+	//找一个没有监听的端口
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name string
+		cfg  NetCfg
+		err  string
+	}{
+		{"connect", NetCfg{Addr: silent}, ""},
+		{"expect", NetCfg{Addr: echo, Send: `PING\r\n`, Expect: `^\+PONG`}, ""},
+		{"not match", NetCfg{Addr: echo, Send: `QUIT\r\n`, Expect: `^\+PONG`}, "response not match"},
+		{"no response", NetCfg{Addr: silent, Send: `PING\r\n`, Expect: `PONG`}, "timeout"},
+		{"refused", NetCfg{Addr: closed}, "refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkNet(t, "tcp", tt.cfg, 300*time.Millisecond)
+			if tt.err == "" && err != nil {
+				t.Errorf("err %s", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUdpCheck(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+
+	output, err := checkNet(t, "udp", NetCfg{Addr: conn.LocalAddr().String(), Send: `\x01ping`, Expect: `^echo:\x01ping$`}, time.Second)
+	if err != nil {
+		t.Fatalf("err %s output %s", err, output)
+	}
+	if _, err := checkNet(t, "udp", NetCfg{Addr: conn.LocalAddr().String(), Send: "ping", Expect: "pong"}, time.Second); err == nil {
+		t.Error("udp response not match should fail")
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := map[string]string{
+		`PING\r\n`:  "PING\r\n",
+		`\x00\x01`:  "\x00\x01",
+		`say "hi"`:  `say "hi"`,
+		`tab\there`: "tab\there",
+	}
+	for in, want := range tests {
+		if got, err := Unescape(in); err != nil || got != want {
+			t.Errorf("Unescape(%q) = %q %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := Unescape(`bad\q`); err == nil {
+		t.Error("invalid escape should fail")
+	}
+}
@@ -0,0 +1,3 @@
+//Package probe 跟GoMonitor的service管理无关的检查和采集(HTTP、TCP/UDP端口、脚本、进程和主机的资源使用),
+//不依赖Windows的服务管理器,各个平台都可以编译和测试
+package probe
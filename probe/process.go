@@ -0,0 +1,18 @@
+package probe
+
+import (
+	"errors"
+	"time"
+)
+
+//ErrNotSupported 当前平台不支持的采集
+var ErrNotSupported = errors.New("not supported on this platform")
+
+//ProcSample 一次采集的进程树的资源使用
+type ProcSample struct {
+	CPUTime time.Duration //累计的CPU时间(用户态+内核态)
+	RSS     uint64        //常驻内存(Windows为WorkingSet)字节数
+	Handles int           //句柄数(Linux为fd数)
+	Threads int
+	Procs   int //进程数(包括子进程)
+}
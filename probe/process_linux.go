@@ -0,0 +1,116 @@
+package probe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//clockTicks /proc/[pid]/stat中CPU时间的单位(USER_HZ,Linux上基本都是100)
+const clockTicks = 100
+
+//ServicePid 通过systemd获取service的主进程id,没有运行时返回0
+func ServicePid(name string) (uint32, error) {
+	out, err := exec.Command("systemctl", "show", "--property", "MainPID", "--value", name).Output()
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse MainPID %q err:%s", out, err)
+	}
+	return uint32(pid), nil
+}
+
+//SampleProcessTree 采集进程以及所有子进程的资源使用(读取/proc)
+func SampleProcessTree(pid uint32) (ProcSample, error) {
+	var sample ProcSample
+	dirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return sample, err
+	}
+
+	stats := make(map[uint32]procStat)
+	children := make(map[uint32][]uint32)
+	for _, d := range dirs {
+		p, err := strconv.ParseUint(d.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		st, err := readProcStat(uint32(p))
+		if err != nil {
+			continue
+		}
+		stats[uint32(p)] = st
+		children[st.ppid] = append(children[st.ppid], uint32(p))
+	}
+	if _, ok := stats[pid]; !ok {
+		return sample, fmt.Errorf("process %d not exist", pid)
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	queue := []uint32{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		st := stats[p]
+
+		sample.CPUTime += time.Duration(st.utime+st.stime) * time.Second / clockTicks
+		sample.RSS += st.rss * pageSize
+		sample.Threads += st.threads
+		if fds, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/fd", p)); err == nil {
+			sample.Handles += len(fds)
+		}
+		sample.Procs++
+
+		for _, child := range children[p] {
+			//pid可能被复用,子进程的启动时间要晚于父进程
+			if stats[child].start >= st.start {
+				queue = append(queue, child)
+			}
+		}
+	}
+	return sample, nil
+}
+
+type procStat struct {
+	ppid    uint32
+	utime   uint64
+	stime   uint64
+	threads int
+	start   uint64
+	rss     uint64
+}
+
+//readProcStat 解析/proc/[pid]/stat
+func readProcStat(pid uint32) (procStat, error) {
+	var st procStat
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return st, err
+	}
+
+	//进程名可能包含空格和括号,从最后一个)之后开始解析
+	s := string(data)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return st, fmt.Errorf("invalid stat %q", s)
+	}
+	fields := strings.Fields(s[i+1:])
+	//fields[0]为第3个字段state
+	if len(fields) < 22 {
+		return st, fmt.Errorf("invalid stat %q", s)
+	}
+	ppid, _ := strconv.ParseUint(fields[1], 10, 32)
+	st.ppid = uint32(ppid)
+	st.utime, _ = strconv.ParseUint(fields[11], 10, 64)
+	st.stime, _ = strconv.ParseUint(fields[12], 10, 64)
+	st.threads, _ = strconv.Atoi(fields[17])
+	st.start, _ = strconv.ParseUint(fields[19], 10, 64)
+	st.rss, _ = strconv.ParseUint(fields[21], 10, 64)
+	return st, nil
+}
@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestSampleProcessTree(t *testing.T) {
+	self, err := SampleProcessTree(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.Procs < 1 || self.Threads < 1 || self.RSS == 0 || self.Handles == 0 {
+		t.Errorf("sample of self %+v", self)
+	}
+
+	//子进程也算在进程树中
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("start child err:%s", err)
+	}
+	defer cmd.Process.Kill()
+
+	tree, err := SampleProcessTree(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Procs != self.Procs+1 {
+		t.Errorf("procs with child %d, without %d", tree.Procs, self.Procs)
+	}
+}
+
+func TestSampleProcessTreeCPU(t *testing.T) {
+	before, err := SampleProcessTree(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for end := time.Now().Add(100 * time.Millisecond); time.Now().Before(end); {
+	}
+	after, err := SampleProcessTree(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.CPUTime <= before.CPUTime {
+		t.Errorf("cpu time not increased: %s -> %s", before.CPUTime, after.CPUTime)
+	}
+}
+
+func TestSampleProcessTreeNotExist(t *testing.T) {
+	//pid_max最大为4194304
+	if _, err := SampleProcessTree(1 << 30); err == nil {
+		t.Error("sample of a not exist process should fail")
+	}
+}
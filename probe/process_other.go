@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package probe
+
+//ServicePid 当前平台不支持
+func ServicePid(name string) (uint32, error) {
+	return 0, ErrNotSupported
+}
+
+//SampleProcessTree 当前平台不支持
+func SampleProcessTree(pid uint32) (ProcSample, error) {
+	return ProcSample{}, ErrNotSupported
+}
@@ -0,0 +1,145 @@
+package probe
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/btcsuite/winsvc/mgr"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modpsapi                  = windows.NewLazySystemDLL("psapi.dll")
+	modkernel32               = windows.NewLazySystemDLL("kernel32.dll")
+	procGetProcessMemoryInfo  = modpsapi.NewProc("GetProcessMemoryInfo")
+	procGetProcessHandleCount = modkernel32.NewProc("GetProcessHandleCount")
+)
+
+//processMemoryCounters psapi的PROCESS_MEMORY_COUNTERS
+type processMemoryCounters struct {
+	Cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+//ServicePid 通过QueryServiceStatusEx获取service的进程id,没有运行时返回0
+func ServicePid(name string) (uint32, error) {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return 0, err
+	}
+	defer manager.Disconnect()
+
+	s, err := manager.OpenService(name)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	var status windows.SERVICE_STATUS_PROCESS
+	var needed uint32
+	if err := windows.QueryServiceStatusEx(windows.Handle(s.Handle), windows.SC_STATUS_PROCESS_INFO, (*byte)(unsafe.Pointer(&status)), uint32(unsafe.Sizeof(status)), &needed); err != nil {
+		return 0, err
+	}
+	return status.ProcessId, nil
+}
+
+//SampleProcessTree 采集进程以及所有子进程的资源使用(toolhelp快照找子进程,GetProcessTimes和psapi获取CPU和内存)
+func SampleProcessTree(pid uint32) (ProcSample, error) {
+	var sample ProcSample
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return sample, err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	children := make(map[uint32][]uint32)
+	threads := make(map[uint32]uint32)
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		children[entry.ParentProcessID] = append(children[entry.ParentProcessID], entry.ProcessID)
+		threads[entry.ProcessID] = entry.Threads
+	}
+	if _, ok := threads[pid]; !ok {
+		return sample, fmt.Errorf("process %d not exist", pid)
+	}
+
+	//pid可能被复用,子进程的创建时间要晚于父进程
+	type node struct {
+		pid     uint32
+		created int64
+	}
+	queue := []node{{pid: pid}}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		st, err := sampleProcess(n.pid)
+		if err != nil || (n.pid != pid && st.created < n.created) {
+			continue
+		}
+		sample.CPUTime += st.cpu
+		sample.RSS += st.rss
+		sample.Handles += st.handles
+		sample.Threads += int(threads[n.pid])
+		sample.Procs++
+
+		for _, child := range children[n.pid] {
+			if child != n.pid && child != 0 {
+				queue = append(queue, node{pid: child, created: st.created})
+			}
+		}
+	}
+	return sample, nil
+}
+
+type processStat struct {
+	created int64
+	cpu     time.Duration
+	rss     uint64
+	handles int
+}
+
+func sampleProcess(pid uint32) (st processStat, err error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return st, err
+	}
+	defer windows.CloseHandle(h)
+
+	var creation, exit, kernel, user windows.Filetime
+	if err = windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return st, err
+	}
+	st.created = creation.Nanoseconds()
+	st.cpu = filetimeDuration(kernel) + filetimeDuration(user)
+
+	var mem processMemoryCounters
+	mem.Cb = uint32(unsafe.Sizeof(mem))
+	if r, _, e := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&mem)), uintptr(mem.Cb)); r != 0 {
+		st.rss = uint64(mem.WorkingSetSize)
+	} else if e != syscall.Errno(0) {
+		return st, e
+	}
+
+	var count uint32
+	if r, _, _ := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&count))); r != 0 {
+		st.handles = int(count)
+	}
+	return st, nil
+}
+
+//filetimeDuration FILETIME表示的时长(100纳秒为单位)
+func filetimeDuration(ft windows.Filetime) time.Duration {
+	return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,134 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+//ScriptOutputLimit 脚本输出最多保留的字节数
+const ScriptOutputLimit = 4096
+
+//DefaultScriptConcurrency 默认同时运行的脚本数
+const DefaultScriptConcurrency = 4
+
+//scriptDrainDelay 脚本退出后等待读取剩余输出的时间(子进程可能还占着输出管道)
+const scriptDrainDelay = time.Second
+
+//ScriptResult 脚本的运行结果
+type ScriptResult struct {
+	Output   string
+	Code     int //退出码
+	Duration time.Duration
+}
+
+var scriptSem = make(chan struct{}, DefaultScriptConcurrency)
+var scriptSemMu sync.Mutex
+
+//SetScriptConcurrency 修改同时运行的脚本数,正在运行的脚本不受影响
+func SetScriptConcurrency(n int) {
+	if n <= 0 {
+		n = DefaultScriptConcurrency
+	}
+	scriptSemMu.Lock()
+	if cap(scriptSem) != n {
+		scriptSem = make(chan struct{}, n)
+	}
+	scriptSemMu.Unlock()
+}
+
+//acquireScript 获取运行脚本的名额,返回释放名额的函数
+func acquireScript(ctx context.Context) (func(), error) {
+	scriptSemMu.Lock()
+	sem := scriptSem
+	scriptSemMu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait script slot err:%s", ctx.Err())
+	}
+}
+
+//RunScript 占用一个运行脚本的名额(SetScriptConcurrency)后运行命令行,用于[ScriptCheck]的检查脚本,
+//名额用完时等待到ctx结束
+func RunScript(ctx context.Context, command string, env []string) (ScriptResult, error) {
+	release, err := acquireScript(ctx)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+	defer release()
+	return RunCommand(ctx, command, env)
+}
+
+//RunCommand 运行一个命令行(通过系统的shell),不占用检查脚本的名额(hook、恢复步骤等不能被检查脚本阻塞的场合),
+//env为额外的环境变量(如GOMONITOR_SERVICE=xxx),ctx结束时杀掉进程;退出码非0不算错误,通过ScriptResult.Code返回
+func RunCommand(ctx context.Context, command string, env []string) (ScriptResult, error) {
+	var res ScriptResult
+	r, w, err := os.Pipe()
+	if err != nil {
+		return res, err
+	}
+	defer r.Close()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = w, w
+
+	begin := time.Now()
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return res, err
+	}
+
+	out := make(chan []byte, 1)
+	go func() {
+		data, _ := ReadLimit(r, ScriptOutputLimit)
+		out <- data
+	}()
+
+	err = cmd.Wait()
+	res.Duration = time.Since(begin)
+	select {
+	case data := <-out:
+		res.Output = string(data)
+	case <-time.After(scriptDrainDelay):
+		r.Close()
+		res.Output = string(<-out)
+	}
+
+	if ctx.Err() != nil {
+		return res, fmt.Errorf("script timeout after %s", res.Duration.Round(time.Millisecond))
+	}
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		res.Code = cmd.ProcessState.ExitCode()
+		return res, nil
+	}
+	return res, err
+}
+
+//ReadLimit 读取r到结束,只保留前limit个字节(超过的部分读出后丢弃,写的一方不会被阻塞)
+func ReadLimit(r io.Reader, limit int) ([]byte, error) {
+	data := make([]byte, 0, 512)
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if room := limit - len(data); room > 0 {
+			if n > room {
+				n = room
+			}
+			data = append(data, buf[:n]...)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return data, err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package probe
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//shell 按平台选择测试用的命令行
+func shell(unix, windows string) string {
+	if runtime.GOOS == "windows" {
+		return windows
+	}
+	return unix
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		code    int
+		output  string
+	}{
+		{"ok", shell("echo hello", "echo hello"), 0, "hello"},
+		{"exit code", shell("echo warn; exit 1", "echo warn& exit /b 1"), 1, "warn"},
+		{"stderr", shell("echo oops >&2; exit 2", "echo oops 1>&2& exit /b 2"), 2, "oops"},
+		{"env", shell("echo $GOMONITOR_SERVICE", "echo %GOMONITOR_SERVICE%"), 0, "Doo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := RunScript(context.Background(), tt.command, []string{"GOMONITOR_SERVICE=Doo"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Code != tt.code || strings.TrimSpace(res.Output) != tt.output {
+				t.Errorf("code %d output %q, want %d %q", res.Code, res.Output, tt.code, tt.output)
+			}
+		})
+	}
+}
+
+func TestRunScriptTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	_, err := RunScript(ctx, shell("sleep 10", "ping -n 10 127.0.0.1"), nil)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("err %v, want timeout", err)
+	}
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("timeout script returned after %s", d)
+	}
+}
+
+func TestRunScriptOutputLimit(t *testing.T) {
+	res, err := RunScript(context.Background(), shell("head -c 100000 /dev/zero | tr '\\0' a", "for /l %i in (1,1,2000) do @echo aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Output) != ScriptOutputLimit || res.Code != 0 {
+		t.Errorf("output %d bytes code %d, want %d bytes", len(res.Output), res.Code, ScriptOutputLimit)
+	}
+}
+
+func TestScriptConcurrency(t *testing.T) {
+	SetScriptConcurrency(2)
+	defer SetScriptConcurrency(DefaultScriptConcurrency)
+
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := acquireScript(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+	if max != 2 {
+		t.Errorf("max concurrent scripts %d, want 2", max)
+	}
+}
+
+func TestRunCommandWithoutSlot(t *testing.T) {
+	SetScriptConcurrency(1)
+	defer SetScriptConcurrency(DefaultScriptConcurrency)
+
+	release, err := acquireScript(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	//检查脚本占满名额时RunScript等待到超时,RunCommand不受影响
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := RunScript(ctx, shell("echo hook", "echo hook"), nil); err == nil || !strings.Contains(err.Error(), "wait script slot") {
+		t.Errorf("RunScript err %v, want wait script slot", err)
+	}
+
+	res, err := RunCommand(context.Background(), shell("echo hook", "echo hook"), nil)
+	if err != nil || strings.TrimSpace(res.Output) != "hook" {
+		t.Errorf("RunCommand output %q err %v", res.Output, err)
+	}
+}
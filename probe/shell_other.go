@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package probe
+
+import (
+	"context"
+	"os/exec"
+)
+
+//shellCommand 通过sh -c运行命令行
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
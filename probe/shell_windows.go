@@ -0,0 +1,14 @@
+package probe
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+//shellCommand 通过cmd /C运行命令行,命令行原样传给cmd避免引号被转义
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: "cmd /C " + command, HideWindow: true}
+	return cmd
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"GoMonitor/probe"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/winsvc/mgr"
+	"github.com/btcsuite/winsvc/svc"
+	"golang.org/x/sys/windows"
+)
+
+//恢复步骤的默认超时
+const (
+	DefaultRecoveryWait   = time.Minute
+	RecoveryScriptTimeout = time.Minute
+	RecoveryKillWait      = 10 * time.Second
+	RecoveryPollInterval  = 2 * time.Second
+)
+
+//恢复步骤
+const (
+	StepStop   = "stop"   //stop[:超时] 正常停止
+	StepKill   = "kill"   //kill 停止超时后杀掉进程
+	StepScript = "script" //script[:超时]:命令行 运行清理脚本
+	StepStart  = "start"  //start[:参数] 带参数启动
+	StepWait   = "wait"   //wait[:超时] 等待健康检查通过
+)
+
+//ErrNoHealthCheck service没有配置健康检查
+var ErrNoHealthCheck = errors.New("no health check")
+
+//HealthWaiter 等待service的健康检查通过
+type HealthWaiter interface {
+	WaitHealthy(service string, timeout time.Duration) error
+}
+
+//RecoveryStep 恢复的一个步骤
+type RecoveryStep struct {
+	Action  string
+	Arg     string        //script的命令行,start的参数
+	Timeout time.Duration //stop、script、wait的超时
+}
+
+func (s RecoveryStep) String() string {
+	switch {
+	case s.Action == StepScript && s.Timeout != RecoveryScriptTimeout:
+		return s.Action + ":" + s.Timeout.String() + ":" + s.Arg
+	case s.Arg != "":
+		return s.Action + ":" + s.Arg
+	case s.Timeout > 0:
+		return s.Action + ":" + s.Timeout.String()
+	}
+	return s.Action
+}
+
+//RecoveryCfg [Recovery]一个service的恢复步骤
+type RecoveryCfg struct {
+	Name    string
+	Service string
+	Steps   []RecoveryStep
+}
+
+//ParseRecoverySteps 解析恢复步骤,如stop:30s,kill,script:D:\clean.bat,script:5m:D:\backup.bat,start:-safe,wait:60s
+func ParseRecoverySteps(s string) ([]RecoveryStep, error) {
+	var steps []RecoveryStep
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		action, arg := item, ""
+		if i := strings.Index(item, ":"); i >= 0 {
+			action, arg = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+
+		step := RecoveryStep{Action: strings.ToLower(action)}
+		var err error
+		switch step.Action {
+		case StepStop, StepWait:
+			step.Timeout = ServiceStopTimeout
+			if step.Action == StepWait {
+				step.Timeout = DefaultRecoveryWait
+			}
+			if arg != "" {
+				if step.Timeout, err = ParseDuration(arg); err != nil || step.Timeout <= 0 {
+					return nil, fmt.Errorf("step %s timeout invalid", item)
+				}
+			}
+		case StepKill:
+			if arg != "" {
+				return nil, fmt.Errorf("step %s has no argument", item)
+			}
+		case StepScript:
+			//命令行前面能解析成时间的一段是超时,如script:5m:D:\backup.bat
+			step.Timeout = RecoveryScriptTimeout
+			if i := strings.Index(arg, ":"); i > 0 {
+				if timeout, err := ParseDuration(arg[:i]); err == nil {
+					if timeout <= 0 {
+						return nil, fmt.Errorf("step %s timeout invalid", item)
+					}
+					step.Timeout, arg = timeout, strings.TrimSpace(arg[i+1:])
+				}
+			}
+			if arg == "" {
+				return nil, fmt.Errorf("step %s need a command", item)
+			}
+			step.Arg = arg
+		case StepStart:
+			step.Arg = arg
+		default:
+			return nil, fmt.Errorf("unknown step %s", item)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+//RunRecovery 按步骤恢复service,返回每一步的记录(用于日记和通知)以及是否恢复成功;
+//stop、kill、script失败时继续下一步,start失败时停止,wait失败时恢复失败
+func RunRecovery(log *logdoo.Context, service *mgr.Service, steps []RecoveryStep, waiter HealthWaiter) ([]string, bool) {
+	begin := time.Now()
+	record := make([]string, 0, len(steps))
+	ok := true
+
+	for _, step := range steps {
+		stepBegin := time.Now()
+		result, err := runStep(service, step, waiter)
+		line := fmt.Sprintf("[+%s] %s: ", stepBegin.Sub(begin).Round(100*time.Millisecond), step)
+		if err != nil {
+			line += "fail " + err.Error()
+			log.Warn("recovery step fail", logdoo.String("step", step.String()), logdoo.Err(err), logdoo.String("output", result))
+		} else {
+			line += "ok"
+			log.Info("recovery step done", logdoo.String("step", step.String()), logdoo.String("output", result))
+		}
+		line += fmt.Sprintf(" (%s)", time.Since(stepBegin).Round(100*time.Millisecond))
+		if result != "" {
+			line += "\n    " + strings.Replace(result, "\n", "\n    ", -1)
+		}
+		record = append(record, line)
+
+		if err != nil && (step.Action == StepStart || step.Action == StepWait) {
+			ok = false
+			break
+		}
+	}
+	return record, ok
+}
+
+func runStep(service *mgr.Service, step RecoveryStep, waiter HealthWaiter) (string, error) {
+	switch step.Action {
+	case StepStop:
+		return "", StopService(service, step.Timeout)
+
+	case StepKill:
+		st, err := service.Query()
+		if err == nil && st.State == svc.Stopped {
+			return "already stopped", nil
+		}
+		pid, err := probe.ServicePid(service.Name)
+		if err != nil {
+			return "", err
+		}
+		if pid == 0 {
+			return "no process", nil
+		}
+		if err := KillProcess(pid); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("killed pid %d", pid), WaitServiceState(service, svc.Stopped, RecoveryKillWait)
+
+	case StepScript:
+		ctx, cancel := context.WithTimeout(context.Background(), step.Timeout)
+		defer cancel()
+		res, err := probe.RunCommand(ctx, step.Arg, []string{"GOMONITOR_SERVICE=" + service.Name})
+		output := strings.TrimSpace(res.Output)
+		if err == nil && res.Code != 0 {
+			err = fmt.Errorf("exit code %d", res.Code)
+		}
+		return output, err
+
+	case StepStart:
+		//service.Start 这个函数是阻塞式的,没有及时响应会导致30秒后超时
+		args := []string{service.Name}
+		if step.Arg != "" {
+			args = append(args, strings.Fields(step.Arg)...)
+		}
+		return "", service.Start(args)
+
+	case StepWait:
+		if waiter != nil {
+			err := waiter.WaitHealthy(service.Name, step.Timeout)
+			if err != ErrNoHealthCheck {
+				return "", err
+			}
+		}
+		//没有健康检查时等待service进入运行状态
+		return "no health check, wait running", WaitServiceState(service, svc.Running, step.Timeout)
+	}
+	return "", fmt.Errorf("unknown step %s", step.Action)
+}
+
+//WaitServiceState 等待service进入state状态,超过timeout返回错误
+func WaitServiceState(service *mgr.Service, state svc.State, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		st, err := service.Query()
+		if err != nil {
+			return err
+		}
+		if st.State == state {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("wait service state %d timeout %s, current %d", state, timeout, st.State)
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+}
+
+//KillProcess 杀掉进程
+func KillProcess(pid uint32) error {
+	h, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.TerminateProcess(h, 1)
+}
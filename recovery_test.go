@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecoverySteps(t *testing.T) {
+	steps, err := ParseRecoverySteps(` stop:30s, KILL ,script:del /q D:\MyService\run.lock,script:5m:D:\backup.bat,start:-safe -port 80,wait:60s,,wait`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RecoveryStep{
+		{StepStop, "", 30 * time.Second},
+		{StepKill, "", 0},
+		{StepScript, `del /q D:\MyService\run.lock`, RecoveryScriptTimeout},
+		{StepScript, `D:\backup.bat`, 5 * time.Minute},
+		{StepStart, "-safe -port 80", 0},
+		{StepWait, "", 60 * time.Second},
+		{StepWait, "", DefaultRecoveryWait},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("steps %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d %+v, want %+v", i, steps[i], want[i])
+		}
+	}
+
+	if steps, _ := ParseRecoverySteps("stop"); len(steps) != 1 || steps[0].Timeout != ServiceStopTimeout {
+		t.Errorf("stop default timeout %v", steps)
+	}
+	if steps, _ := ParseRecoverySteps(`script:10:C:\clean.bat`); len(steps) != 1 || steps[0].Timeout != 10*time.Second || steps[0].Arg != `C:\clean.bat` {
+		t.Errorf("script timeout in seconds %v", steps)
+	}
+}
+
+func TestParseRecoveryStepsInvalid(t *testing.T) {
+	for _, s := range []string{"restart", "stop:abc", "stop:-1s", "wait:0", "kill:5s", "script", "script:", "script:30s:", "script:0s:C:\\clean.bat"} {
+		if steps, err := ParseRecoverySteps(s); err == nil {
+			t.Errorf("%s should be invalid, got %v", s, steps)
+		}
+	}
+}
+
+func TestRecoveryStepString(t *testing.T) {
+	for _, s := range []string{"stop:30s", "kill", `script:C:\clean.bat`, `script:5m0s:C:\backup.bat`, "start", "start:-safe", "wait:1m0s"} {
+		steps, err := ParseRecoverySteps(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := steps[0].String(); got != s {
+			t.Errorf("String %s, want %s", got, s)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+//RemoteCfg [Remote]远程配置源的设置,远程配置会缓存到本地Cache文件,作为最底层的公共配置加载
+type RemoteCfg struct {
+	Open     bool
+	Url      string        //通过HTTP拉取配置(支持ETag)
+	Path     string        //从共享目录读取配置文件
+	Interval time.Duration //拉取的间隔
+	Cache    string        //最后一次有效的远程配置的本地缓存
+}
+
+//RemoteCfgMinInterval 拉取远程配置的最小间隔
+const RemoteCfgMinInterval = 10 * time.Second
+
+//RemoteCfgMaxSize 远程配置内容的最大字节数
+const RemoteCfgMaxSize = 1 << 20
+
+//RemoteAllowedSections 远程配置中允许出现的section,其余的都会去掉:会运行命令行([ScriptCheck] [Recovery] [Hook]),
+//读取或发送本地文件([Include] [EmailInfo] [LogWatch] [StaleCheck] [Log]),修改控制接口([Api])
+//或者远程配置源([Remote])的配置只能写在本地的配置文件中
+var RemoteAllowedSections = []string{"Machine", "SpecInfo", "PartInfo", "Timer", "HttpProbe", "TcpCheck", "UdpCheck",
+	"Resource", "HostCheck", "Depend"}
+
+//RemoteDeniedKeys 允许的section中不能由远程配置设置的key(前缀),[SpecInfo] AttachX是会随通知发送的本地目录
+var RemoteDeniedKeys = map[string][]string{"SpecInfo": {"Attach"}}
+
+//RemoteCfgSource 远程配置源,定时拉取并通过ETag/校验和判断是否有修改
+type RemoteCfgSource struct {
+	client  *http.Client
+	cfgPath string //本地主配置文件,用于校验远程配置合并后是否有效
+	etag    string //最后一次校验通过的配置的ETag
+	sum     string //最后一次校验通过的配置(去掉不允许的section后)的校验和
+}
+
+//NewRemoteCfgSource New一个远程配置源
+func NewRemoteCfgSource(cfgPath string) *RemoteCfgSource {
+	return &RemoteCfgSource{client: &http.Client{Timeout: 30 * time.Second}, cfgPath: cfgPath}
+}
+
+//Fetch 拉取远程配置和它的ETag,服务端返回没有修改(304)时content为nil
+func (rs *RemoteCfgSource) Fetch(rc RemoteCfg) (content []byte, etag string, err error) {
+	if rc.Url == "" {
+		f, err := os.Open(rc.Path)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		content, err = readRemoteCfg(f, rc.Path)
+		return content, "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rc.Url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if rs.etag != "" {
+		req.Header.Set("If-None-Match", rs.etag)
+	}
+
+	resp, err := rs.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, rs.etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("remote config %s status %s", rc.Url, resp.Status)
+	}
+	if content, err = readRemoteCfg(resp.Body, rc.Url); err != nil {
+		return nil, "", err
+	}
+	return content, resp.Header.Get("ETag"), nil
+}
+
+//readRemoteCfg 读取远程配置内容,超过RemoteCfgMaxSize时返回错误
+func readRemoteCfg(r io.Reader, source string) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, RemoteCfgMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > RemoteCfgMaxSize {
+		return nil, fmt.Errorf("remote config %s larger than %d bytes", source, RemoteCfgMaxSize)
+	}
+	return content, nil
+}
+
+//Poll 拉取一次远程配置,有修改且校验通过时更新本地缓存;ETag和校验和只在校验通过后才更新
+func (rs *RemoteCfgSource) Poll(rc RemoteCfg) (bool, error) {
+	//缓存被删除后ETag也失效,需要重新拉取完整的内容
+	if !PathExists(rc.Cache) {
+		rs.etag, rs.sum = "", ""
+	}
+	//本地已有缓存时以缓存作为比较的基准,避免重启后重复加载
+	if rs.sum == "" {
+		if data, err := LoadRemoteCache(rc.Cache); err == nil {
+			rs.sum = ConfigSum(data)
+		}
+	}
+
+	content, etag, err := rs.Fetch(rc)
+	if err != nil || content == nil {
+		return false, err
+	}
+
+	content, dropped, err := SanitizeRemoteCfg(content)
+	if err != nil {
+		return false, fmt.Errorf("remote config invalid:%s", err)
+	}
+	if len(dropped) > 0 {
+		logdoo.Warn("remote config entries dropped, they are only allowed in local config", logdoo.String("entries", strings.Join(dropped, ",")))
+	}
+
+	sum := ConfigSum(content)
+	if sum == rs.sum {
+		rs.etag = etag
+		return false, nil
+	}
+
+	//先写临时文件,跟本地配置合并校验通过后才替换缓存,保证缓存一直是最后一次有效的配置
+	tmp := rc.Cache + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return false, fmt.Errorf("write remote config cache err:%s", err)
+	}
+	defer os.Remove(tmp)
+
+	files, err := GetIncludeFiles(rs.cfgPath)
+	if err != nil {
+		return false, err
+	}
+	data, err := ParseCfgFiles(content, files)
+	if err == nil {
+		err = data.Validate()
+	}
+	if err != nil {
+		return false, fmt.Errorf("remote config invalid:%s", err)
+	}
+
+	if err := os.Rename(tmp, rc.Cache); err != nil {
+		return false, fmt.Errorf("replace remote config cache err:%s", err)
+	}
+	rs.etag, rs.sum = etag, sum
+	return true, nil
+}
+
+//SanitizeRemoteCfg 只保留远程配置中RemoteAllowedSections里的section,并去掉RemoteDeniedKeys以及
+//引用本机敏感信息的值(env:/file:/secret:引用和${ENV}),返回去掉后的内容和去掉的section/key
+func SanitizeRemoteCfg(content []byte) ([]byte, []string, error) {
+	cfg, err := ini.Load(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dropped := make([]string, 0)
+	for _, sec := range cfg.Sections() {
+		name := sec.Name()
+		if name != ini.DefaultSection && !remoteSectionAllowed(name) {
+			cfg.DeleteSection(name)
+			dropped = append(dropped, name)
+			continue
+		}
+
+		for _, key := range sec.Keys() {
+			if name == ini.DefaultSection || remoteKeyDenied(name, key.Name()) ||
+				IsSecretRef(key.Value()) || strings.Contains(key.Value(), "${") {
+				sec.DeleteKey(key.Name())
+				dropped = append(dropped, name+"."+key.Name())
+			}
+		}
+	}
+	if len(dropped) == 0 {
+		return content, dropped, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := cfg.WriteTo(&buf); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), dropped, nil
+}
+
+//remoteSectionAllowed section是否允许由远程配置设置
+func remoteSectionAllowed(name string) bool {
+	for _, allowed := range RemoteAllowedSections {
+		if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+//remoteKeyDenied section中的key是否不允许由远程配置设置
+func remoteKeyDenied(section, key string) bool {
+	for _, prefix := range RemoteDeniedKeys[section] {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+//LoadRemoteCache 读取远程配置的本地缓存,缓存中不允许的section和key同样会去掉
+func LoadRemoteCache(cache string) ([]byte, error) {
+	content, err := ioutil.ReadFile(cache)
+	if err != nil {
+		return nil, err
+	}
+	content, dropped, err := SanitizeRemoteCfg(content)
+	if err != nil {
+		return nil, fmt.Errorf("remote config cache %s err:%s", cache, err)
+	}
+	if len(dropped) > 0 {
+		logdoo.Warn("remote config cache entries dropped, they are only allowed in local config", logdoo.String("cache", cache), logdoo.String("entries", strings.Join(dropped, ",")))
+	}
+	return content, nil
+}
+
+//ConfigSum 配置内容的校验和
+func ConfigSum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+//WatchRemoteCfg 定时拉取远程配置,有修改时跟配置文件修改走同样的重新加载流程,done关闭时退出
+func WatchRemoteCfg(cfgPath string, mc *MonitorCfg, hasModify chan<- int, done <-chan struct{}) {
+	rs := NewRemoteCfgSource(cfgPath)
+	for {
+		rc := mc.GetRemoteCfg()
+		if rc.Open {
+			if !PathExists(filepath.Dir(rc.Cache)) {
+				os.MkdirAll(filepath.Dir(rc.Cache), os.ModePerm)
+			}
+
+			if changed, err := rs.Poll(rc); err != nil {
+				logdoo.Warn("poll remote config fail, use the last-known-good cache", logdoo.String("cache", rc.Cache), logdoo.Err(err))
+			} else if changed {
+				logdoo.Info("remote config changed", logdoo.String("cache", rc.Cache))
+				select {
+				case hasModify <- WatcherModify:
+				case <-done:
+					return
+				}
+			}
+		}
+
+		//Interval为0或者负数时按最小间隔,避免空转
+		wait := rc.Interval
+		if wait < RemoteCfgMinInterval {
+			wait = RemoteCfgMinInterval
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
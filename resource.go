@@ -0,0 +1,274 @@
+package main
+
+import (
+	"GoMonitor/logdoo"
+	"GoMonitor/probe"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//通知的标题
+const (
+	ResourceReason        = "resource usage over threshold!"
+	ResourceRestartReason = "resource usage over threshold and restart!"
+)
+
+//超过阈值时的处理
+const (
+	ResourceActionNotify  = "notify"
+	ResourceActionRestart = "restart"
+)
+
+//ResourceCfg [Resource]一个service的资源监控配置,阈值为0表示不检查
+type ResourceCfg struct {
+	Name     string
+	Service  string
+	Interval time.Duration //采集间隔
+	Duration time.Duration //持续超过阈值多久才处理
+	CPU      float64       //CPU使用率(占整机的百分比)
+	RSS      uint64        //内存(MB)
+	Handles  int
+	Threads  int
+	Action   string //notify或者restart
+}
+
+//ResourceStatus 一个service最近一次采集的资源使用
+type ResourceStatus struct {
+	Service string    `json:"service"`
+	Pid     uint32    `json:"pid"`
+	CPU     float64   `json:"cpu_percent"`
+	RSS     uint64    `json:"rss_bytes"`
+	Handles int       `json:"handles"`
+	Threads int       `json:"threads"`
+	Procs   int       `json:"procs"`
+	Breach  bool      `json:"breach"` //当前是否超过阈值
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error,omitempty"`
+}
+
+//ResourceMonitor 管理所有service的资源监控,每个service一个协程
+type ResourceMonitor struct {
+	runners map[string]*resourceRunner
+	mu      sync.Mutex
+}
+
+type resourceRunner struct {
+	cfg      ResourceCfg
+	notifier Notifier
+	status   ResourceStatus
+	last     probe.ProcSample //上一次的采集,用于计算CPU使用率
+	lastPid  uint32
+	lastTime time.Time
+	since    time.Time //开始持续超过阈值的时间
+	log      *logdoo.Context
+	stop     chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+//NewResourceMonitor New一个资源监控管理
+func NewResourceMonitor() *ResourceMonitor {
+	return &ResourceMonitor{runners: make(map[string]*resourceRunner)}
+}
+
+//Update 按新的配置更新资源监控,配置没有变化的继续运行
+func (rm *ResourceMonitor) Update(cfgs []ResourceCfg, n Notifier) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	keep := make(map[string]bool, len(cfgs))
+	for _, c := range cfgs {
+		key := fmt.Sprintf("%+v", c)
+		keep[key] = true
+		if _, ok := rm.runners[key]; ok {
+			continue
+		}
+		r := &resourceRunner{cfg: c, notifier: n, status: ResourceStatus{Service: c.Service}, stop: make(chan struct{}), done: make(chan struct{}),
+			log: logdoo.With("service", c.Service, "rule", c.Name).Limited(LogLimitWindow)}
+		rm.runners[key] = r
+		go r.run()
+		logdoo.Info("resource monitor start", logdoo.String("name", c.Name), logdoo.String("service", c.Service), logdoo.String("action", c.Action))
+	}
+
+	for key, r := range rm.runners {
+		if !keep[key] {
+			close(r.stop)
+			<-r.done
+			delete(rm.runners, key)
+			logdoo.Info("resource monitor stop", logdoo.String("name", r.cfg.Name), logdoo.String("service", r.cfg.Service))
+		}
+	}
+}
+
+//Close 停止所有的资源监控
+func (rm *ResourceMonitor) Close() {
+	rm.Update(nil, nil)
+}
+
+//Status 所有service最近一次采集的资源使用(按service排序)
+func (rm *ResourceMonitor) Status() []ResourceStatus {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	status := make([]ResourceStatus, 0, len(rm.runners))
+	for _, r := range rm.runners {
+		r.mu.Lock()
+		status = append(status, r.status)
+		r.mu.Unlock()
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Service < status[j].Service })
+	return status
+}
+
+func (r *resourceRunner) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		r.sampleOnce(time.Now())
+	}
+}
+
+//sampleOnce 采集一次,持续超过阈值Duration时通知或者重启
+func (r *resourceRunner) sampleOnce(now time.Time) {
+	log := r.log
+	st := ResourceStatus{Service: r.cfg.Service, Time: now}
+
+	pid, err := probe.ServicePid(r.cfg.Service)
+	if err == nil && pid == 0 {
+		err = fmt.Errorf("service not running")
+	}
+	var sample probe.ProcSample
+	if err == nil {
+		sample, err = probe.SampleProcessTree(pid)
+	}
+	if err != nil {
+		st.Error = err.Error()
+		r.mu.Lock()
+		r.status, r.lastPid, r.since = st, 0, time.Time{}
+		r.mu.Unlock()
+		log.Debug("sample resource fail", logdoo.Err(err))
+		return
+	}
+
+	st.Pid, st.RSS, st.Handles, st.Threads, st.Procs = pid, sample.RSS, sample.Handles, sample.Threads, sample.Procs
+	r.mu.Lock()
+	if r.lastPid == pid && now.After(r.lastTime) && sample.CPUTime >= r.last.CPUTime {
+		st.CPU = float64(sample.CPUTime-r.last.CPUTime) / float64(now.Sub(r.lastTime)) / float64(runtime.NumCPU()) * 100
+	}
+	r.last, r.lastPid, r.lastTime = sample, pid, now
+
+	breaches := r.breaches(st)
+	st.Breach = len(breaches) > 0
+	r.status = st
+	if !st.Breach {
+		r.since = time.Time{}
+		r.mu.Unlock()
+		return
+	}
+	if r.since.IsZero() {
+		r.since = now
+	}
+	sustained := now.Sub(r.since)
+	act := sustained >= r.cfg.Duration
+	if act {
+		//处理后重新计时,依然超过阈值的要再持续Duration才会再次处理
+		r.since = time.Time{}
+	}
+	r.mu.Unlock()
+
+	log.Warn("resource over threshold", logdoo.String("breach", strings.Join(breaches, ", ")), logdoo.Duration("sustained", sustained))
+	if !act || r.notifier == nil {
+		return
+	}
+
+	detail := fmt.Sprintf("%s over threshold for %s: %s\npid %d procs %d cpu %.1f%% rss %dMB handles %d threads %d",
+		r.cfg.Name, sustained.Round(time.Second), strings.Join(breaches, ", "), pid, st.Procs, st.CPU, st.RSS/1024/1024, st.Handles, st.Threads)
+	logdoo.With("service", r.cfg.Service, "rule", r.cfg.Name).Error("resource over threshold, "+r.cfg.Action, logdoo.String("detail", detail))
+	if r.cfg.Action == ResourceActionRestart {
+		if !r.notifier.RequestRestart(r.cfg.Service, ResourceRestartReason, detail, true) {
+			log.Warn("service is not monitored or is restarting, skip restart")
+		}
+		return
+	}
+	r.notifier.Notify(r.cfg.Service, ResourceReason, detail)
+}
+
+//breaches 超过阈值的项
+func (r *resourceRunner) breaches(st ResourceStatus) []string {
+	var b []string
+	if r.cfg.CPU > 0 && st.CPU > r.cfg.CPU {
+		b = append(b, fmt.Sprintf("cpu %.1f%% > %.1f%%", st.CPU, r.cfg.CPU))
+	}
+	if r.cfg.RSS > 0 && st.RSS > r.cfg.RSS*1024*1024 {
+		b = append(b, fmt.Sprintf("rss %dMB > %dMB", st.RSS/1024/1024, r.cfg.RSS))
+	}
+	if r.cfg.Handles > 0 && st.Handles > r.cfg.Handles {
+		b = append(b, fmt.Sprintf("handles %d > %d", st.Handles, r.cfg.Handles))
+	}
+	if r.cfg.Threads > 0 && st.Threads > r.cfg.Threads {
+		b = append(b, fmt.Sprintf("threads %d > %d", st.Threads, r.cfg.Threads))
+	}
+	return b
+}
+
+//RegisterMetricsApi 注册指标相关的接口
+func RegisterMetricsApi(api *ControlApi, rm *ResourceMonitor) {
+	//GET /metrics Prometheus文本格式的指标
+	api.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteMetrics(w, rm.Status())
+	})
+	//GET /resource 所有service最近一次采集的资源使用
+	api.HandleFunc("/resource", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, rm.Status())
+	})
+}
+
+//WriteMetrics 按Prometheus文本格式输出资源使用
+func WriteMetrics(w io.Writer, status []ResourceStatus) {
+	metrics := []struct {
+		name  string
+		help  string
+		value func(st ResourceStatus) float64
+	}{
+		{"gomonitor_process_up", "Whether the service process was sampled successfully.", func(st ResourceStatus) float64 { return bool2float(st.Error == "") }},
+		{"gomonitor_process_cpu_percent", "CPU usage of the service process tree, percent of the whole machine.", func(st ResourceStatus) float64 { return st.CPU }},
+		{"gomonitor_process_resident_memory_bytes", "Resident memory of the service process tree.", func(st ResourceStatus) float64 { return float64(st.RSS) }},
+		{"gomonitor_process_handles", "Open handles (fds on Linux) of the service process tree.", func(st ResourceStatus) float64 { return float64(st.Handles) }},
+		{"gomonitor_process_threads", "Threads of the service process tree.", func(st ResourceStatus) float64 { return float64(st.Threads) }},
+		{"gomonitor_process_count", "Processes in the service process tree.", func(st ResourceStatus) float64 { return float64(st.Procs) }},
+		{"gomonitor_resource_breach", "Whether the service is over any resource threshold.", func(st ResourceStatus) float64 { return bool2float(st.Breach) }},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, st := range status {
+			fmt.Fprintf(w, "%s{service=\"%s\"} %g\n", m.name, metricLabel(st.Service), m.value(st))
+		}
+	}
+}
+
+//metricLabel 转义Prometheus标签的值
+func metricLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func bool2float(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"GoMonitor/probe"
+	"context"
+	"fmt"
+	"strings"
+)
+
+//Nagios插件的退出码
+const (
+	ScriptOk       = 0
+	ScriptWarning  = 1
+	ScriptCritical = 2
+	ScriptUnknown  = 3
+)
+
+//ScriptCheckCfg [ScriptCheck]一个service的脚本检查配置
+type ScriptCheckCfg struct {
+	CheckCfg
+	Command string //检查的命令行,按Nagios插件的约定返回0/1/2/3
+}
+
+//ScriptChecker 脚本检查,退出码0正常,1警告(只记日记),2异常,3未知(也算失败)
+type ScriptChecker struct {
+	cfg ScriptCheckCfg
+}
+
+//CheckWarning 检查通过但有警告,不计入连续失败
+type CheckWarning struct {
+	Msg string
+}
+
+func (w *CheckWarning) Error() string {
+	return w.Msg
+}
+
+//NewScriptChecker New一个脚本检查
+func NewScriptChecker(cfg ScriptCheckCfg) (*ScriptChecker, error) {
+	if strings.TrimSpace(cfg.Command) == "" {
+		return nil, fmt.Errorf("%s Command is empty", cfg.Name)
+	}
+	return &ScriptChecker{cfg: cfg}, nil
+}
+
+func (sc *ScriptChecker) Kind() string {
+	return "script"
+}
+
+//Check 运行一次脚本,根据退出码返回结果,输出为脚本的标准输出和标准错误
+func (sc *ScriptChecker) Check(ctx context.Context) (string, error) {
+	env := []string{"GOMONITOR_SERVICE=" + sc.cfg.Service, "GOMONITOR_CHECK=" + sc.cfg.Name}
+	res, err := probe.RunScript(ctx, sc.cfg.Command, env)
+	output := strings.TrimSpace(res.Output)
+	if err != nil {
+		return output, err
+	}
+
+	switch res.Code {
+	case ScriptOk:
+		return output, nil
+	case ScriptWarning:
+		return output, &CheckWarning{Msg: "WARNING: " + FirstLine(output)}
+	case ScriptCritical:
+		return output, fmt.Errorf("CRITICAL: %s", FirstLine(output))
+	default:
+		return output, fmt.Errorf("UNKNOWN(exit %d): %s", res.Code, FirstLine(output))
+	}
+}
+
+//FirstLine 输出的第一行(Nagios插件的状态行)
+func FirstLine(s string) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"gopkg.in/ini.v1"
+)
+
+//配置项中密码等敏感信息的引用前缀
+//env:NAME    从环境变量NAME读取
+//file:PATH   从文件PATH读取(文件只需对服务运行账号可读)
+//secret:NAME 从本地加密的secrets文件读取,使用key文件解密
+const (
+	SecretEnvPrefix   = "env:"
+	SecretFilePrefix  = "file:"
+	SecretStorePrefix = "secret:"
+)
+
+const (
+	SecretKeyFile   = "secret.key"  //解密secrets文件的key文件名
+	SecretStoreFile = "secrets.ini" //加密存放的secrets文件名
+	SecretSection   = "Secrets"
+)
+
+//IsSecretRef 判断配置值是否为敏感信息的引用而不是明文
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretEnvPrefix) ||
+		strings.HasPrefix(value, SecretFilePrefix) ||
+		strings.HasPrefix(value, SecretStorePrefix)
+}
+
+//ResolveSecret 解析配置值,如果是引用则读取真实值,否则原样返回(兼容明文配置)
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret env %s not set", name)
+		}
+		return v, nil
+
+	case strings.HasPrefix(value, SecretFilePrefix):
+		path := strings.TrimPrefix(value, SecretFilePrefix)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read secret file %s err:%s", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case strings.HasPrefix(value, SecretStorePrefix):
+		return LoadStoreSecret(GetCfgDir(), strings.TrimPrefix(value, SecretStorePrefix))
+	}
+
+	return value, nil
+}
+
+//LoadStoreSecret 从dir目录下的secrets文件中读取并解密name对应的值
+func LoadStoreSecret(dir, name string) (string, error) {
+	key, err := readSecretKey(dir + "\\" + SecretKeyFile)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := ini.Load(dir + "\\" + SecretStoreFile)
+	if err != nil {
+		return "", fmt.Errorf("load secret store err:%s", err)
+	}
+
+	sec, err := cfg.GetSection(SecretSection)
+	if err != nil || !sec.HasKey(name) {
+		return "", fmt.Errorf("secret %s not found in store", name)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sec.Key(name).Value())
+	if err != nil {
+		return "", fmt.Errorf("secret %s decode err:%s", name, err)
+	}
+
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("secret %s data too short", name)
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s decrypt fail, please confirm the key file", name)
+	}
+
+	return string(plain), nil
+}
+
+//SaveStoreSecret 加密value并以name保存到dir目录下的secrets文件中(key文件不存在时自动生成)
+func SaveStoreSecret(dir, name, value string) error {
+	keyPath := dir + "\\" + SecretKeyFile
+	if !PathExists(keyPath) {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return fmt.Errorf("generate secret key err:%s", err)
+		}
+		if err := ioutil.WriteFile(keyPath, []byte(hex.EncodeToString(key)), 0600); err != nil {
+			return fmt.Errorf("write secret key file err:%s", err)
+		}
+	}
+	//之前版本生成的key文件也在这里收紧权限
+	if err := RestrictFileAccess(keyPath); err != nil {
+		return err
+	}
+
+	key, err := readSecretKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("generate secret nonce err:%s", err)
+	}
+	data := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	storePath := dir + "\\" + SecretStoreFile
+	cfg := ini.Empty()
+	if PathExists(storePath) {
+		if cfg, err = ini.Load(storePath); err != nil {
+			return fmt.Errorf("load secret store err:%s", err)
+		}
+	}
+	cfg.Section(SecretSection).Key(name).SetValue(base64.StdEncoding.EncodeToString(data))
+
+	if err := cfg.SaveTo(storePath); err != nil {
+		return fmt.Errorf("save secret store err:%s", err)
+	}
+	return RestrictFileAccess(storePath)
+}
+
+//RestrictFileAccess 文件只允许SYSTEM、Administrators和当前账号(服务运行的账号)访问,不继承目录的权限;
+//Windows上chmod 0600只会去掉只读属性,不能限制其它账号读取
+func RestrictFileAccess(path string) error {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return fmt.Errorf("get current user err:%s", err)
+	}
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;FA;;;SY)(A;;FA;;;BA)(A;;FA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return fmt.Errorf("build security descriptor err:%s", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("build security descriptor err:%s", err)
+	}
+	if err := windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil); err != nil {
+		return fmt.Errorf("restrict access of %s err:%s", path, err)
+	}
+	return nil
+}
+
+func readSecretKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read secret key file err:%s", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("secret key file %s invalid", path)
+	}
+	return key, nil
+}
+
+func newSecretGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secret cipher err:%s", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+//MaskSecret 把字符串s中出现的secret替换掉,用于打印日记时防止泄露密码
+func MaskSecret(s, secret string) string {
+	if secret == "" {
+		return s
+	}
+	return strings.Replace(s, secret, "******", -1)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+//secretDir 临时的secrets目录
+func secretDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("GOMONITOR_TEST_SECRET", "Env-S3cr3t")
+	defer os.Unsetenv("GOMONITOR_TEST_SECRET")
+	os.Unsetenv("GOMONITOR_TEST_UNSET")
+
+	file := filepath.Join(secretDir(t), "pass.txt")
+	if err := ioutil.WriteFile(file, []byte("File-S3cr3t\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		err   string
+	}{
+		{"plain", "Plain-S3cr3t", "Plain-S3cr3t", ""},
+		{"empty", "", "", ""},
+		{"env", "env:GOMONITOR_TEST_SECRET", "Env-S3cr3t", ""},
+		{"env not set", "env:GOMONITOR_TEST_UNSET", "", "not set"},
+		{"file trims newline", "file:" + file, "File-S3cr3t", ""},
+		{"file not exist", "file:" + file + ".none", "", "read secret file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSecret(tt.value)
+			if tt.err == "" && (err != nil || got != tt.want) {
+				t.Errorf("ResolveSecret(%q) = %q %v, want %q", tt.value, got, err, tt.want)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("ResolveSecret(%q) err %v, want %s", tt.value, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestStoreSecretRoundTrip(t *testing.T) {
+	dir := secretDir(t)
+	if err := SaveStoreSecret(dir, "smtp", "Store-S3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveStoreSecret(dir, "other", "Other-S3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"smtp": "Store-S3cr3t", "other": "Other-S3cr3t"} {
+		if got, err := LoadStoreSecret(dir, name); err != nil || got != want {
+			t.Errorf("LoadStoreSecret(%s) = %q %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := LoadStoreSecret(dir, "none"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing secret err %v", err)
+	}
+
+	//密文中不能出现明文
+	store, err := ioutil.ReadFile(filepath.Join(dir, SecretStoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(store), "S3cr3t") {
+		t.Errorf("plain secret found in store:\n%s", store)
+	}
+
+	//重新保存同名的值会覆盖
+	if err := SaveStoreSecret(dir, "smtp", "New-S3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadStoreSecret(dir, "smtp"); err != nil || got != "New-S3cr3t" {
+		t.Errorf("after overwrite %q %v", got, err)
+	}
+}
+
+func TestStoreSecretTampered(t *testing.T) {
+	dir := secretDir(t)
+	if err := SaveStoreSecret(dir, "smtp", "Store-S3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(dir, SecretStoreFile)
+	cfg, err := ini.Load(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := cfg.Section(SecretSection)
+
+	//密文绑定了名字,换个名字不能解密
+	sec.Key("copy").SetValue(sec.Key("smtp").Value())
+	//改掉密文的最后一个字节
+	data, _ := base64.StdEncoding.DecodeString(sec.Key("smtp").Value())
+	data[len(data)-1] ^= 0xff
+	sec.Key("smtp").SetValue(base64.StdEncoding.EncodeToString(data))
+	sec.Key("short").SetValue(base64.StdEncoding.EncodeToString([]byte("abc")))
+	if err := cfg.SaveTo(storePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"copy", "smtp", "short"} {
+		if _, err := LoadStoreSecret(dir, name); err == nil {
+			t.Errorf("tampered secret %s should fail", name)
+		}
+	}
+
+	//换一个key文件不能解密
+	other := secretDir(t)
+	if err := SaveStoreSecret(other, "x", "y"); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ioutil.ReadFile(filepath.Join(other, SecretKeyFile))
+	if err := ioutil.WriteFile(filepath.Join(dir, SecretKeyFile), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStoreSecret(dir, "copy"); err == nil || !strings.Contains(err.Error(), "decrypt fail") {
+		t.Errorf("wrong key err %v", err)
+	}
+}
+
+func TestStoreSecretKeyInvalid(t *testing.T) {
+	dir := secretDir(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, SecretKeyFile), []byte("not hex"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveStoreSecret(dir, "smtp", "v"); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("invalid key err %v", err)
+	}
+	if _, err := LoadStoreSecret(secretDir(t), "smtp"); err == nil {
+		t.Error("load without key file should fail")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+//StaleCheckCfg [StaleCheck]一个service的心跳文件/日记活跃检查配置
+type StaleCheckCfg struct {
+	CheckCfg
+	Path   string        //检查的文件或者目录,默认为service的AttachX
+	MaxAge time.Duration //超过这个时间没有修改认为service挂起了
+}
+
+//StaleChecker 心跳检查,文件(目录时为目录下最后修改的文件)超过MaxAge没有修改时返回错误;
+//除了文件的修改时间,还用fsnotify记录最后一次写入的时间(Windows上文件一直打开写入时修改时间不一定及时更新)
+type StaleChecker struct {
+	cfg      StaleCheckCfg
+	watcher  *fsnotify.Watcher
+	activity time.Time //fsnotify收到的最后一次写入的时间
+	closed   bool
+	mu       sync.Mutex
+}
+
+//NewStaleChecker New一个心跳检查,fsnotify在第一次检查时才开始监听
+func NewStaleChecker(cfg StaleCheckCfg) (*StaleChecker, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("%s Path is empty", cfg.Name)
+	}
+	return &StaleChecker{cfg: cfg}, nil
+}
+
+func (sc *StaleChecker) Kind() string {
+	return "stale"
+}
+
+//Check 检查最后一次修改距离现在的时间
+func (sc *StaleChecker) Check(ctx context.Context) (string, error) {
+	sc.watch()
+
+	last, file, err := GetLastModTime(sc.cfg.Path)
+	if act := sc.Activity(); act.After(last) {
+		last, file = act, sc.cfg.Path
+	}
+	if last.IsZero() {
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no file in %s", sc.cfg.Path)
+	}
+
+	age := time.Since(last)
+	output := fmt.Sprintf("%s last modified %s ago (%s)", file, age.Round(time.Second), last.Format("2006-01-02 15:04:05"))
+	if age > sc.cfg.MaxAge {
+		return output, fmt.Errorf("%s not modified for %s, max age %s", sc.cfg.Path, age.Round(time.Second), sc.cfg.MaxAge)
+	}
+	return output, nil
+}
+
+//Activity fsnotify记录的最后一次写入的时间
+func (sc *StaleChecker) Activity() time.Time {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.activity
+}
+
+//watch 开始监听Path的写入,失败时只依赖修改时间,下一次检查时再重试
+func (sc *StaleChecker) watch() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.watcher != nil || sc.closed {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+	if err = watcher.Add(sc.cfg.Path); err != nil {
+		watcher.Close()
+		return
+	}
+	sc.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					sc.mu.Lock()
+					sc.activity = time.Now()
+					sc.mu.Unlock()
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+}
+
+//Close 停止fsnotify的监听
+func (sc *StaleChecker) Close() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.closed = true
+	if sc.watcher == nil {
+		return nil
+	}
+	err := sc.watcher.Close()
+	sc.watcher = nil
+	return err
+}
+
+//GetLastModTime 文件的修改时间,目录时为目录下最后修改的文件的修改时间
+func GetLastModTime(path string) (time.Time, string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if !fi.IsDir() {
+		return fi.ModTime(), path, nil
+	}
+
+	last, err := GetLastModFile(path)
+	if err != nil || last == nil {
+		return time.Time{}, "", err
+	}
+	return last.ModTime(), path + string(os.PathSeparator) + last.Name(), nil
+}
+
+//GetLastModFile 获取指定目录下最后修改的文件,没有文件时返回nil
+func GetLastModFile(dirPth string) (os.FileInfo, error) {
+	dir, err := ioutil.ReadDir(dirPth)
+	if err != nil {
+		return nil, err
+	}
+
+	var last os.FileInfo
+	for _, fi := range dir {
+		if !fi.IsDir() && (last == nil || last.ModTime().Before(fi.ModTime())) {
+			last = fi
+		}
+	}
+	return last, nil
+}
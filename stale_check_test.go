@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//touchOld 追加写入文件,再把修改时间改回很久以前,模拟修改时间没有及时更新的情况
+func touchOld(t *testing.T, path string, old time.Time) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("beat\n")
+	f.Close()
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleCheckFsnotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := StaleCheckCfg{CheckCfg: CheckCfg{Name: "StaleCheck1"}, Path: dir, MaxAge: 500 * time.Millisecond}
+	empty, _ := NewStaleChecker(cfg)
+	if _, err := empty.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "no file") {
+		t.Errorf("empty dir err %v", err)
+	}
+	empty.Close()
+
+	old := time.Now().Add(-time.Hour)
+	path := filepath.Join(dir, "heartbeat.txt")
+	touchOld(t, path, old)
+
+	//第一次检查时开始监听
+	sc, err := NewStaleChecker(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if output, err := sc.Check(context.Background()); err == nil || !strings.Contains(output, "heartbeat.txt") {
+		t.Errorf("old file output %q err %v, want stale", output, err)
+	}
+
+	//修改时间没有变,fsnotify收到的写入让检查通过
+	touchOld(t, path, old)
+	deadline := time.Now().Add(5 * time.Second)
+	for sc.Activity().IsZero() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sc.Activity().IsZero() {
+		t.Fatal("no write event from fsnotify")
+	}
+	if output, err := sc.Check(context.Background()); err != nil {
+		t.Errorf("fresh by fsnotify output %q err %v", output, err)
+	}
+
+	//之后没有写入,超过MaxAge再次认为挂起
+	time.Sleep(700 * time.Millisecond)
+	if _, err := sc.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "not modified") {
+		t.Errorf("no write for max age err %v", err)
+	}
+
+	//修改时间更新的写入不依赖fsnotify
+	sc.Close()
+	if err := ioutil.WriteFile(path, []byte("beat\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := sc.Check(context.Background()); err != nil || !strings.Contains(output, "heartbeat.txt") {
+		t.Errorf("fresh by mod time output %q err %v", output, err)
+	}
+}
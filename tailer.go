@@ -0,0 +1,143 @@
+package main
+
+import (
+	"GoMonitor/probe"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+//TailReadLimit 每次Poll最多读取的字节数,剩下的下一次再读
+const TailReadLimit = 4 * 1024 * 1024
+
+//TailLineLimit 单行最大长度,超过时按这个长度拆成多行
+const TailLineLimit = 64 * 1024
+
+//Tailer 跟踪文件(目录时跟踪目录下最后修改的文件)新增的行;
+//每次Poll时才打开文件,不会一直持有文件句柄影响service切换/删除日记;
+//能处理切换到新文件(先读完旧文件)、文件被截断(从头读)以及被替换(新文件从头读)
+type Tailer struct {
+	path    string
+	fromEnd bool        //第一次Poll时从文件末尾开始,之后的新文件都从头读
+	name    string      //当前跟踪的文件
+	info    os.FileInfo //当前跟踪的文件的信息,用于判断文件是否被替换
+	offset  int64
+	partial []byte //还没有换行的内容
+}
+
+//NewTailer New一个Tailer,fromEnd为true时忽略已有的内容
+func NewTailer(path string, fromEnd bool) *Tailer {
+	return &Tailer{path: path, fromEnd: fromEnd}
+}
+
+//Name 当前跟踪的文件
+func (t *Tailer) Name() string {
+	return t.name
+}
+
+//Poll 读取上次Poll之后新增的完整的行
+func (t *Tailer) Poll() ([]string, error) {
+	fromEnd := t.fromEnd
+	t.fromEnd = false
+
+	target, err := t.target()
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	if t.info != nil && target != t.name {
+		//切换到新文件前读完旧文件
+		if fi, er := os.Stat(t.name); er == nil && os.SameFile(fi, t.info) {
+			lines, _ = t.read(t.name, lines)
+		}
+		lines = t.flush(lines)
+		t.info, t.offset = nil, 0
+	}
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		return lines, err
+	}
+	switch {
+	case t.info == nil:
+		if fromEnd {
+			t.offset = fi.Size()
+		}
+	case !os.SameFile(fi, t.info):
+		//文件被替换了,新文件从头读
+		lines = t.flush(lines)
+		t.offset = 0
+	case fi.Size() < t.offset:
+		//文件被截断了,从头读
+		t.partial, t.offset = nil, 0
+	}
+	t.name, t.info = target, fi
+
+	if fi.Size() > t.offset {
+		return t.read(target, lines)
+	}
+	return lines, nil
+}
+
+//target 要跟踪的文件
+func (t *Tailer) target() (string, error) {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return t.path, nil
+	}
+
+	last, err := GetLastModFile(t.path)
+	if err != nil {
+		return "", err
+	}
+	if last == nil {
+		return "", os.ErrNotExist
+	}
+	return t.path + string(os.PathSeparator) + last.Name(), nil
+}
+
+//read 从offset开始读取name的内容,完整的行追加到lines后面
+func (t *Tailer) read(name string, lines []string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return lines, err
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(t.offset, io.SeekStart); err != nil {
+		return lines, err
+	}
+	data, err := probe.ReadLimit(io.LimitReader(f, TailReadLimit), TailReadLimit)
+	t.offset += int64(len(data))
+
+	t.partial = append(t.partial, data...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, strings.TrimRight(string(t.partial[:i]), "\r"))
+		t.partial = t.partial[i+1:]
+	}
+	for len(t.partial) >= TailLineLimit {
+		lines = append(lines, string(t.partial[:TailLineLimit]))
+		t.partial = t.partial[TailLineLimit:]
+	}
+	//partial可能引用了很大的data,拷贝出来
+	t.partial = append([]byte(nil), t.partial...)
+	return lines, err
+}
+
+//flush 文件切换时旧文件最后没有换行的内容也作为一行
+func (t *Tailer) flush(lines []string) []string {
+	if len(t.partial) > 0 {
+		lines = append(lines, strings.TrimRight(string(t.partial), "\r"))
+	}
+	t.partial = nil
+	return lines
+}
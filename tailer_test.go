@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tailDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func appendFile(t *testing.T, path, s string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//pollLines Poll一次,比较读到的行
+func pollLines(t *testing.T, tl *Tailer, want ...string) {
+	t.Helper()
+	lines, err := tl.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("lines %q, want %q", lines, want)
+	}
+}
+
+func TestTailerPartialLine(t *testing.T) {
+	path := filepath.Join(tailDir(t), "app.log")
+	appendFile(t, path, "old1\nold2\n")
+
+	tl := NewTailer(path, true)
+	pollLines(t, tl)
+
+	appendFile(t, path, "l1\r\nl2")
+	pollLines(t, tl, "l1")
+	//没有换行的内容等到有换行时才作为一行
+	pollLines(t, tl)
+	appendFile(t, path, "-end\n")
+	pollLines(t, tl, "l2-end")
+
+	//没有换行的内容超过TailLineLimit时先按TailLineLimit输出
+	appendFile(t, path, strings.Repeat("x", TailLineLimit+10))
+	lines, err := tl.Poll()
+	if err != nil || len(lines) != 1 || lines[0] != strings.Repeat("x", TailLineLimit) {
+		t.Errorf("long partial line split into %d lines err %v", len(lines), err)
+	}
+	appendFile(t, path, "\n")
+	pollLines(t, tl, strings.Repeat("x", 10))
+}
+
+func TestTailerRotate(t *testing.T) {
+	dir := tailDir(t)
+	old := filepath.Join(dir, "20200101.log")
+	appendFile(t, old, "a1\n")
+	past := time.Now().Add(-time.Minute)
+	os.Chtimes(old, past, past)
+
+	tl := NewTailer(dir, false)
+	pollLines(t, tl, "a1")
+	if tl.Name() != old {
+		t.Fatalf("tail %s, want %s", tl.Name(), old)
+	}
+
+	//切换到新文件之前旧文件又写入了内容,最后一行没有换行
+	appendFile(t, old, "a2\na3")
+	os.Chtimes(old, past, past)
+	cur := filepath.Join(dir, "20200102.log")
+	appendFile(t, cur, "b1\n")
+
+	pollLines(t, tl, "a2", "a3", "b1")
+	if tl.Name() != cur {
+		t.Errorf("tail %s, want %s", tl.Name(), cur)
+	}
+	appendFile(t, cur, "b2\n")
+	pollLines(t, tl, "b2")
+}
+
+func TestTailerTruncate(t *testing.T) {
+	path := filepath.Join(tailDir(t), "app.log")
+	appendFile(t, path, "l1\nl2\npartial")
+
+	tl := NewTailer(path, false)
+	pollLines(t, tl, "l1", "l2")
+
+	//截断后从头读,截断前没有换行的内容丢弃
+	if err := ioutil.WriteFile(path, []byte("n1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pollLines(t, tl, "n1")
+	appendFile(t, path, "n2\n")
+	pollLines(t, tl, "n2")
+}
+
+func TestTailerReplace(t *testing.T) {
+	dir := tailDir(t)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old1\nold-partial")
+
+	tl := NewTailer(path, false)
+	pollLines(t, tl, "old1")
+
+	//新文件比旧文件的偏移大也能发现被替换了
+	tmp := filepath.Join(dir, "app.log.tmp")
+	appendFile(t, tmp, "new1\nnew2 is a longer line than the old file\n")
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	pollLines(t, tl, "old-partial", "new1", "new2 is a longer line than the old file")
+	appendFile(t, path, "new3\n")
+	pollLines(t, tl, "new3")
+}
@@ -69,6 +69,11 @@ func RunWindowService(status int) {
 		return
 	}
 
+	//命令行工具
+	if len(os.Args) > 1 && RunToolCmd(os.Args[1:]) {
+		return
+	}
+
 	//命令行方式操作服务
 	if len(os.Args) > 1 {
 		ServiceControl(s, os.Args[1])